@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"flag"
+	"fmt"
 	"log"
 	"os"
 	"os/signal"
@@ -18,9 +19,21 @@ func main() {
 	var useIndex bool
 
 	flag.StringVar(&configPath, "c", "", "path to configuration file")
-	flag.BoolVar(&useIndex, "i", false, "make db search through index")
+	flag.BoolVar(&useIndex, "i", false, "make db search through index by default (admins can override it with ?index=)")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "usage: %s [flags] [serve|reindex|backfill-images|bootstrap-admin]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
 	flag.Parse()
 
+	cmd := flag.Arg(0)
+	switch cmd {
+	case "", "serve", "reindex", "backfill-images", "bootstrap-admin":
+	default:
+		flag.Usage()
+		os.Exit(2) //nolint:gomnd // код ошибки использования, как у flag.
+	}
+
 	cfg, err := config.New(configPath)
 	if err != nil {
 		log.Fatalf("config getting error: %s", err.Error())
@@ -31,5 +44,26 @@ func main() {
 	ctx, cancel := signal.NotifyContext(context.Background(), shutdownSignals...)
 	defer cancel()
 
-	app.Run(ctx, cfg, useIndex)
+	switch cmd {
+	case "reindex":
+		// reindex перестраивает индекс по сохраненному тексту комиксов и завершается.
+		if err := app.Reindex(ctx, cfg, useIndex); err != nil {
+			cancel()
+			log.Fatalf("reindex error: %s", err.Error()) //nolint:gocritic // ctx уже отменен.
+		}
+	case "backfill-images":
+		// backfill-images скачивает недостающие картинки сохраненных комиксов и завершается.
+		if err := app.BackfillImages(ctx, cfg); err != nil {
+			cancel()
+			log.Fatalf("backfill images error: %s", err.Error())
+		}
+	case "bootstrap-admin":
+		// bootstrap-admin создает администратора из ADMIN_USERNAME и ADMIN_PASSWORD и завершается.
+		if err := app.BootstrapAdmin(ctx, cfg); err != nil {
+			cancel()
+			log.Fatalf("bootstrap admin error: %s", err.Error())
+		}
+	default:
+		app.Run(ctx, cfg, useIndex)
+	}
 }
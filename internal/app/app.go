@@ -2,27 +2,40 @@ package app
 
 import (
 	"context"
+	"errors"
+	"fmt"
 	"net/http"
 	_ "net/http/pprof" //nolint:gosec // TODO: remove on finixhing dev.
 	"os"
 	"time"
 
+	authmemorydb "github.com/Leopold1975/yadro_app/internal/auth/database/memorydb"
 	"github.com/Leopold1975/yadro_app/internal/auth/database/postgres"
+	user "github.com/Leopold1975/yadro_app/internal/auth/models"
 	auth "github.com/Leopold1975/yadro_app/internal/auth/usecase"
 	"github.com/Leopold1975/yadro_app/internal/controller/httpserver"
 	"github.com/Leopold1975/yadro_app/internal/controller/httpserver/middlewares"
+	"github.com/Leopold1975/yadro_app/internal/database/imagestore"
+	"github.com/Leopold1975/yadro_app/internal/database/jsondb"
+	"github.com/Leopold1975/yadro_app/internal/database/memorydb"
 	"github.com/Leopold1975/yadro_app/internal/database/postgresdb"
+	"github.com/Leopold1975/yadro_app/internal/models"
 	"github.com/Leopold1975/yadro_app/internal/pkg/config"
+	"github.com/Leopold1975/yadro_app/internal/pkg/jwtauth"
 	"github.com/Leopold1975/yadro_app/internal/usecase"
 	"github.com/Leopold1975/yadro_app/pkg/logger"
+	"github.com/Leopold1975/yadro_app/pkg/words"
 	"github.com/Leopold1975/yadro_app/pkg/xkcd"
 )
 
 const (
 	JSONDB     = "json"
+	MemoryDB   = "memory"
 	PostgresDB = "postgres"
 )
 
+var ErrUnknownDBType = errors.New("unknown db type")
+
 func Run(ctx context.Context, cfg config.Config, useIndex bool) {
 	go func() {
 		http.ListenAndServe("localhost:6060", nil) //nolint:gosec,errcheck // pprof
@@ -30,42 +43,100 @@ func Run(ctx context.Context, cfg config.Config, useIndex bool) {
 
 	lg := logger.New(cfg.Log)
 
-	db, err := postgresdb.New(ctx, cfg.DB, useIndex)
+	strategy, err := searchStrategy(cfg.Search, useIndex)
 	if err != nil {
-		lg.Error("postgres db error", "error", err)
+		lg.Error("search strategy error", "error", err)
 		os.Exit(1)
 	}
 
-	userDB, err := postgres.New(ctx, cfg.DB)
+	cfg.Search.Strategy = string(strategy)
+
+	db, err := newStorage(ctx, cfg.DB, strategy, cfg.Search.Language)
+	if err != nil {
+		lg.Error("comics db error", "type", cfg.DB.Type, "error", err)
+		os.Exit(1)
+	}
+
+	if _, ok := db.(usecase.FullTextSearcher); strategy == models.IndexFullText && !ok {
+		lg.Error("search strategy error", "error", usecase.ErrFullTextUnsupported, "type", cfg.DB.Type)
+		os.Exit(1)
+	}
+
+	userDB, err := newUserStorage(ctx, cfg.DB)
+	if err != nil {
+		lg.Error("users db error", "type", cfg.DB.Type, "error", err)
+		os.Exit(1)
+	}
+
+	audit := auth.NewAudit(userDB, lg)
+
+	c := xkcd.New(cfg.SourceURL, cfg.Client)
+
+	images, err := newImageStore(cfg.Images)
+	if err != nil {
+		lg.Error("image store error", "error", err)
+		os.Exit(1)
+	}
+
+	stemmer, err := words.NewStemmer(cfg.Search.Stemmer, cfg.Search.Language)
 	if err != nil {
-		lg.Error("postgres db error", "error", err)
+		lg.Error("stemmer error", "error", err)
+		os.Exit(1)
+	}
+
+	reindex := usecase.NewReindex(ctx, db, stemmer, audit, lg)
+
+	if err := reindex.EnsureStemmer(ctx); err != nil {
+		lg.Error("reindex error", "error", err)
 		os.Exit(1)
 	}
 
-	c := xkcd.New(cfg.SourceURL)
+	fetch := usecase.NewComicsFetch(c, db, images, stemmer, cfg.Parallel, cfg.Save, lg)
+	jobs := usecase.NewUpdateJobs(ctx, fetch, audit, lg)
+	find := usecase.NewComicsFind(db, cfg.Search, stemmer, lg)
+	image := usecase.NewComicsImage(db, images)
 
-	fetch := usecase.NewComicsFetch(c, &db, cfg.Parallel, lg)
-	refresh := usecase.NewBackgroundRefresh(fetch, cfg.RefreshTime.Time)
-	find := usecase.NewComicsFind(&db, lg)
+	refresh, err := usecase.NewBackgroundRefresh(jobs, cfg.Refresh, cfg.RefreshTime.Time)
+	if err != nil {
+		lg.Error("background refresh error", "error", err)
+		os.Exit(1)
+	}
 
 	go refresh.Refresh(ctx, lg)
 
-	login := auth.NewLoginUser(cfg.Auth, &userDB)
-	authUC := auth.NewAuthUser(cfg.Auth, &userDB)
+	signer, err := jwtauth.NewKeySet(cfg.Auth)
+	if err != nil {
+		lg.Error("signing keys error", "error", err)
+		os.Exit(1)
+	}
+
+	go signer.RunRotation(ctx, lg)
+
+	login := auth.NewLoginUser(cfg.Auth, userDB, userDB, userDB, signer, audit)
+	authUC := auth.NewAuthUser(userDB, userDB, userDB, signer)
+	users := auth.NewUsers(cfg.Auth, userDB, userDB, audit)
+	apiKeys := auth.NewAPIKeys(userDB, userDB, audit)
 
-	router := httpserver.NewRouter(find, fetch, login)
+	go login.RunAttemptsCleanup(ctx, lg)
+
+	if !persistentUsers(cfg.DB) {
+		bootstrapMemoryAdmin(ctx, cfg.Auth.Bootstrap, users, lg)
+	}
+
+	routes := httpserver.NewRouter(find, image, jobs, refresh, reindex, usecase.NewIndexCheck(db, audit),
+		login, users, apiKeys, signer, audit)
 
 	clmw := middlewares.NewConcurrencylimiter(cfg.APIConcurrency)
 	defer clmw.Close()
 
 	rl := middlewares.NewRateLimiter(cfg.Ratelimit)
 
-	router = middlewares.LogMiddleware(
+	router := middlewares.LogMiddleware(
 		clmw.ConcurrencyMiddleware(
 			middlewares.AuthMidleware(
 				rl.RatelimiterMiddleware(
-					router,
-				), authUC),
+					routes,
+				), authUC, routes),
 		),
 		lg)
 
@@ -92,3 +163,262 @@ func Run(ctx context.Context, cfg config.Config, useIndex bool) {
 		lg.Error("server stop error", "error", err)
 	}
 }
+
+// progressInterval — период вывода хода перестройки индекса командой reindex.
+const progressInterval = time.Second
+
+// Reindex перестраивает индекс всех комиксов стеммером из cfg.Search
+// и выводит ход перестройки в лог. Используется командой reindex;
+// с postgres ее запуск записывается в журнал аудита.
+func Reindex(ctx context.Context, cfg config.Config, useIndex bool) error {
+	lg := logger.New(cfg.Log)
+
+	strategy, err := searchStrategy(cfg.Search, useIndex)
+	if err != nil {
+		return fmt.Errorf("search strategy error: %w", err)
+	}
+
+	db, err := newStorage(ctx, cfg.DB, strategy, cfg.Search.Language)
+	if err != nil {
+		return fmt.Errorf("comics db error: %w", err)
+	}
+
+	stemmer, err := words.NewStemmer(cfg.Search.Stemmer, cfg.Search.Language)
+	if err != nil {
+		return fmt.Errorf("stemmer error: %w", err)
+	}
+
+	// с json и memory журнал аудита живет только в памяти процесса, и запись
+	// о запуске команды в нем бессмысленна: она остается только в логе.
+	userDB, err := newUserStorage(ctx, cfg.DB)
+	if err != nil {
+		return fmt.Errorf("users db error: %w", err)
+	}
+
+	audit := auth.NewAudit(userDB, lg)
+	reindex := usecase.NewReindex(ctx, db, stemmer, audit, lg)
+
+	ticker := time.NewTicker(progressInterval)
+	defer ticker.Stop()
+
+	done := make(chan error, 1)
+
+	go func() {
+		_, err := reindex.Run(ctx)
+		done <- err
+	}()
+
+	for {
+		select {
+		case err := <-done:
+			audit.Record(ctx, user.AuditEntry{ //nolint:exhaustruct
+				Action:  user.AuditIndexReindex,
+				Target:  stemmer.Name(),
+				Details: "command=reindex",
+			}, err)
+
+			if err == nil {
+				p := reindex.Status().Progress
+				lg.Info("reindex done", "indexed", p.Indexed, "skipped", p.Skipped, "total", p.Total)
+			}
+
+			return err
+		case <-ticker.C:
+			p := reindex.Status().Progress
+			lg.Info("reindex progress", "indexed", p.Indexed, "skipped", p.Skipped, "total", p.Total)
+		}
+	}
+}
+
+// BackfillImages скачивает картинки сохраненных комиксов, у которых их нет,
+// например загруженных до включения images.enabled. Используется командой backfill-images.
+func BackfillImages(ctx context.Context, cfg config.Config) error {
+	lg := logger.New(cfg.Log)
+
+	strategy, err := searchStrategy(cfg.Search, false)
+	if err != nil {
+		return fmt.Errorf("search strategy error: %w", err)
+	}
+
+	db, err := newStorage(ctx, cfg.DB, strategy, cfg.Search.Language)
+	if err != nil {
+		return fmt.Errorf("comics db error: %w", err)
+	}
+
+	images, err := newImageStore(cfg.Images)
+	if err != nil {
+		return err
+	}
+
+	stemmer, err := words.NewStemmer(cfg.Search.Stemmer, cfg.Search.Language)
+	if err != nil {
+		return fmt.Errorf("stemmer error: %w", err)
+	}
+
+	fetch := usecase.NewComicsFetch(xkcd.New(cfg.SourceURL, cfg.Client), db, images, stemmer,
+		cfg.Parallel, cfg.Save, lg)
+
+	resp, err := fetch.BackfillImages(ctx)
+	if err != nil {
+		return fmt.Errorf("backfill images error: %w", err)
+	}
+
+	for _, f := range resp.Failed {
+		lg.Error("backfill image failed", "id", f.ID, "reason", f.Reason)
+	}
+
+	lg.Info("backfill images done", "downloaded", len(resp.Fetched), "not_found", len(resp.Skipped),
+		"failed", len(resp.Failed), "total", resp.Total)
+
+	return nil
+}
+
+var (
+	ErrNoAdminPassword = errors.New("ADMIN_PASSWORD is not set")
+	ErrNoUsersDB       = errors.New("bootstrap-admin requires db.type postgres: " +
+		"with json and memory users are kept in memory and the server creates the admin on start")
+)
+
+// BootstrapAdmin создает администратора cfg.Auth.Bootstrap, если пользователя
+// с таким именем еще нет. Используется командой bootstrap-admin вместо
+// администратора с известным паролем, которого раньше создавала миграция.
+func BootstrapAdmin(ctx context.Context, cfg config.Config) error {
+	lg := logger.New(cfg.Log)
+	b := cfg.Auth.Bootstrap
+
+	if b.Password == "" {
+		return ErrNoAdminPassword
+	}
+
+	if !persistentUsers(cfg.DB) {
+		return ErrNoUsersDB
+	}
+
+	userDB, err := postgres.New(ctx, cfg.DB)
+	if err != nil {
+		return fmt.Errorf("postgres db error: %w", err)
+	}
+
+	audit := auth.NewAudit(&userDB, lg)
+
+	_, err = auth.NewUsers(cfg.Auth, &userDB, &userDB, audit).Create(ctx, b.Username, b.Password, user.AdminRole)
+	if errors.Is(err, user.ErrUserExists) {
+		lg.Info("admin already exists", "username", b.Username)
+
+		return nil
+	}
+
+	if err != nil {
+		return fmt.Errorf("create admin error: %w", err)
+	}
+
+	lg.Info("admin created", "username", b.Username)
+
+	return nil
+}
+
+// searchStrategy возвращает стратегию поиска из cfg. Флаг -i, оставшийся
+// с тех пор, когда стратегий было две, выбирает поиск по keyword_comics_map.
+func searchStrategy(cfg config.Search, useIndex bool) (models.IndexStrategy, error) {
+	if useIndex {
+		return models.IndexTable, nil
+	}
+
+	s, err := models.ParseIndexStrategy(cfg.Strategy)
+	if err != nil {
+		return "", fmt.Errorf("parse strategy error: %w", err)
+	}
+
+	return s, nil
+}
+
+// newStorage выбирает хранилище комиксов по cfg.Type. lang нужен только postgres
+// для полнотекстового поиска.
+func newStorage(ctx context.Context, cfg config.DB, strategy models.IndexStrategy, lang string,
+) (usecase.Storage, error) { //nolint:ireturn
+	switch cfg.Type {
+	case JSONDB:
+		db, err := jsondb.New(cfg)
+		if err != nil {
+			return nil, fmt.Errorf("json db error: %w", err)
+		}
+
+		return &db, nil
+	case MemoryDB:
+		db := memorydb.New()
+
+		return &db, nil
+	case PostgresDB, "":
+		db, err := postgresdb.New(ctx, cfg, strategy, lang)
+		if err != nil {
+			return nil, fmt.Errorf("postgres db error: %w", err)
+		}
+
+		return &db, nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownDBType, cfg.Type)
+	}
+}
+
+// userStorage — хранилище пользователей, токенов, API-ключей, попыток входа и аудита.
+type userStorage interface {
+	auth.Storage
+	auth.TokenStorage
+	auth.APIKeyStorage
+	auth.LoginAttemptStorage
+	auth.AuditStorage
+}
+
+// persistentUsers сообщает, хранятся ли пользователи в postgres. С хранилищами
+// комиксов json и memory postgres не нужен, и пользователи живут в памяти.
+func persistentUsers(cfg config.DB) bool {
+	return cfg.Type == PostgresDB || cfg.Type == ""
+}
+
+// newUserStorage подключается к postgres, только если в нем хранятся и комиксы.
+func newUserStorage(ctx context.Context, cfg config.DB) (userStorage, error) { //nolint:ireturn
+	if !persistentUsers(cfg) {
+		db := authmemorydb.New()
+
+		return &db, nil
+	}
+
+	db, err := postgres.New(ctx, cfg)
+	if err != nil {
+		return nil, fmt.Errorf("postgres db error: %w", err)
+	}
+
+	return &db, nil
+}
+
+// bootstrapMemoryAdmin создает администратора b в хранилище пользователей в памяти,
+// которое после перезапуска пустое: команда bootstrap-admin для него бесполезна.
+func bootstrapMemoryAdmin(ctx context.Context, b config.Bootstrap, users auth.UsersUsecase, lg logger.Logger) {
+	if b.Password == "" {
+		lg.Warn("users are kept in memory and ADMIN_PASSWORD is not set: nobody can log in")
+
+		return
+	}
+
+	if _, err := users.Create(ctx, b.Username, b.Password, user.AdminRole); err != nil {
+		lg.Error("create admin error", "username", b.Username, "error", err)
+
+		return
+	}
+
+	lg.Info("admin created in memory", "username", b.Username)
+}
+
+// newImageStore возвращает nil, если хранение картинок выключено.
+func newImageStore(cfg config.Images) (usecase.ImageStore, error) { //nolint:ireturn
+	if !cfg.Enabled {
+		return nil, nil //nolint:nilnil
+	}
+
+	store, err := imagestore.New(cfg.Dir)
+	if err != nil {
+		return nil, fmt.Errorf("image store error: %w", err)
+	}
+
+	return store, nil
+}
@@ -0,0 +1,475 @@
+package memorydb
+
+import (
+	"context"
+	"fmt"
+	"maps"
+	"slices"
+	"sync"
+	"time"
+
+	"github.com/Leopold1975/yadro_app/internal/auth/models"
+)
+
+// defaultRoles — роли и их разрешения, как их создают миграции postgres.
+// Другие роли добавляются через SetRolePermissions.
+//
+//nolint:gochecknoglobals
+var defaultRoles = map[models.Role][]models.Permission{
+	models.UserRole: {models.PermSearchRead},
+	models.AdminRole: {
+		models.PermAPIKeyManage, models.PermAuditRead, models.PermComicsUpdate,
+		models.PermIndexManage, models.PermSearchRead, models.PermUsersManage,
+	},
+}
+
+// UserRepo хранит пользователей, токены, API-ключи, попытки входа и журнал аудита
+// только в памяти процесса: с хранилищами комиксов json и memory сервер работает
+// без postgres, но после перезапуска все это теряется. Безопасен для
+// конкурентного использования.
+type UserRepo struct {
+	mu *sync.Mutex
+	// последние выданные id: id удаленных пользователей и ключей не переиспользуются.
+	lastUserID    int
+	lastKeyID     int
+	lastAttemptID int64
+	roles         map[models.Role][]models.Permission
+	users         []models.User
+	refresh       map[string]models.RefreshToken
+	revoked       map[string]time.Time
+	apiKeys       []models.APIKey
+	attempts      []models.LoginAttempt
+	audit         []models.AuditEntry
+}
+
+func New() UserRepo {
+	return UserRepo{
+		mu:            &sync.Mutex{},
+		lastUserID:    0,
+		lastKeyID:     0,
+		lastAttemptID: 0,
+		roles:         maps.Clone(defaultRoles),
+		users:         nil,
+		refresh:       make(map[string]models.RefreshToken),
+		revoked:       make(map[string]time.Time),
+		apiKeys:       nil,
+		attempts:      nil,
+		audit:         nil,
+	}
+}
+
+func (ur *UserRepo) GetUser(_ context.Context, username string) (models.User, error) {
+	ur.mu.Lock()
+	defer ur.mu.Unlock()
+
+	i := ur.find(username)
+	if i < 0 {
+		return models.User{}, models.ErrNotFound
+	}
+
+	return ur.users[i], nil
+}
+
+// ListUsers возвращает всех пользователей в порядке создания.
+func (ur *UserRepo) ListUsers(_ context.Context) ([]models.User, error) {
+	ur.mu.Lock()
+	defer ur.mu.Unlock()
+
+	return slices.Clone(ur.users), nil
+}
+
+// CreateUser возвращает models.ErrUserExists, если имя уже занято.
+func (ur *UserRepo) CreateUser(_ context.Context, user models.User) error {
+	ur.mu.Lock()
+	defer ur.mu.Unlock()
+
+	if ur.find(user.Username) >= 0 {
+		return fmt.Errorf("user %s: %w", user.Username, models.ErrUserExists)
+	}
+
+	if _, ok := ur.roles[user.Role]; !ok {
+		return fmt.Errorf("role %s: %w", user.Role, models.ErrInvalidRole)
+	}
+
+	ur.lastUserID++
+	user.ID = ur.lastUserID
+	user.CreatedAt = time.Now()
+	ur.users = append(ur.users, user)
+
+	return nil
+}
+
+func (ur *UserRepo) UpdateRole(_ context.Context, username string, role models.Role) error {
+	ur.mu.Lock()
+	defer ur.mu.Unlock()
+
+	if _, ok := ur.roles[role]; !ok {
+		return fmt.Errorf("user %s: %w", username, models.ErrInvalidRole)
+	}
+
+	return ur.update(username, func(u *models.User) { u.Role = role })
+}
+
+func (ur *UserRepo) SetDisabled(_ context.Context, username string, disabled bool) error {
+	ur.mu.Lock()
+	defer ur.mu.Unlock()
+
+	return ur.update(username, func(u *models.User) { u.Disabled = disabled })
+}
+
+func (ur *UserRepo) UpdatePassword(_ context.Context, username, passwordHash string) error {
+	ur.mu.Lock()
+	defer ur.mu.Unlock()
+
+	return ur.update(username, func(u *models.User) { u.PasswordHash = passwordHash })
+}
+
+// DeleteUser возвращает models.ErrNotFound, если пользователя нет.
+// Вместе с пользователем удаляются его API-ключи, как в postgres.
+func (ur *UserRepo) DeleteUser(_ context.Context, username string) error {
+	ur.mu.Lock()
+	defer ur.mu.Unlock()
+
+	i := ur.find(username)
+	if i < 0 {
+		return fmt.Errorf("user %s: %w", username, models.ErrNotFound)
+	}
+
+	ur.users = slices.Delete(ur.users, i, i+1)
+	ur.apiKeys = slices.DeleteFunc(ur.apiKeys, func(k models.APIKey) bool { return k.Owner == username })
+
+	return nil
+}
+
+// GetPermissions возвращает models.ErrInvalidRole, если роли нет.
+func (ur *UserRepo) GetPermissions(_ context.Context, role models.Role) ([]models.Permission, error) {
+	ur.mu.Lock()
+	defer ur.mu.Unlock()
+
+	perms, ok := ur.roles[role]
+	if !ok {
+		return nil, models.ErrInvalidRole
+	}
+
+	return slices.Clone(perms), nil
+}
+
+// SetRolePermissions задает разрешения роли role, создавая ее, если ее нет.
+// В postgres роли настраиваются в таблице role_permissions.
+func (ur *UserRepo) SetRolePermissions(role models.Role, perms []models.Permission) {
+	ur.mu.Lock()
+	defer ur.mu.Unlock()
+
+	ur.roles[role] = slices.Clone(perms)
+}
+
+// update меняет пользователя username функцией f. Вызывается под ur.mu.
+// Возвращает models.ErrNotFound, если пользователя нет.
+func (ur *UserRepo) update(username string, f func(u *models.User)) error {
+	i := ur.find(username)
+	if i < 0 {
+		return fmt.Errorf("user %s: %w", username, models.ErrNotFound)
+	}
+
+	f(&ur.users[i])
+
+	return nil
+}
+
+func (ur *UserRepo) find(username string) int {
+	return slices.IndexFunc(ur.users, func(u models.User) bool { return u.Username == username })
+}
+
+func (ur *UserRepo) SaveRefreshToken(_ context.Context, t models.RefreshToken) error {
+	ur.mu.Lock()
+	defer ur.mu.Unlock()
+
+	t.CreatedAt = time.Now()
+	ur.refresh[t.Hash] = t
+
+	return nil
+}
+
+// GetRefreshToken возвращает models.ErrNotFound, если токена с таким хэшем нет.
+func (ur *UserRepo) GetRefreshToken(_ context.Context, hash string) (models.RefreshToken, error) {
+	ur.mu.Lock()
+	defer ur.mu.Unlock()
+
+	t, ok := ur.refresh[hash]
+	if !ok {
+		return models.RefreshToken{}, models.ErrNotFound
+	}
+
+	return t, nil
+}
+
+// RotateRefreshToken отзывает токен oldHash и сохраняет next под одной блокировкой.
+// Возвращает models.ErrTokenRevoked, если oldHash уже отозван.
+func (ur *UserRepo) RotateRefreshToken(_ context.Context, oldHash string, next models.RefreshToken) error {
+	ur.mu.Lock()
+	defer ur.mu.Unlock()
+
+	old, ok := ur.refresh[oldHash]
+	if !ok || !old.RevokedAt.IsZero() {
+		return models.ErrTokenRevoked
+	}
+
+	now := time.Now()
+	old.RevokedAt = now
+	ur.refresh[oldHash] = old
+
+	next.CreatedAt = now
+	ur.refresh[next.Hash] = next
+
+	return nil
+}
+
+// RevokeRefreshFamily отзывает все токены цепочки family.
+func (ur *UserRepo) RevokeRefreshFamily(_ context.Context, family string) error {
+	ur.revokeRefresh(func(t models.RefreshToken) bool { return t.Family == family })
+
+	return nil
+}
+
+// RevokeUserRefreshTokens отзывает все refresh-токены пользователя.
+func (ur *UserRepo) RevokeUserRefreshTokens(_ context.Context, username string) error {
+	ur.revokeRefresh(func(t models.RefreshToken) bool { return t.Username == username })
+
+	return nil
+}
+
+// RevokeToken добавляет access-токен jti в список отозванных до expiresAt
+// и удаляет из списка истекшие токены.
+func (ur *UserRepo) RevokeToken(_ context.Context, jti string, expiresAt time.Time) error {
+	ur.mu.Lock()
+	defer ur.mu.Unlock()
+
+	now := time.Now()
+
+	for id, exp := range ur.revoked {
+		if exp.Before(now) {
+			delete(ur.revoked, id)
+		}
+	}
+
+	if _, ok := ur.revoked[jti]; !ok {
+		ur.revoked[jti] = expiresAt
+	}
+
+	return nil
+}
+
+func (ur *UserRepo) IsTokenRevoked(_ context.Context, jti string) (bool, error) {
+	ur.mu.Lock()
+	defer ur.mu.Unlock()
+
+	_, ok := ur.revoked[jti]
+
+	return ok, nil
+}
+
+func (ur *UserRepo) revokeRefresh(match func(t models.RefreshToken) bool) {
+	ur.mu.Lock()
+	defer ur.mu.Unlock()
+
+	now := time.Now()
+
+	for hash, t := range ur.refresh {
+		if match(t) && t.RevokedAt.IsZero() {
+			t.RevokedAt = now
+			ur.refresh[hash] = t
+		}
+	}
+}
+
+// CreateAPIKey сохраняет ключ и возвращает его с id и временем создания.
+func (ur *UserRepo) CreateAPIKey(_ context.Context, k models.APIKey) (models.APIKey, error) {
+	ur.mu.Lock()
+	defer ur.mu.Unlock()
+
+	if ur.find(k.Owner) < 0 {
+		return models.APIKey{}, fmt.Errorf("owner %s: %w", k.Owner, models.ErrNotFound)
+	}
+
+	ur.lastKeyID++
+	k.ID = ur.lastKeyID
+	k.Scopes = slices.Clone(k.Scopes)
+	k.CreatedAt = time.Now()
+	ur.apiKeys = append(ur.apiKeys, k)
+
+	return k, nil
+}
+
+// GetAPIKey возвращает models.ErrNotFound, если ключа с таким префиксом нет.
+func (ur *UserRepo) GetAPIKey(_ context.Context, prefix string) (models.APIKey, error) {
+	ur.mu.Lock()
+	defer ur.mu.Unlock()
+
+	for _, k := range ur.apiKeys {
+		if k.Prefix == prefix {
+			return k, nil
+		}
+	}
+
+	return models.APIKey{}, models.ErrNotFound
+}
+
+// ListAPIKeys возвращает все ключи, включая отозванные, в порядке создания.
+func (ur *UserRepo) ListAPIKeys(_ context.Context) ([]models.APIKey, error) {
+	ur.mu.Lock()
+	defer ur.mu.Unlock()
+
+	return slices.Clone(ur.apiKeys), nil
+}
+
+// RevokeAPIKey возвращает models.ErrNotFound, если ключа нет или он уже отозван.
+func (ur *UserRepo) RevokeAPIKey(_ context.Context, id int) error {
+	ur.mu.Lock()
+	defer ur.mu.Unlock()
+
+	for i, k := range ur.apiKeys {
+		if k.ID == id && k.RevokedAt.IsZero() {
+			ur.apiKeys[i].RevokedAt = time.Now()
+
+			return nil
+		}
+	}
+
+	return fmt.Errorf("api key %d: %w", id, models.ErrNotFound)
+}
+
+func (ur *UserRepo) TouchAPIKey(_ context.Context, id int) error {
+	ur.mu.Lock()
+	defer ur.mu.Unlock()
+
+	for i, k := range ur.apiKeys {
+		if k.ID == id {
+			ur.apiKeys[i].LastUsedAt = time.Now()
+		}
+	}
+
+	return nil
+}
+
+// StartLoginAttempt считает неудачи и записывает попытку a как models.LoginPending
+// под одной блокировкой.
+func (ur *UserRepo) StartLoginAttempt(_ context.Context, a models.LoginAttempt, since time.Time,
+) (int64, models.LoginFailures, error) {
+	ur.mu.Lock()
+	defer ur.mu.Unlock()
+
+	var (
+		f           models.LoginFailures
+		lastSuccess time.Time
+	)
+
+	for _, at := range ur.attempts {
+		if at.Username == a.Username && at.Outcome == models.LoginSuccess {
+			lastSuccess = at.CreatedAt
+		}
+	}
+
+	for _, at := range ur.attempts {
+		failed := at.Outcome == models.LoginFailure || at.Outcome == models.LoginPending
+		if !failed || !at.CreatedAt.After(since) {
+			continue
+		}
+
+		if at.Username == a.Username && at.CreatedAt.After(lastSuccess) {
+			f.User++
+			f.UserLast = at.CreatedAt
+		}
+
+		if at.IP == a.IP {
+			f.IP++
+			f.IPLast = at.CreatedAt
+		}
+	}
+
+	ur.lastAttemptID++
+	a.ID = ur.lastAttemptID
+	a.Outcome = models.LoginPending
+	a.CreatedAt = time.Now()
+	ur.attempts = append(ur.attempts, a)
+
+	return a.ID, f, nil
+}
+
+func (ur *UserRepo) FinishLoginAttempt(_ context.Context, id int64, outcome models.LoginOutcome) error {
+	ur.mu.Lock()
+	defer ur.mu.Unlock()
+
+	for i, a := range ur.attempts {
+		if a.ID == id {
+			ur.attempts[i].Outcome = outcome
+		}
+	}
+
+	return nil
+}
+
+func (ur *UserRepo) DeleteLoginAttempts(_ context.Context, before time.Time) (int64, error) {
+	ur.mu.Lock()
+	defer ur.mu.Unlock()
+
+	n := len(ur.attempts)
+	ur.attempts = slices.DeleteFunc(ur.attempts, func(a models.LoginAttempt) bool { return a.CreatedAt.Before(before) })
+
+	return int64(n - len(ur.attempts)), nil
+}
+
+// LoginAttempts возвращает все сохраненные попытки входа в порядке записи.
+func (ur *UserRepo) LoginAttempts() []models.LoginAttempt {
+	ur.mu.Lock()
+	defer ur.mu.Unlock()
+
+	return slices.Clone(ur.attempts)
+}
+
+// AgeLoginAttempts сдвигает время сохраненных попыток входа на d в прошлое, как будто
+// с их записи прошло d. Нужен тестам задержек входа, которые иначе пришлось бы ждать.
+func (ur *UserRepo) AgeLoginAttempts(d time.Duration) {
+	ur.mu.Lock()
+	defer ur.mu.Unlock()
+
+	for i := range ur.attempts {
+		ur.attempts[i].CreatedAt = ur.attempts[i].CreatedAt.Add(-d)
+	}
+}
+
+// AppendAudit добавляет запись в журнал аудита.
+func (ur *UserRepo) AppendAudit(_ context.Context, e models.AuditEntry) error {
+	ur.mu.Lock()
+	defer ur.mu.Unlock()
+
+	e.ID = int64(len(ur.audit) + 1)
+	e.CreatedAt = time.Now()
+	ur.audit = append(ur.audit, e)
+
+	return nil
+}
+
+// ListAudit возвращает записи журнала по фильтру f, новые первыми.
+func (ur *UserRepo) ListAudit(_ context.Context, f models.AuditFilter) ([]models.AuditEntry, error) {
+	ur.mu.Lock()
+	defer ur.mu.Unlock()
+
+	entries := make([]models.AuditEntry, 0)
+
+	for i := len(ur.audit) - 1; i >= 0; i-- {
+		e := ur.audit[i]
+
+		if (f.From.IsZero() || !e.CreatedAt.Before(f.From)) && (f.To.IsZero() || e.CreatedAt.Before(f.To)) &&
+			(f.Actor == "" || e.Actor == f.Actor) && (f.Action == "" || e.Action == f.Action) {
+			entries = append(entries, e)
+		}
+	}
+
+	entries = entries[min(f.Offset, len(entries)):]
+
+	if f.Limit > 0 {
+		entries = entries[:min(f.Limit, len(entries))]
+	}
+
+	return entries, nil
+}
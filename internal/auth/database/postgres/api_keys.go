@@ -0,0 +1,181 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/Leopold1975/yadro_app/internal/auth/models"
+	"github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v5"
+)
+
+// lastUsedPrecision — как часто обновляется last_used_at: записывать его
+// на каждый запрос ключа незачем.
+const lastUsedPrecision = "1 minute"
+
+//nolint:gochecknoglobals
+var apiKeyColumns = []string{
+	"id", "prefix", "key_hash", "name", "owner", "scopes",
+	"expires_at", "created_at", "last_used_at", "revoked_at",
+}
+
+// CreateAPIKey сохраняет ключ и возвращает его с id и временем создания.
+func (ur *UserRepo) CreateAPIKey(ctx context.Context, k models.APIKey) (models.APIKey, error) {
+	pb := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar)
+
+	var expiresAt *time.Time
+	if !k.ExpiresAt.IsZero() {
+		expiresAt = &k.ExpiresAt
+	}
+
+	scopes := make([]string, 0, len(k.Scopes))
+	for _, s := range k.Scopes {
+		scopes = append(scopes, string(s))
+	}
+
+	query, args, err := pb.Insert("api_keys").
+		Columns("prefix", "key_hash", "name", "owner", "scopes", "expires_at").
+		Values(k.Prefix, k.Hash, k.Name, k.Owner, scopes, expiresAt).
+		Suffix("RETURNING " + strings.Join(apiKeyColumns, ", ")).ToSql()
+	if err != nil {
+		return models.APIKey{}, fmt.Errorf("to sql error %w", err)
+	}
+
+	created, err := scanAPIKey(ur.db.QueryRow(ctx, query, args...))
+	if err != nil {
+		return models.APIKey{}, fmt.Errorf("scan error %w", err)
+	}
+
+	return created, nil
+}
+
+// GetAPIKey возвращает models.ErrNotFound, если ключа с таким префиксом нет.
+func (ur *UserRepo) GetAPIKey(ctx context.Context, prefix string) (models.APIKey, error) {
+	pb := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar)
+
+	query, args, err := pb.Select(apiKeyColumns...).From("api_keys").
+		Where(squirrel.Eq{"prefix": prefix}).ToSql()
+	if err != nil {
+		return models.APIKey{}, fmt.Errorf("to sql error %w", err)
+	}
+
+	k, err := scanAPIKey(ur.db.QueryRow(ctx, query, args...))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.APIKey{}, models.ErrNotFound
+		}
+
+		return models.APIKey{}, fmt.Errorf("scan error %w", err)
+	}
+
+	return k, nil
+}
+
+// ListAPIKeys возвращает все ключи, включая отозванные, в порядке создания.
+func (ur *UserRepo) ListAPIKeys(ctx context.Context) ([]models.APIKey, error) {
+	pb := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar)
+
+	query, args, err := pb.Select(apiKeyColumns...).From("api_keys").OrderBy("id").ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("to sql error %w", err)
+	}
+
+	rows, err := ur.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query error %w", err)
+	}
+
+	defer rows.Close()
+
+	keys := make([]models.APIKey, 0)
+
+	for rows.Next() {
+		k, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan error %w", err)
+		}
+
+		keys = append(keys, k)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error %w", err)
+	}
+
+	return keys, nil
+}
+
+// RevokeAPIKey возвращает models.ErrNotFound, если ключа нет или он уже отозван.
+func (ur *UserRepo) RevokeAPIKey(ctx context.Context, id int) error {
+	pb := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar)
+
+	query, args, err := pb.Update("api_keys").Set("revoked_at", squirrel.Expr("now()")).
+		Where(squirrel.Eq{"id": id, "revoked_at": nil}).ToSql()
+	if err != nil {
+		return fmt.Errorf("to sql error %w", err)
+	}
+
+	tag, err := ur.db.Exec(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("exec error %w", err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("api key %d: %w", id, models.ErrNotFound)
+	}
+
+	return nil
+}
+
+// TouchAPIKey обновляет время последнего использования ключа с точностью lastUsedPrecision.
+func (ur *UserRepo) TouchAPIKey(ctx context.Context, id int) error {
+	pb := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar)
+
+	query, args, err := pb.Update("api_keys").Set("last_used_at", squirrel.Expr("now()")).
+		Where(squirrel.Eq{"id": id}).
+		Where(squirrel.Or{
+			squirrel.Eq{"last_used_at": nil},
+			squirrel.Expr("last_used_at < now() - interval '" + lastUsedPrecision + "'"),
+		}).ToSql()
+	if err != nil {
+		return fmt.Errorf("to sql error %w", err)
+	}
+
+	if _, err := ur.db.Exec(ctx, query, args...); err != nil {
+		return fmt.Errorf("exec error %w", err)
+	}
+
+	return nil
+}
+
+func scanAPIKey(row pgx.Row) (models.APIKey, error) {
+	var (
+		k                                models.APIKey
+		scopes                           []string
+		expiresAt, lastUsedAt, revokedAt *time.Time
+	)
+
+	err := row.Scan(&k.ID, &k.Prefix, &k.Hash, &k.Name, &k.Owner, &scopes,
+		&expiresAt, &k.CreatedAt, &lastUsedAt, &revokedAt)
+	if err != nil {
+		return models.APIKey{}, err //nolint:wrapcheck
+	}
+
+	for _, s := range scopes {
+		k.Scopes = append(k.Scopes, models.Permission(s))
+	}
+
+	for _, t := range []struct {
+		src *time.Time
+		dst *time.Time
+	}{{expiresAt, &k.ExpiresAt}, {lastUsedAt, &k.LastUsedAt}, {revokedAt, &k.RevokedAt}} {
+		if t.src != nil {
+			*t.dst = *t.src
+		}
+	}
+
+	return k, nil
+}
@@ -0,0 +1,117 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/Leopold1975/yadro_app/internal/auth/models"
+	"github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v5"
+)
+
+//nolint:gochecknoglobals
+var auditColumns = []string{
+	"id", "created_at", "actor", "api_key_id", "action", "target", "details", "outcome", "client_ip",
+}
+
+// AppendAudit добавляет запись в журнал аудита. Время записи ставит база.
+func (ur *UserRepo) AppendAudit(ctx context.Context, e models.AuditEntry) error {
+	pb := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar)
+
+	var apiKeyID *int
+	if e.APIKeyID != 0 {
+		apiKeyID = &e.APIKeyID
+	}
+
+	query, args, err := pb.Insert("audit_log").
+		Columns("actor", "api_key_id", "action", "target", "details", "outcome", "client_ip").
+		Values(e.Actor, apiKeyID, string(e.Action), e.Target, e.Details, string(e.Outcome), e.ClientIP).ToSql()
+	if err != nil {
+		return fmt.Errorf("to sql error %w", err)
+	}
+
+	if _, err := ur.db.Exec(ctx, query, args...); err != nil {
+		return fmt.Errorf("exec error %w", err)
+	}
+
+	return nil
+}
+
+// ListAudit возвращает записи журнала по фильтру f, новые первыми.
+func (ur *UserRepo) ListAudit(ctx context.Context, f models.AuditFilter) ([]models.AuditEntry, error) {
+	pb := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar)
+
+	q := pb.Select(auditColumns...).From("audit_log").OrderBy("created_at DESC", "id DESC")
+
+	if !f.From.IsZero() {
+		q = q.Where(squirrel.GtOrEq{"created_at": f.From})
+	}
+
+	if !f.To.IsZero() {
+		q = q.Where(squirrel.Lt{"created_at": f.To})
+	}
+
+	if f.Actor != "" {
+		q = q.Where(squirrel.Eq{"actor": f.Actor})
+	}
+
+	if f.Action != "" {
+		q = q.Where(squirrel.Eq{"action": string(f.Action)})
+	}
+
+	if f.Limit > 0 {
+		q = q.Limit(uint64(f.Limit))
+	}
+
+	if f.Offset > 0 {
+		q = q.Offset(uint64(f.Offset))
+	}
+
+	query, args, err := q.ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("to sql error %w", err)
+	}
+
+	rows, err := ur.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query error %w", err)
+	}
+
+	defer rows.Close()
+
+	entries := make([]models.AuditEntry, 0)
+
+	for rows.Next() {
+		e, err := scanAudit(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan error %w", err)
+		}
+
+		entries = append(entries, e)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error %w", err)
+	}
+
+	return entries, nil
+}
+
+func scanAudit(row pgx.Row) (models.AuditEntry, error) {
+	var (
+		e        models.AuditEntry
+		apiKeyID *int
+	)
+
+	err := row.Scan(&e.ID, &e.CreatedAt, &e.Actor, &apiKeyID, &e.Action, &e.Target, &e.Details,
+		&e.Outcome, &e.ClientIP)
+	if err != nil {
+		return models.AuditEntry{}, err //nolint:wrapcheck
+	}
+
+	if apiKeyID != nil {
+		e.APIKeyID = *apiKeyID
+	}
+
+	return e, nil
+}
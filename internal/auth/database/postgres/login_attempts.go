@@ -0,0 +1,132 @@
+package postgres
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/Leopold1975/yadro_app/internal/auth/models"
+	"github.com/Leopold1975/yadro_app/pkg/pgtools"
+	"github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v5"
+)
+
+// Пространства advisory-блокировок попыток входа: первый ключ pg_advisory_xact_lock.
+const (
+	usernameLockSpace = 1
+	ipLockSpace       = 2
+)
+
+// StartLoginAttempt под advisory-блокировками имени и адреса считает неудачи
+// и записывает попытку a как models.LoginPending. Блокировки берутся всегда
+// в порядке имя, адрес, поэтому взаимных блокировок нет.
+func (ur *UserRepo) StartLoginAttempt(ctx context.Context, a models.LoginAttempt, since time.Time,
+) (_ int64, _ models.LoginFailures, err error) { //nolint:nonamedreturns
+	tx, err := ur.db.Begin(ctx)
+	if err != nil {
+		return 0, models.LoginFailures{}, fmt.Errorf("begin tx error %w", err)
+	}
+
+	defer func() {
+		err = pgtools.CommitOrRollback(ctx, tx, err, "start login attempt")
+	}()
+
+	_, err = tx.Exec(ctx, `SELECT pg_advisory_xact_lock($1, hashtext($2)), pg_advisory_xact_lock($3, hashtext($4))`,
+		usernameLockSpace, a.Username, ipLockSpace, a.IP)
+	if err != nil {
+		return 0, models.LoginFailures{}, fmt.Errorf("lock error %w", err)
+	}
+
+	var f models.LoginFailures
+
+	err = countFailures(ctx, tx, &f.User, &f.UserLast, since, squirrel.And{
+		squirrel.Eq{"username": a.Username},
+		squirrel.Expr(`created_at > COALESCE((SELECT max(created_at) FROM login_attempts
+			WHERE username = ? AND outcome = ?), '-infinity')`, a.Username, string(models.LoginSuccess)),
+	})
+	if err != nil {
+		return 0, models.LoginFailures{}, err
+	}
+
+	err = countFailures(ctx, tx, &f.IP, &f.IPLast, since, squirrel.Eq{"ip": a.IP})
+	if err != nil {
+		return 0, models.LoginFailures{}, err
+	}
+
+	pb := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar)
+
+	// now() — время начала транзакции, а она могла долго ждать блокировку.
+	query, args, err := pb.Insert("login_attempts").Columns("username", "ip", "outcome", "created_at").
+		Values(a.Username, a.IP, string(models.LoginPending), squirrel.Expr("clock_timestamp()")).
+		Suffix("RETURNING id").ToSql()
+	if err != nil {
+		return 0, models.LoginFailures{}, fmt.Errorf("to sql error %w", err)
+	}
+
+	var id int64
+
+	if err := tx.QueryRow(ctx, query, args...).Scan(&id); err != nil {
+		return 0, models.LoginFailures{}, fmt.Errorf("scan error %w", err)
+	}
+
+	return id, f, nil
+}
+
+func (ur *UserRepo) FinishLoginAttempt(ctx context.Context, id int64, outcome models.LoginOutcome) error {
+	pb := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar)
+
+	query, args, err := pb.Update("login_attempts").Set("outcome", string(outcome)).
+		Where(squirrel.Eq{"id": id}).ToSql()
+	if err != nil {
+		return fmt.Errorf("to sql error %w", err)
+	}
+
+	if _, err := ur.db.Exec(ctx, query, args...); err != nil {
+		return fmt.Errorf("exec error %w", err)
+	}
+
+	return nil
+}
+
+func (ur *UserRepo) DeleteLoginAttempts(ctx context.Context, before time.Time) (int64, error) {
+	pb := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar)
+
+	query, args, err := pb.Delete("login_attempts").Where(squirrel.Lt{"created_at": before}).ToSql()
+	if err != nil {
+		return 0, fmt.Errorf("to sql error %w", err)
+	}
+
+	tag, err := ur.db.Exec(ctx, query, args...)
+	if err != nil {
+		return 0, fmt.Errorf("exec error %w", err)
+	}
+
+	return tag.RowsAffected(), nil
+}
+
+// countFailures считает неудачные и незавершенные попытки после since, подходящие под where.
+func countFailures(ctx context.Context, tx pgx.Tx, count *int, last *time.Time, since time.Time,
+	where squirrel.Sqlizer,
+) error {
+	pb := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar)
+
+	query, args, err := pb.Select("count(*)", "max(created_at)").From("login_attempts").
+		Where(squirrel.Eq{"outcome": []string{string(models.LoginFailure), string(models.LoginPending)}}).
+		Where(squirrel.Gt{"created_at": since}).
+		Where(where).ToSql()
+	if err != nil {
+		return fmt.Errorf("to sql error %w", err)
+	}
+
+	var lastAt *time.Time
+
+	if err := tx.QueryRow(ctx, query, args...).Scan(count, &lastAt); err != nil {
+		return fmt.Errorf("scan error %w", err)
+	}
+
+	if lastAt != nil {
+		*last = *lastAt
+	}
+
+	return nil
+}
@@ -10,9 +10,16 @@ import (
 	"github.com/Leopold1975/yadro_app/pkg/pgtools"
 	"github.com/Masterminds/squirrel"
 	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// Коды ошибок Postgres.
+const (
+	uniqueViolation     = "23505"
+	foreignKeyViolation = "23503" // роли пользователя нет в таблице roles.
+)
+
 type UserRepo struct {
 	db *pgxpool.Pool
 }
@@ -38,30 +45,69 @@ func New(ctx context.Context, cfg config.DB) (UserRepo, error) {
 	}, nil
 }
 
+// userColumns — колонки users в порядке полей, которые заполняет scanUser.
+//
+//nolint:gochecknoglobals
+var userColumns = []string{"id", "username", "passwordHash", "role", "disabled", "created_at"}
+
 func (ur *UserRepo) GetUser(ctx context.Context, username string) (models.User, error) {
 	pb := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar)
 
-	query, args, err := pb.Select("id", "username", "passwordHash", "role").
+	query, args, err := pb.Select(userColumns...).
 		From("users").
 		Where(squirrel.Eq{"username": username}).ToSql()
 	if err != nil {
 		return models.User{}, fmt.Errorf("to sql error %w", err)
 	}
 
-	row := ur.db.QueryRow(ctx, query, args...)
-
-	var u models.User
-
-	if err := row.Scan(&u.ID, &u.Username, &u.PasswordHash, &u.Role); err != nil {
+	u, err := scanUser(ur.db.QueryRow(ctx, query, args...))
+	if err != nil {
 		if errors.Is(err, pgx.ErrNoRows) {
 			return models.User{}, models.ErrNotFound
 		}
+
+		return models.User{}, fmt.Errorf("scan error %w", err)
 	}
 
 	return u, nil
 }
 
-func (ur *UserRepo) CreateUser(ctx context.Context, user models.User) error {
+// ListUsers возвращает всех пользователей в порядке создания.
+func (ur *UserRepo) ListUsers(ctx context.Context) ([]models.User, error) {
+	pb := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar)
+
+	query, args, err := pb.Select(userColumns...).From("users").OrderBy("id").ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("to sql error %w", err)
+	}
+
+	rows, err := ur.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query error %w", err)
+	}
+
+	defer rows.Close()
+
+	users := make([]models.User, 0)
+
+	for rows.Next() {
+		u, err := scanUser(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan error %w", err)
+		}
+
+		users = append(users, u)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error %w", err)
+	}
+
+	return users, nil
+}
+
+// CreateUser возвращает models.ErrUserExists, если имя уже занято.
+func (ur *UserRepo) CreateUser(ctx context.Context, user models.User) (err error) {
 	tx, err := ur.db.Begin(ctx)
 	if err != nil {
 		return fmt.Errorf("begin tx error %w", err)
@@ -73,16 +119,135 @@ func (ur *UserRepo) CreateUser(ctx context.Context, user models.User) error {
 
 	pb := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar)
 
-	query, args, err := pb.Insert("users").Columns("username", "passwordHash", "role").
-		Values(user.Username, user.PasswordHash, user.Role).ToSql()
+	query, args, err := pb.Insert("users").Columns("username", "passwordHash", "role", "disabled").
+		Values(user.Username, user.PasswordHash, user.Role, user.Disabled).ToSql()
 	if err != nil {
 		return fmt.Errorf("to sql error %w", err)
 	}
 
 	_, err = tx.Exec(ctx, query, args...)
 	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == uniqueViolation {
+			return fmt.Errorf("user %s: %w", user.Username, models.ErrUserExists)
+		}
+
+		if errors.As(err, &pgErr) && pgErr.Code == foreignKeyViolation {
+			return fmt.Errorf("role %s: %w", user.Role, models.ErrInvalidRole)
+		}
+
 		return fmt.Errorf("exec error %w", err)
 	}
 
 	return nil
 }
+
+func (ur *UserRepo) UpdateRole(ctx context.Context, username string, role models.Role) error {
+	return ur.update(ctx, username, squirrel.Eq{"role": role})
+}
+
+func (ur *UserRepo) SetDisabled(ctx context.Context, username string, disabled bool) error {
+	return ur.update(ctx, username, squirrel.Eq{"disabled": disabled})
+}
+
+func (ur *UserRepo) UpdatePassword(ctx context.Context, username, passwordHash string) error {
+	return ur.update(ctx, username, squirrel.Eq{"passwordHash": passwordHash})
+}
+
+// DeleteUser возвращает models.ErrNotFound, если пользователя нет.
+func (ur *UserRepo) DeleteUser(ctx context.Context, username string) error {
+	pb := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar)
+
+	query, args, err := pb.Delete("users").Where(squirrel.Eq{"username": username}).ToSql()
+	if err != nil {
+		return fmt.Errorf("to sql error %w", err)
+	}
+
+	return ur.execOne(ctx, username, query, args)
+}
+
+// update меняет колонки set пользователя username.
+// Возвращает models.ErrNotFound, если пользователя нет.
+func (ur *UserRepo) update(ctx context.Context, username string, set squirrel.Eq) error {
+	pb := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar)
+
+	query, args, err := pb.Update("users").SetMap(set).Where(squirrel.Eq{"username": username}).ToSql()
+	if err != nil {
+		return fmt.Errorf("to sql error %w", err)
+	}
+
+	return ur.execOne(ctx, username, query, args)
+}
+
+func (ur *UserRepo) execOne(ctx context.Context, username, query string, args []any) error {
+	tag, err := ur.db.Exec(ctx, query, args...)
+	if err != nil {
+		var pgErr *pgconn.PgError
+		if errors.As(err, &pgErr) && pgErr.Code == foreignKeyViolation {
+			return fmt.Errorf("user %s: %w", username, models.ErrInvalidRole)
+		}
+
+		return fmt.Errorf("exec error %w", err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return fmt.Errorf("user %s: %w", username, models.ErrNotFound)
+	}
+
+	return nil
+}
+
+func scanUser(row pgx.Row) (models.User, error) {
+	var u models.User
+
+	err := row.Scan(&u.ID, &u.Username, &u.PasswordHash, &u.Role, &u.Disabled, &u.CreatedAt)
+
+	return u, err //nolint:wrapcheck
+}
+
+// GetPermissions возвращает models.ErrInvalidRole, если роли нет в таблице roles.
+func (ur *UserRepo) GetPermissions(ctx context.Context, role models.Role) ([]models.Permission, error) {
+	pb := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar)
+
+	query, args, err := pb.Select("rp.permission").From("roles r").
+		LeftJoin("role_permissions rp ON rp.role = r.name").
+		Where(squirrel.Eq{"r.name": role}).OrderBy("rp.permission").ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("to sql error %w", err)
+	}
+
+	rows, err := ur.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query error %w", err)
+	}
+
+	defer rows.Close()
+
+	found := false
+	perms := make([]models.Permission, 0)
+
+	for rows.Next() {
+		found = true
+
+		// NULL, если у роли нет разрешений.
+		var p *string
+
+		if err := rows.Scan(&p); err != nil {
+			return nil, fmt.Errorf("scan error %w", err)
+		}
+
+		if p != nil {
+			perms = append(perms, models.Permission(*p))
+		}
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error %w", err)
+	}
+
+	if !found {
+		return nil, models.ErrInvalidRole
+	}
+
+	return perms, nil
+}
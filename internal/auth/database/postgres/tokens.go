@@ -0,0 +1,196 @@
+package postgres
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Leopold1975/yadro_app/internal/auth/models"
+	"github.com/Leopold1975/yadro_app/pkg/pgtools"
+	"github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v5"
+)
+
+func (ur *UserRepo) SaveRefreshToken(ctx context.Context, t models.RefreshToken) error {
+	query, args, err := insertRefreshToken(t)
+	if err != nil {
+		return err
+	}
+
+	if _, err := ur.db.Exec(ctx, query, args...); err != nil {
+		return fmt.Errorf("exec error %w", err)
+	}
+
+	return nil
+}
+
+// GetRefreshToken возвращает models.ErrNotFound, если токена с таким хэшем нет.
+func (ur *UserRepo) GetRefreshToken(ctx context.Context, hash string) (models.RefreshToken, error) {
+	pb := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar)
+
+	query, args, err := pb.Select("token_hash", "username", "family", "expires_at", "revoked_at", "created_at").
+		From("refresh_tokens").
+		Where(squirrel.Eq{"token_hash": hash}).ToSql()
+	if err != nil {
+		return models.RefreshToken{}, fmt.Errorf("to sql error %w", err)
+	}
+
+	var (
+		t         models.RefreshToken
+		revokedAt *time.Time
+	)
+
+	err = ur.db.QueryRow(ctx, query, args...).
+		Scan(&t.Hash, &t.Username, &t.Family, &t.ExpiresAt, &revokedAt, &t.CreatedAt)
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.RefreshToken{}, models.ErrNotFound
+		}
+
+		return models.RefreshToken{}, fmt.Errorf("scan error %w", err)
+	}
+
+	if revokedAt != nil {
+		t.RevokedAt = *revokedAt
+	}
+
+	return t, nil
+}
+
+// RotateRefreshToken отзывает токен oldHash и сохраняет next одной транзакцией.
+// Возвращает models.ErrTokenRevoked, если oldHash уже отозван, например
+// параллельным обновлением тем же токеном.
+func (ur *UserRepo) RotateRefreshToken(ctx context.Context, oldHash string, next models.RefreshToken) (err error) {
+	tx, err := ur.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin tx error %w", err)
+	}
+
+	defer func() {
+		err = pgtools.CommitOrRollback(ctx, tx, err, "rotate refresh token")
+	}()
+
+	pb := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar)
+
+	query, args, err := pb.Update("refresh_tokens").Set("revoked_at", squirrel.Expr("now()")).
+		Where(squirrel.Eq{"token_hash": oldHash, "revoked_at": nil}).ToSql()
+	if err != nil {
+		return fmt.Errorf("to sql error %w", err)
+	}
+
+	tag, err := tx.Exec(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("exec error %w", err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return models.ErrTokenRevoked
+	}
+
+	query, args, err = insertRefreshToken(next)
+	if err != nil {
+		return err
+	}
+
+	if _, err = tx.Exec(ctx, query, args...); err != nil {
+		return fmt.Errorf("exec error %w", err)
+	}
+
+	return nil
+}
+
+// RevokeRefreshFamily отзывает все токены цепочки family.
+func (ur *UserRepo) RevokeRefreshFamily(ctx context.Context, family string) error {
+	return ur.revokeRefresh(ctx, squirrel.Eq{"family": family})
+}
+
+// RevokeUserRefreshTokens отзывает все refresh-токены пользователя.
+func (ur *UserRepo) RevokeUserRefreshTokens(ctx context.Context, username string) error {
+	return ur.revokeRefresh(ctx, squirrel.Eq{"username": username})
+}
+
+// RevokeToken добавляет access-токен jti в список отозванных до expiresAt
+// и удаляет из списка истекшие токены.
+func (ur *UserRepo) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) (err error) {
+	tx, err := ur.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin tx error %w", err)
+	}
+
+	defer func() {
+		err = pgtools.CommitOrRollback(ctx, tx, err, "revoke token")
+	}()
+
+	pb := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar)
+
+	query, args, err := pb.Delete("revoked_tokens").Where("expires_at < now()").ToSql()
+	if err != nil {
+		return fmt.Errorf("to sql error %w", err)
+	}
+
+	if _, err = tx.Exec(ctx, query, args...); err != nil {
+		return fmt.Errorf("exec error %w", err)
+	}
+
+	query, args, err = pb.Insert("revoked_tokens").Columns("jti", "expires_at").
+		Values(jti, expiresAt).Suffix("ON CONFLICT (jti) DO NOTHING").ToSql()
+	if err != nil {
+		return fmt.Errorf("to sql error %w", err)
+	}
+
+	if _, err = tx.Exec(ctx, query, args...); err != nil {
+		return fmt.Errorf("exec error %w", err)
+	}
+
+	return nil
+}
+
+func (ur *UserRepo) IsTokenRevoked(ctx context.Context, jti string) (bool, error) {
+	pb := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar)
+
+	query, args, err := pb.Select("1").Prefix("SELECT EXISTS (").
+		From("revoked_tokens").Where(squirrel.Eq{"jti": jti}).Suffix(")").ToSql()
+	if err != nil {
+		return false, fmt.Errorf("to sql error %w", err)
+	}
+
+	var revoked bool
+
+	if err := ur.db.QueryRow(ctx, query, args...).Scan(&revoked); err != nil {
+		return false, fmt.Errorf("scan error %w", err)
+	}
+
+	return revoked, nil
+}
+
+func (ur *UserRepo) revokeRefresh(ctx context.Context, where squirrel.Eq) error {
+	pb := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar)
+
+	where["revoked_at"] = nil
+
+	query, args, err := pb.Update("refresh_tokens").Set("revoked_at", squirrel.Expr("now()")).
+		Where(where).ToSql()
+	if err != nil {
+		return fmt.Errorf("to sql error %w", err)
+	}
+
+	if _, err := ur.db.Exec(ctx, query, args...); err != nil {
+		return fmt.Errorf("exec error %w", err)
+	}
+
+	return nil
+}
+
+func insertRefreshToken(t models.RefreshToken) (string, []any, error) {
+	pb := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar)
+
+	query, args, err := pb.Insert("refresh_tokens").
+		Columns("token_hash", "username", "family", "expires_at").
+		Values(t.Hash, t.Username, t.Family, t.ExpiresAt).ToSql()
+	if err != nil {
+		return "", nil, fmt.Errorf("to sql error %w", err)
+	}
+
+	return query, args, nil
+}
@@ -0,0 +1,85 @@
+package models
+
+import (
+	"context"
+	"time"
+)
+
+// SystemActor — автор действий вне HTTP-запросов, например команды bootstrap-admin.
+// Такого имени пользователя быть не может.
+const SystemActor = "@system"
+
+// AuditAction — вид действия в журнале аудита.
+type AuditAction string
+
+const (
+	AuditLogin        AuditAction = "login"
+	AuditLogout       AuditAction = "logout"
+	AuditUserCreate   AuditAction = "user.create"
+	AuditUserSetRole  AuditAction = "user.set_role"
+	AuditUserDisable  AuditAction = "user.set_disabled"
+	AuditUserDelete   AuditAction = "user.delete"
+	AuditUserPassword AuditAction = "user.change_password"
+	AuditAPIKeyIssue  AuditAction = "apikey.issue"
+	AuditAPIKeyRevoke AuditAction = "apikey.revoke"
+	AuditComicsUpdate AuditAction = "comics.update"
+	AuditIndexReindex AuditAction = "index.reindex"
+	AuditIndexRepair  AuditAction = "index.repair"
+)
+
+// AuditOutcome — результат действия.
+type AuditOutcome string
+
+const (
+	AuditSuccess AuditOutcome = "success"
+	AuditFailure AuditOutcome = "failure"
+)
+
+// AuditEntry — запись журнала аудита. Actor — имя пользователя, выполнившего действие;
+// APIKeyID не нулевой, если он вошел по API-ключу. Target — объект действия,
+// Details — что изменилось.
+type AuditEntry struct {
+	ID        int64
+	CreatedAt time.Time
+	Actor     string
+	APIKeyID  int
+	Action    AuditAction
+	Target    string
+	Details   string
+	Outcome   AuditOutcome
+	ClientIP  string
+}
+
+// AuditFilter — условия выборки из журнала: записи в полуинтервале [From, To)
+// от Actor, новые первыми. Нулевые поля не ограничивают выборку.
+type AuditFilter struct {
+	From   time.Time
+	To     time.Time
+	Actor  string
+	Action AuditAction
+	Limit  int
+	Offset int
+}
+
+// RequestInfo — сведения о запросе для журналов. Middleware журнала запросов кладет
+// в контекст указатель на RequestInfo с адресом клиента, а middleware аутентификации
+// заполняет Principal, чтобы пользователь был виден и снаружи, в журнале запросов.
+type RequestInfo struct {
+	ClientIP  string
+	Principal Principal
+}
+
+type requestInfoKey struct{}
+
+// WithRequestInfo возвращает контекст со сведениями о запросе.
+func WithRequestInfo(ctx context.Context, info *RequestInfo) context.Context {
+	return context.WithValue(ctx, requestInfoKey{}, info)
+}
+
+// RequestInfoFrom возвращает сведения о запросе или nil, если их нет в контексте,
+// например вне HTTP-запроса.
+func RequestInfoFrom(ctx context.Context) *RequestInfo {
+	info, _ := ctx.Value(requestInfoKey{}).(*RequestInfo)
+
+	return info
+}
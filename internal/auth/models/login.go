@@ -0,0 +1,52 @@
+package models
+
+import (
+	"fmt"
+	"time"
+)
+
+// LoginOutcome — результат попытки входа.
+type LoginOutcome string
+
+const (
+	LoginSuccess LoginOutcome = "success"
+	LoginFailure LoginOutcome = "failure"
+	// LoginLocked — попытка отклонена без проверки пароля из-за блокировки.
+	LoginLocked LoginOutcome = "locked"
+	// LoginPending — пароль еще проверяется. Такая попытка считается неудачной,
+	// пока не завершится: и для параллельных попыток, и если процесс упал.
+	LoginPending LoginOutcome = "pending"
+)
+
+// LoginAttempt — запись о попытке входа. Username — имя из запроса,
+// пользователя с таким именем может не быть.
+type LoginAttempt struct {
+	ID        int64
+	Username  string
+	IP        string
+	Outcome   LoginOutcome
+	CreatedAt time.Time
+}
+
+// LoginFailures — неудачные и незавершенные попытки входа с начала окна: для имени
+// пользователя после его последнего успешного входа и для IP-адреса.
+// Last* — время последней из них.
+type LoginFailures struct {
+	User     int
+	UserLast time.Time
+	IP       int
+	IPLast   time.Time
+}
+
+// LockedError — вход заблокирован еще на RetryAfter. errors.Is(err, ErrLoginLocked) истинно.
+type LockedError struct {
+	RetryAfter time.Duration
+}
+
+func (e LockedError) Error() string {
+	return fmt.Sprintf("%s, retry after %s", ErrLoginLocked, e.RetryAfter.Round(time.Second))
+}
+
+func (e LockedError) Is(target error) bool {
+	return target == ErrLoginLocked //nolint:errorlint,goerr113
+}
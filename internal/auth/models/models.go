@@ -1,23 +1,79 @@
 package models
 
-import "errors"
+import (
+	"errors"
+	"time"
+)
 
+// Роли, которые создает миграция. Другие роли можно добавить в таблицу roles.
 const (
 	UserRole  Role = "user"
 	AdminRole Role = "admin"
-	RoleKey   Role = "role"
 )
 
 type User struct {
-	ID           int    `json:"id"`
-	Username     string `json:"username"`
-	PasswordHash string `json:"passwordHash"`
-	Role         Role   `json:"role"`
+	ID           int       `json:"id"`
+	Username     string    `json:"username"`
+	PasswordHash string    `json:"passwordHash"`
+	Role         Role      `json:"role"`
+	Disabled     bool      `json:"disabled"`
+	CreatedAt    time.Time `json:"createdAt"`
 }
 
 type Role string
 
+// TokenPair — токены, выдаваемые при входе и обновлении. ExpiresIn — время жизни AccessToken.
+type TokenPair struct {
+	AccessToken  string
+	RefreshToken string
+	ExpiresIn    time.Duration
+}
+
+// RefreshToken — сохраненный refresh-токен. Сам токен не хранится, только его хэш.
+// RevokedAt не нулевой, если токен отозван или заменен при ротации.
+type RefreshToken struct {
+	Hash      string
+	Username  string
+	Family    string
+	ExpiresAt time.Time
+	RevokedAt time.Time
+	CreatedAt time.Time
+}
+
+// APIKey — ключ доступа для сервисов. Ключ действует от имени Owner, но только
+// в пределах Scopes: разрешения, которых нет у роли владельца, ключ не дает.
+// Нулевые ExpiresAt, LastUsedAt и RevokedAt означают бессрочный,
+// неиспользованный и неотозванный ключ.
+type APIKey struct {
+	ID         int
+	Prefix     string
+	Hash       string
+	Name       string
+	Owner      string
+	Scopes     []Permission
+	ExpiresAt  time.Time
+	CreatedAt  time.Time
+	LastUsedAt time.Time
+	RevokedAt  time.Time
+}
+
 var (
-	ErrNotFound      = errors.New("user not found")
-	ErrWrongPassword = errors.New("wrong password")
+	ErrNotFound        = errors.New("user not found")
+	ErrWrongPassword   = errors.New("wrong password")
+	ErrUserExists      = errors.New("user already exists")
+	ErrUserDisabled    = errors.New("user is disabled")
+	ErrInvalidRole     = errors.New("invalid role")
+	ErrInvalidUsername = errors.New("invalid username")
+	ErrWeakPassword    = errors.New("password does not satisfy policy")
+	ErrLastAdmin       = errors.New("can't remove the last active user with users:manage")
+	ErrTokenRevoked    = errors.New("token revoked")
+	ErrInvalidRefresh  = errors.New("invalid refresh token")
+	ErrRefreshReused   = errors.New("refresh token reused, session revoked")
+	ErrInvalidAPIKey   = errors.New("invalid api key")
+	ErrInvalidScope    = errors.New("invalid api key scope")
+	ErrForbidden       = errors.New("permission denied")
+	// ErrInvalidCredentials возвращается при входе и для неизвестного пользователя,
+	// и для неверного пароля, чтобы по ответу нельзя было перебрать имена.
+	ErrInvalidCredentials = errors.New("invalid username or password")
+	ErrLoginLocked        = errors.New("too many failed login attempts")
 )
@@ -0,0 +1,52 @@
+package models
+
+import (
+	"context"
+	"slices"
+	"time"
+)
+
+// Permission — право на группу операций. Разрешения ролей хранятся
+// в таблице role_permissions, маршруты объявляют требуемое разрешение.
+type Permission string
+
+const (
+	PermSearchRead   Permission = "search:read"
+	PermComicsUpdate Permission = "comics:update"
+	PermIndexManage  Permission = "index:manage"
+	PermUsersManage  Permission = "users:manage"
+	PermAPIKeyManage Permission = "apikeys:manage"
+	PermAuditRead    Permission = "audit:read"
+)
+
+// Principal — аутентифицированный пользователь запроса.
+// TokenID — id access-токена, по которому его можно отозвать, а TokenExpiresAt —
+// время его истечения; при входе по API-ключу они пусты, а APIKeyID — id ключа.
+type Principal struct {
+	Username       string
+	Role           Role
+	TokenID        string
+	TokenExpiresAt time.Time
+	APIKeyID       int
+	Permissions    []Permission
+}
+
+// Can сообщает, есть ли у пользователя разрешение p.
+func (p Principal) Can(perm Permission) bool {
+	return slices.Contains(p.Permissions, perm)
+}
+
+type principalKey struct{}
+
+// WithPrincipal возвращает контекст с пользователем запроса.
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// PrincipalFrom возвращает пользователя запроса. ok равен false для запросов
+// к публичным маршрутам, которые не проходят аутентификацию.
+func PrincipalFrom(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(Principal)
+
+	return p, ok
+}
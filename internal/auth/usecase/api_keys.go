@@ -0,0 +1,209 @@
+package usecase
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/Leopold1975/yadro_app/internal/auth/models"
+)
+
+const (
+	// APIKeyPrefix отличает API-ключи от JWT и помогает находить их в логах и коде.
+	// Ключ имеет вид xk_<prefix>_<secret>.
+	APIKeyPrefix = "xk_"
+	prefixBytes  = 4
+)
+
+// APIKeysUsecase выдает и отзывает API-ключи. Выдача и отзыв записываются в журнал аудита.
+type APIKeysUsecase struct {
+	db    Storage
+	keys  APIKeyStorage
+	audit AuditUsecase
+}
+
+func NewAPIKeys(db Storage, keys APIKeyStorage, audit AuditUsecase) APIKeysUsecase {
+	return APIKeysUsecase{
+		db:    db,
+		keys:  keys,
+		audit: audit,
+	}
+}
+
+// Issue выдает ключ владельцу owner с разрешениями scopes по запросу пользователя p.
+// Scopes должны быть и у роли владельца, и у самого p, поэтому ключ с узкими
+// разрешениями не может выпустить более широкий. Выдавать ключи другим владельцам
+// может только пользователь с models.PermUsersManage. Нулевой ttl означает
+// бессрочный ключ. Сам ключ возвращается только здесь: хранится лишь его хэш.
+func (a APIKeysUsecase) Issue(ctx context.Context, p models.Principal, owner, name string, scopes []models.Permission,
+	ttl time.Duration,
+) (_ string, created models.APIKey, err error) { //nolint:nonamedreturns
+	defer func() {
+		e := auditEntry(models.AuditAPIKeyIssue, owner, fmt.Sprintf("name=%q scopes=%v ttl=%s", name, scopes, ttl))
+		if err == nil {
+			e.Details = fmt.Sprintf("id=%d %s", created.ID, e.Details)
+		}
+
+		a.audit.Record(ctx, e, err)
+	}()
+
+	if len(scopes) == 0 {
+		return "", models.APIKey{}, fmt.Errorf("%w: at least one scope required", models.ErrInvalidScope)
+	}
+
+	if owner != p.Username && !p.Can(models.PermUsersManage) {
+		return "", models.APIKey{}, fmt.Errorf("%w: %s required to issue keys for %s",
+			models.ErrForbidden, models.PermUsersManage, owner)
+	}
+
+	for _, s := range scopes {
+		if !p.Can(s) {
+			return "", models.APIKey{}, fmt.Errorf("%w: can't grant %s", models.ErrForbidden, s)
+		}
+	}
+
+	u, err := a.db.GetUser(ctx, owner)
+	if err != nil {
+		return "", models.APIKey{}, fmt.Errorf("get user error: %w", err)
+	}
+
+	perms, err := a.db.GetPermissions(ctx, u.Role)
+	if err != nil {
+		return "", models.APIKey{}, fmt.Errorf("get permissions error: %w", err)
+	}
+
+	for _, s := range scopes {
+		if !slices.Contains(perms, s) {
+			return "", models.APIKey{}, fmt.Errorf("%w: role %s has no %s", models.ErrInvalidScope, u.Role, s)
+		}
+	}
+
+	prefix := make([]byte, prefixBytes)
+	if _, err := rand.Read(prefix); err != nil {
+		return "", models.APIKey{}, fmt.Errorf("generate prefix error: %w", err)
+	}
+
+	secret, err := randomToken()
+	if err != nil {
+		return "", models.APIKey{}, err
+	}
+
+	k := models.APIKey{ //nolint:exhaustruct
+		Prefix: hex.EncodeToString(prefix),
+		Name:   name,
+		Owner:  owner,
+		Scopes: scopes,
+	}
+
+	if ttl > 0 {
+		k.ExpiresAt = time.Now().Add(ttl)
+	}
+
+	key := APIKeyPrefix + k.Prefix + "_" + secret
+	k.Hash = hashToken(key)
+
+	created, err = a.keys.CreateAPIKey(ctx, k)
+	if err != nil {
+		return "", models.APIKey{}, fmt.Errorf("create api key error: %w", err)
+	}
+
+	return key, created, nil
+}
+
+func (a APIKeysUsecase) List(ctx context.Context) ([]models.APIKey, error) {
+	keys, err := a.keys.ListAPIKeys(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list api keys error: %w", err)
+	}
+
+	return keys, nil
+}
+
+func (a APIKeysUsecase) Revoke(ctx context.Context, id int) (err error) { //nolint:nonamedreturns
+	defer func() {
+		a.audit.Record(ctx, auditEntry(models.AuditAPIKeyRevoke, strconv.Itoa(id), ""), err)
+	}()
+
+	if err := a.keys.RevokeAPIKey(ctx, id); err != nil {
+		return fmt.Errorf("revoke api key error: %w", err)
+	}
+
+	return nil
+}
+
+// IsAPIKey сообщает, похожа ли строка на API-ключ, а не на JWT.
+func IsAPIKey(s string) bool {
+	return strings.HasPrefix(s, APIKeyPrefix)
+}
+
+// authAPIKey проверяет ключ и возвращает пользователя запроса с разрешениями
+// из пересечения scopes ключа и текущих разрешений роли владельца.
+func authAPIKey(ctx context.Context, db Storage, keys APIKeyStorage, key string) (models.Principal, error) {
+	prefix, _, ok := strings.Cut(strings.TrimPrefix(key, APIKeyPrefix), "_")
+	if !ok || !IsAPIKey(key) {
+		return models.Principal{}, models.ErrInvalidAPIKey
+	}
+
+	k, err := keys.GetAPIKey(ctx, prefix)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			return models.Principal{}, models.ErrInvalidAPIKey
+		}
+
+		return models.Principal{}, fmt.Errorf("get api key error %w", err)
+	}
+
+	if subtle.ConstantTimeCompare([]byte(hashToken(key)), []byte(k.Hash)) != 1 {
+		return models.Principal{}, models.ErrInvalidAPIKey
+	}
+
+	if !k.RevokedAt.IsZero() {
+		return models.Principal{}, fmt.Errorf("%w: revoked", models.ErrInvalidAPIKey)
+	}
+
+	if !k.ExpiresAt.IsZero() && time.Now().After(k.ExpiresAt) {
+		return models.Principal{}, fmt.Errorf("%w: expired", models.ErrInvalidAPIKey)
+	}
+
+	u, err := db.GetUser(ctx, k.Owner)
+	if err != nil {
+		return models.Principal{}, fmt.Errorf("get user error %w", err)
+	}
+
+	if u.Disabled {
+		return models.Principal{}, models.ErrUserDisabled
+	}
+
+	perms, err := db.GetPermissions(ctx, u.Role)
+	if err != nil {
+		return models.Principal{}, fmt.Errorf("get permissions error %w", err)
+	}
+
+	granted := make([]models.Permission, 0, len(k.Scopes))
+
+	for _, p := range perms {
+		if slices.Contains(k.Scopes, p) {
+			granted = append(granted, p)
+		}
+	}
+
+	if err := keys.TouchAPIKey(ctx, k.ID); err != nil {
+		return models.Principal{}, fmt.Errorf("touch api key error %w", err)
+	}
+
+	return models.Principal{
+		Username:       u.Username,
+		Role:           u.Role,
+		TokenID:        "",
+		TokenExpiresAt: time.Time{},
+		APIKeyID:       k.ID,
+		Permissions:    granted,
+	}, nil
+}
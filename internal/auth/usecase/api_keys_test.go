@@ -0,0 +1,122 @@
+package usecase_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Leopold1975/yadro_app/internal/auth/database/memorydb"
+	"github.com/Leopold1975/yadro_app/internal/auth/models"
+	"github.com/Leopold1975/yadro_app/internal/auth/usecase"
+	"github.com/Leopold1975/yadro_app/pkg/logger"
+	"github.com/stretchr/testify/require"
+)
+
+// principal — пользователь запроса с разрешениями роли из db, как после входа по JWT.
+func principal(t *testing.T, db *memorydb.UserRepo, username string, role models.Role) models.Principal {
+	t.Helper()
+
+	perms, err := db.GetPermissions(context.Background(), role)
+	require.NoError(t, err)
+
+	return models.Principal{Username: username, Role: role, Permissions: perms} //nolint:exhaustruct
+}
+
+func TestAPIKeys(t *testing.T) {
+	ctx := context.Background()
+	db := newUserRepo()
+	audit := usecase.NewAudit(db, logger.New("error"))
+	users := usecase.NewUsers(authCfg, db, db, audit)
+	apiKeys := usecase.NewAPIKeys(db, db, audit)
+	auth := usecase.NewAuthUser(db, db, db, signer)
+
+	_, err := users.Create(ctx, "batch", "Batch-password1", models.AdminRole)
+	require.NoError(t, err)
+
+	_, err = users.Create(ctx, "user1", "User-password1", "")
+	require.NoError(t, err)
+
+	admin := principal(t, db, "batch", models.AdminRole)
+
+	_, _, err = apiKeys.Issue(ctx, admin, "batch", "no scopes", nil, 0)
+	require.ErrorIs(t, err, models.ErrInvalidScope)
+
+	// ключ не дает разрешений сверх роли владельца.
+	_, _, err = apiKeys.Issue(ctx, admin, "user1", "too wide", []models.Permission{models.PermComicsUpdate}, 0)
+	require.ErrorIs(t, err, models.ErrInvalidScope)
+
+	key, k, err := apiKeys.Issue(ctx, admin, "batch", "updater",
+		[]models.Permission{models.PermSearchRead, models.PermComicsUpdate}, time.Hour)
+	require.NoError(t, err)
+	require.True(t, strings.HasPrefix(key, usecase.APIKeyPrefix+k.Prefix+"_"))
+	require.NotContains(t, k.Hash, key)
+
+	p, err := auth.Auth(ctx, key)
+	require.NoError(t, err)
+	require.Equal(t, "batch", p.Username)
+	require.Equal(t, k.ID, p.APIKeyID)
+	require.True(t, p.Can(models.PermComicsUpdate))
+	require.False(t, p.Can(models.PermUsersManage))
+
+	list, err := apiKeys.List(ctx)
+	require.NoError(t, err)
+	require.False(t, list[0].LastUsedAt.IsZero())
+
+	_, err = auth.Auth(ctx, key+"x")
+	require.ErrorIs(t, err, models.ErrInvalidAPIKey)
+
+	// роль владельца ограничивает ключ и после выдачи.
+	require.NoError(t, users.SetRole(ctx, "user1", models.AdminRole))
+	require.NoError(t, users.SetRole(ctx, "batch", models.UserRole))
+
+	p, err = auth.Auth(ctx, key)
+	require.NoError(t, err)
+	require.True(t, p.Can(models.PermSearchRead))
+	require.False(t, p.Can(models.PermComicsUpdate))
+
+	require.NoError(t, apiKeys.Revoke(ctx, k.ID))
+	require.ErrorIs(t, apiKeys.Revoke(ctx, k.ID), models.ErrNotFound)
+
+	_, err = auth.Auth(ctx, key)
+	require.ErrorIs(t, err, models.ErrInvalidAPIKey)
+}
+
+func TestAPIKeysIssueScope(t *testing.T) {
+	ctx := context.Background()
+	db := newUserRepo()
+	audit := usecase.NewAudit(db, logger.New("error"))
+	users := usecase.NewUsers(authCfg, db, db, audit)
+	apiKeys := usecase.NewAPIKeys(db, db, audit)
+	auth := usecase.NewAuthUser(db, db, db, signer)
+
+	_, err := users.Create(ctx, "admin", "Admin-password1", models.AdminRole)
+	require.NoError(t, err)
+
+	_, err = users.Create(ctx, "admin2", "Admin-password1", models.AdminRole)
+	require.NoError(t, err)
+
+	key, _, err := apiKeys.Issue(ctx, principal(t, db, "admin", models.AdminRole), "admin", "keys",
+		[]models.Permission{models.PermAPIKeyManage}, 0)
+	require.NoError(t, err)
+
+	narrow, err := auth.Auth(ctx, key)
+	require.NoError(t, err)
+
+	// ключ с узкими разрешениями не выпускает более широкий ключ, даже если
+	// такие разрешения есть у роли владельца.
+	_, _, err = apiKeys.Issue(ctx, narrow, "admin", "wide", []models.Permission{models.PermUsersManage}, 0)
+	require.ErrorIs(t, err, models.ErrForbidden)
+
+	// и не выдает ключи другим владельцам.
+	_, _, err = apiKeys.Issue(ctx, narrow, "admin2", "other", []models.Permission{models.PermAPIKeyManage}, 0)
+	require.ErrorIs(t, err, models.ErrForbidden)
+
+	_, _, err = apiKeys.Issue(ctx, narrow, "admin", "same", []models.Permission{models.PermAPIKeyManage}, 0)
+	require.NoError(t, err)
+
+	// с users:manage можно выдать ключ другому владельцу.
+	_, _, err = apiKeys.Issue(ctx, principal(t, db, "admin", models.AdminRole), "admin2", "other",
+		[]models.Permission{models.PermSearchRead}, 0)
+	require.NoError(t, err)
+}
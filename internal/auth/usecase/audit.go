@@ -0,0 +1,106 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/Leopold1975/yadro_app/internal/auth/models"
+	"github.com/Leopold1975/yadro_app/pkg/logger"
+)
+
+const (
+	defaultAuditLimit = 100
+	maxAuditLimit     = 1000
+)
+
+var ErrInvalidTimeRange = errors.New("from must be before to")
+
+// AuditUsecase ведет журнал аудита. Ошибка записи в журнал не отменяет действие,
+// а только попадает в лог, чтобы недоступность журнала не останавливала работу.
+type AuditUsecase struct {
+	db AuditStorage
+	l  logger.Logger
+}
+
+func NewAudit(db AuditStorage, l logger.Logger) AuditUsecase {
+	return AuditUsecase{
+		db: db,
+		l:  l,
+	}
+}
+
+// Record записывает действие e с результатом err. Если автор в e не задан, им
+// становится пользователь запроса ctx, а вне HTTP-запроса — models.SystemActor.
+// Адрес клиента тоже берется из запроса. Текст ошибки дописывается в Details.
+func (a AuditUsecase) Record(ctx context.Context, e models.AuditEntry, err error) {
+	info := models.RequestInfoFrom(ctx)
+
+	if p, ok := models.PrincipalFrom(ctx); ok && e.Actor == "" {
+		e.Actor = p.Username
+		e.APIKeyID = p.APIKeyID
+	}
+
+	if info == nil && e.Actor == "" {
+		e.Actor = models.SystemActor
+	}
+
+	if info != nil && e.ClientIP == "" {
+		e.ClientIP = info.ClientIP
+	}
+
+	e.Outcome = models.AuditSuccess
+
+	if err != nil {
+		e.Outcome = models.AuditFailure
+
+		if e.Details != "" {
+			e.Details += "; "
+		}
+
+		e.Details += "error: " + err.Error()
+	}
+
+	// запись нужна и тогда, когда клиент уже отключился.
+	if err := a.db.AppendAudit(context.WithoutCancel(ctx), e); err != nil {
+		a.l.Error("audit record error", "action", e.Action, "actor", e.Actor, "error", err)
+	}
+}
+
+// List возвращает записи журнала по фильтру f, новые первыми. Нулевой Limit
+// заменяется на defaultAuditLimit, а больший maxAuditLimit ограничивается им.
+func (a AuditUsecase) List(ctx context.Context, f models.AuditFilter) ([]models.AuditEntry, error) {
+	if !f.From.IsZero() && !f.To.IsZero() && !f.From.Before(f.To) {
+		return nil, ErrInvalidTimeRange
+	}
+
+	if f.Limit <= 0 {
+		f.Limit = defaultAuditLimit
+	}
+
+	f.Limit = min(f.Limit, maxAuditLimit)
+
+	entries, err := a.db.ListAudit(ctx, f)
+	if err != nil {
+		return nil, fmt.Errorf("list audit error: %w", err)
+	}
+
+	return entries, nil
+}
+
+// auditEntry — запись о действии action над target; автора, адрес и результат
+// заполняет Record.
+func auditEntry(action models.AuditAction, target, details string) models.AuditEntry {
+	return models.AuditEntry{
+		ID:        0,
+		CreatedAt: time.Time{},
+		Actor:     "",
+		APIKeyID:  0,
+		Action:    action,
+		Target:    target,
+		Details:   details,
+		Outcome:   "",
+		ClientIP:  "",
+	}
+}
@@ -0,0 +1,91 @@
+package usecase_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Leopold1975/yadro_app/internal/auth/models"
+	"github.com/Leopold1975/yadro_app/internal/auth/usecase"
+	"github.com/Leopold1975/yadro_app/pkg/logger"
+	"github.com/stretchr/testify/require"
+)
+
+func TestAudit(t *testing.T) {
+	ctx := context.Background()
+	db := newUserRepo()
+	audit := usecase.NewAudit(db, logger.New("error"))
+	users := usecase.NewUsers(authCfg, db, db, audit)
+	login := usecase.NewLoginUser(authCfg, db, db, db, signer, audit)
+	apiKeys := usecase.NewAPIKeys(db, db, audit)
+
+	// вне HTTP-запроса действия выполняет система.
+	_, err := users.Create(ctx, "admin", "Admin-password1", models.AdminRole)
+	require.NoError(t, err)
+
+	_, err = login.Login(ctx, "admin", "wrong", testIP)
+	require.ErrorIs(t, err, models.ErrInvalidCredentials)
+
+	_, err = login.Login(ctx, "admin", "Admin-password1", testIP)
+	require.NoError(t, err)
+
+	admin := principal(t, db, "admin", models.AdminRole)
+	info := &models.RequestInfo{ClientIP: "192.0.2.7", Principal: admin}
+	req := models.WithPrincipal(models.WithRequestInfo(ctx, info), admin)
+
+	_, err = users.Create(req, "user1", "User-password1", "")
+	require.NoError(t, err)
+
+	require.ErrorIs(t, users.SetRole(req, "user1", "root"), models.ErrInvalidRole)
+	require.NoError(t, users.SetDisabled(req, "user1", true))
+
+	_, k, err := apiKeys.Issue(req, admin, "admin", "batch", []models.Permission{models.PermSearchRead}, 0)
+	require.NoError(t, err)
+	require.NoError(t, apiKeys.Revoke(req, k.ID))
+
+	all, err := audit.List(ctx, models.AuditFilter{}) //nolint:exhaustruct
+	require.NoError(t, err)
+	require.Len(t, all, 8)
+
+	// новые записи первыми.
+	require.Equal(t, models.AuditAPIKeyRevoke, all[0].Action)
+
+	byAction := make(map[models.AuditAction][]models.AuditEntry)
+	for _, e := range all {
+		byAction[e.Action] = append(byAction[e.Action], e)
+	}
+
+	logins := byAction[models.AuditLogin]
+	require.Len(t, logins, 2)
+	require.Equal(t, "admin", logins[1].Actor)
+	require.Equal(t, models.AuditFailure, logins[1].Outcome)
+	require.Equal(t, models.AuditSuccess, logins[0].Outcome)
+	require.Equal(t, testIP, logins[0].ClientIP)
+
+	created := byAction[models.AuditUserCreate]
+	require.Len(t, created, 2)
+	require.Equal(t, models.SystemActor, created[1].Actor)
+	require.Equal(t, "admin", created[0].Actor)
+	require.Equal(t, "user1", created[0].Target)
+	require.Equal(t, "role=user", created[0].Details)
+	require.Equal(t, "192.0.2.7", created[0].ClientIP)
+
+	setRole := byAction[models.AuditUserSetRole][0]
+	require.Equal(t, models.AuditFailure, setRole.Outcome)
+	require.Contains(t, setRole.Details, models.ErrInvalidRole.Error())
+
+	require.Equal(t, "disabled=true", byAction[models.AuditUserDisable][0].Details)
+
+	byActor, err := audit.List(ctx, models.AuditFilter{Actor: "admin", Limit: 2}) //nolint:exhaustruct
+	require.NoError(t, err)
+	require.Len(t, byActor, 2)
+
+	now := time.Now()
+
+	_, err = audit.List(ctx, models.AuditFilter{From: now, To: now.Add(-time.Hour)}) //nolint:exhaustruct
+	require.ErrorIs(t, err, usecase.ErrInvalidTimeRange)
+
+	future, err := audit.List(ctx, models.AuditFilter{From: now.Add(time.Hour)}) //nolint:exhaustruct
+	require.NoError(t, err)
+	require.Empty(t, future)
+}
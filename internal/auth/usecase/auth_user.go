@@ -4,33 +4,73 @@ import (
 	"context"
 	"fmt"
 
-	"github.com/Leopold1975/yadro_app/internal/pkg/config"
-	"github.com/Leopold1975/yadro_app/internal/pkg/jwtauth"
+	"github.com/Leopold1975/yadro_app/internal/auth/models"
 )
 
 type AuthUserUsecase struct {
-	db  Storage
-	cfg config.Auth
+	db     Storage
+	tokens TokenStorage
+	keys   APIKeyStorage
+	signer TokenSigner
 }
 
-func NewAuthUser(cfg config.Auth, db Storage) AuthUserUsecase {
+func NewAuthUser(db Storage, tokens TokenStorage, keys APIKeyStorage, signer TokenSigner) AuthUserUsecase {
 	return AuthUserUsecase{
-		db:  db,
-		cfg: cfg,
+		db:     db,
+		tokens: tokens,
+		keys:   keys,
+		signer: signer,
 	}
 }
 
-func (a AuthUserUsecase) Auth(ctx context.Context, token string) (string, error) {
+// Auth проверяет токен или API-ключ, в том числе что он не отозван, и возвращает
+// пользователя запроса. Роль и ее разрешения берутся из хранилища, чтобы их изменение,
+// отключение и удаление пользователя действовали сразу, а не после истечения его токенов.
+func (a AuthUserUsecase) Auth(ctx context.Context, token string) (models.Principal, error) {
 	select {
 	case <-ctx.Done():
-		return "", fmt.Errorf("context error %w", ctx.Err())
+		return models.Principal{}, fmt.Errorf("context error %w", ctx.Err())
 	default:
 	}
 
-	role, err := jwtauth.ValidateTokenRole(token, a.cfg.Secret)
+	if IsAPIKey(token) {
+		return authAPIKey(ctx, a.db, a.keys, token)
+	}
+
+	claims, err := a.signer.Validate(token)
+	if err != nil {
+		return models.Principal{}, fmt.Errorf("validate token error %w", err)
+	}
+
+	revoked, err := a.tokens.IsTokenRevoked(ctx, claims.ID)
+	if err != nil {
+		return models.Principal{}, fmt.Errorf("check token revocation error %w", err)
+	}
+
+	if revoked {
+		return models.Principal{}, models.ErrTokenRevoked
+	}
+
+	u, err := a.db.GetUser(ctx, claims.Subject)
+	if err != nil {
+		return models.Principal{}, fmt.Errorf("get user error %w", err)
+	}
+
+	if u.Disabled {
+		return models.Principal{}, models.ErrUserDisabled
+	}
+
+	perms, err := a.db.GetPermissions(ctx, u.Role)
 	if err != nil {
-		return "", fmt.Errorf("validate token role error %w", err)
+		return models.Principal{}, fmt.Errorf("get permissions error %w", err)
 	}
 
-	return role, nil
+	return models.Principal{
+		Username:       u.Username,
+		Role:           u.Role,
+		TokenID:        claims.ID,
+		TokenExpiresAt: claims.ExpiresAt,
+		APIKeyID:       0,
+		Permissions:    perms,
+	}, nil
 }
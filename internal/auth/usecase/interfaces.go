@@ -2,11 +2,65 @@ package usecase
 
 import (
 	"context"
+	"time"
 
 	"github.com/Leopold1975/yadro_app/internal/auth/models"
+	"github.com/Leopold1975/yadro_app/internal/pkg/jwtauth"
 )
 
 type Storage interface {
 	CreateUser(ctx context.Context, user models.User) error
 	GetUser(ctx context.Context, username string) (models.User, error)
+	ListUsers(ctx context.Context) ([]models.User, error)
+	UpdateRole(ctx context.Context, username string, role models.Role) error
+	SetDisabled(ctx context.Context, username string, disabled bool) error
+	UpdatePassword(ctx context.Context, username, passwordHash string) error
+	DeleteUser(ctx context.Context, username string) error
+	// GetPermissions возвращает разрешения роли или models.ErrInvalidRole, если роли нет.
+	GetPermissions(ctx context.Context, role models.Role) ([]models.Permission, error)
+}
+
+// TokenStorage хранит refresh-токены и отозванные access-токены.
+type TokenStorage interface {
+	SaveRefreshToken(ctx context.Context, t models.RefreshToken) error
+	GetRefreshToken(ctx context.Context, hash string) (models.RefreshToken, error)
+	RotateRefreshToken(ctx context.Context, oldHash string, next models.RefreshToken) error
+	RevokeRefreshFamily(ctx context.Context, family string) error
+	RevokeUserRefreshTokens(ctx context.Context, username string) error
+	RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error
+	IsTokenRevoked(ctx context.Context, jti string) (bool, error)
+}
+
+// APIKeyStorage хранит API-ключи.
+type APIKeyStorage interface {
+	CreateAPIKey(ctx context.Context, k models.APIKey) (models.APIKey, error)
+	GetAPIKey(ctx context.Context, prefix string) (models.APIKey, error)
+	ListAPIKeys(ctx context.Context) ([]models.APIKey, error)
+	RevokeAPIKey(ctx context.Context, id int) error
+	TouchAPIKey(ctx context.Context, id int) error
+}
+
+// LoginAttemptStorage хранит попытки входа для защиты от перебора.
+type LoginAttemptStorage interface {
+	// StartLoginAttempt записывает попытку a как models.LoginPending и возвращает ее id
+	// и неудачи после since, записанные до нее. Вызовы для одного имени или адреса
+	// выполняются по очереди, поэтому из параллельных попыток без задержки
+	// проходит только первая.
+	StartLoginAttempt(ctx context.Context, a models.LoginAttempt, since time.Time,
+	) (int64, models.LoginFailures, error)
+	FinishLoginAttempt(ctx context.Context, id int64, outcome models.LoginOutcome) error
+	// DeleteLoginAttempts удаляет попытки до before и возвращает их количество.
+	DeleteLoginAttempts(ctx context.Context, before time.Time) (int64, error)
+}
+
+// AuditStorage хранит журнал аудита. Записи только добавляются.
+type AuditStorage interface {
+	AppendAudit(ctx context.Context, e models.AuditEntry) error
+	ListAudit(ctx context.Context, f models.AuditFilter) ([]models.AuditEntry, error)
+}
+
+// TokenSigner выдает и проверяет access-токены.
+type TokenSigner interface {
+	Sign(user models.User, ttl time.Duration) (string, error)
+	Validate(token string) (jwtauth.Claims, error)
 }
@@ -0,0 +1,120 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/Leopold1975/yadro_app/internal/auth/models"
+	"github.com/Leopold1975/yadro_app/internal/pkg/config"
+	"github.com/Leopold1975/yadro_app/pkg/logger"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// maxDelayShift ограничивает удвоение задержки, чтобы Delay·2^n не переполнился.
+	maxDelayShift = 30
+	// attemptsCleanupInterval — период удаления старых попыток входа.
+	attemptsCleanupInterval = time.Hour
+)
+
+// dummyHash — хэш, с которым сравнивается пароль неизвестного пользователя,
+// чтобы ответ занимал столько же времени, сколько для существующего.
+var dummyHash = sync.OnceValue(func() []byte { //nolint:gochecknoglobals
+	h, _ := bcrypt.GenerateFromPassword([]byte("dummy password"), bcrypt.DefaultCost)
+
+	return h
+})
+
+// startAttempt записывает попытку входа как незавершенную и возвращает ее id.
+// Если для имени или адреса следующая попытка еще не разрешена, попытка
+// завершается как models.LoginLocked и возвращается models.LockedError.
+func (a LoginUserUsecase) startAttempt(ctx context.Context, username, ip string) (int64, error) {
+	cfg := a.cfg.Lockout
+	now := time.Now()
+
+	id, f, err := a.attempts.StartLoginAttempt(ctx, models.LoginAttempt{
+		ID:        0,
+		Username:  username,
+		IP:        ip,
+		Outcome:   models.LoginPending,
+		CreatedAt: time.Time{},
+	}, now.Add(-cfg.Window))
+	if err != nil {
+		return 0, fmt.Errorf("start login attempt error: %w", err)
+	}
+
+	wait := max(
+		userDelay(cfg, f.User)-now.Sub(f.UserLast),
+		ipDelay(cfg, f.IP)-now.Sub(f.IPLast),
+	)
+	if wait <= 0 {
+		return id, nil
+	}
+
+	if err := a.finishAttempt(ctx, id, models.LoginLocked); err != nil {
+		return 0, err
+	}
+
+	return 0, models.LockedError{RetryAfter: wait}
+}
+
+func (a LoginUserUsecase) finishAttempt(ctx context.Context, id int64, outcome models.LoginOutcome) error {
+	// попытку надо завершить, даже если клиент уже отключился.
+	if err := a.attempts.FinishLoginAttempt(context.WithoutCancel(ctx), id, outcome); err != nil {
+		return fmt.Errorf("finish login attempt error: %w", err)
+	}
+
+	return nil
+}
+
+// RunAttemptsCleanup раз в attemptsCleanupInterval удаляет попытки входа старше
+// Lockout.Retention (но не моложе Window), пока не отменен ctx.
+func (a LoginUserUsecase) RunAttemptsCleanup(ctx context.Context, l logger.Logger) {
+	ticker := time.NewTicker(attemptsCleanupInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			retention := max(a.cfg.Lockout.Retention, a.cfg.Lockout.Window)
+
+			n, err := a.attempts.DeleteLoginAttempts(ctx, now.Add(-retention))
+			if err != nil {
+				l.Error("delete login attempts error", "error", err)
+
+				continue
+			}
+
+			if n > 0 {
+				l.Debug("login attempts deleted", "count", n)
+			}
+		}
+	}
+}
+
+// userDelay — сколько ждать после последней из n неудачных попыток для одного имени.
+// Задержка удваивается с каждой неудачей, но не превышает Duration.
+func userDelay(cfg config.Lockout, n int) time.Duration {
+	switch {
+	case n == 0:
+		return 0
+	case cfg.MaxAttempts > 0 && n >= cfg.MaxAttempts, n > maxDelayShift:
+		return cfg.Duration
+	}
+
+	return min(cfg.Delay<<(n-1), cfg.Duration)
+}
+
+// ipDelay — сколько ждать после последней из n неудачных попыток с одного адреса.
+// Постепенной задержки для адреса нет: за одним адресом может быть много пользователей.
+func ipDelay(cfg config.Lockout, n int) time.Duration {
+	if cfg.IPMaxAttempts > 0 && n >= cfg.IPMaxAttempts {
+		return cfg.Duration
+	}
+
+	return 0
+}
@@ -0,0 +1,185 @@
+package usecase_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Leopold1975/yadro_app/internal/auth/database/memorydb"
+	"github.com/Leopold1975/yadro_app/internal/auth/models"
+	"github.com/Leopold1975/yadro_app/internal/auth/usecase"
+	"github.com/Leopold1975/yadro_app/internal/pkg/config"
+	"github.com/Leopold1975/yadro_app/pkg/logger"
+	"github.com/stretchr/testify/require"
+)
+
+const testIP = "192.0.2.1"
+
+func countAttempts(db *memorydb.UserRepo, outcome models.LoginOutcome) int {
+	n := 0
+
+	for _, a := range db.LoginAttempts() {
+		if a.Outcome == outcome {
+			n++
+		}
+	}
+
+	return n
+}
+
+func lockoutConfig() config.Auth {
+	cfg := authCfg
+	cfg.Lockout = config.Lockout{
+		MaxAttempts:   3,
+		IPMaxAttempts: 5,
+		Window:        time.Hour,
+		Delay:         time.Minute,
+		Duration:      10 * time.Minute,
+		Retention:     24 * time.Hour,
+	}
+
+	return cfg
+}
+
+func requireLocked(t *testing.T, err error, retryAfter time.Duration) {
+	t.Helper()
+
+	require.ErrorIs(t, err, models.ErrLoginLocked)
+
+	var locked models.LockedError
+
+	require.True(t, errors.As(err, &locked))
+	require.InDelta(t, retryAfter.Seconds(), locked.RetryAfter.Seconds(), 2)
+}
+
+func TestLoginLockout(t *testing.T) {
+	ctx := context.Background()
+	cfg := lockoutConfig()
+	cfg.Lockout.IPMaxAttempts = 100
+	db := newUserRepo()
+	audit := usecase.NewAudit(db, logger.New("error"))
+	users := usecase.NewUsers(cfg, db, db, audit)
+	login := usecase.NewLoginUser(cfg, db, db, db, signer, audit)
+
+	_, err := users.Create(ctx, "user1", "User-password1", "")
+	require.NoError(t, err)
+
+	// неизвестное имя и неверный пароль неразличимы.
+	_, err = login.Login(ctx, "ghost", "User-password1", testIP)
+	require.ErrorIs(t, err, models.ErrInvalidCredentials)
+
+	_, err = login.Login(ctx, "user1", "wrong", testIP)
+	require.ErrorIs(t, err, models.ErrInvalidCredentials)
+
+	// после неудачи следующая попытка разрешена только через Delay, даже с верным паролем.
+	_, err = login.Login(ctx, "user1", "User-password1", testIP)
+	requireLocked(t, err, time.Minute)
+
+	db.AgeLoginAttempts(time.Minute + time.Second)
+
+	_, err = login.Login(ctx, "user1", "wrong", testIP)
+	require.ErrorIs(t, err, models.ErrInvalidCredentials)
+
+	_, err = login.Login(ctx, "user1", "User-password1", testIP)
+	requireLocked(t, err, 2*time.Minute)
+
+	db.AgeLoginAttempts(2*time.Minute + time.Second)
+
+	_, err = login.Login(ctx, "user1", "wrong", testIP)
+	require.ErrorIs(t, err, models.ErrInvalidCredentials)
+
+	// MaxAttempts неудач блокируют имя на Duration.
+	db.AgeLoginAttempts(5 * time.Minute)
+
+	_, err = login.Login(ctx, "user1", "User-password1", testIP)
+	requireLocked(t, err, 5*time.Minute)
+	require.Equal(t, 3, countAttempts(db, models.LoginLocked))
+
+	db.AgeLoginAttempts(5*time.Minute + time.Second)
+
+	_, err = login.Login(ctx, "user1", "User-password1", testIP)
+	require.NoError(t, err)
+
+	// успешный вход сбрасывает счетчик имени.
+	_, err = login.Login(ctx, "user1", "wrong", testIP)
+	require.ErrorIs(t, err, models.ErrInvalidCredentials)
+
+	_, err = login.Login(ctx, "user1", "User-password1", testIP)
+	requireLocked(t, err, time.Minute)
+
+	// имена, которых не может быть, считаются неизвестными.
+	_, err = login.Login(ctx, "bad name\x00", "User-password1", testIP)
+	require.ErrorIs(t, err, models.ErrInvalidCredentials)
+}
+
+func TestLoginLockoutIP(t *testing.T) {
+	ctx := context.Background()
+	cfg := lockoutConfig()
+	db := newUserRepo()
+	audit := usecase.NewAudit(db, logger.New("error"))
+	users := usecase.NewUsers(cfg, db, db, audit)
+	login := usecase.NewLoginUser(cfg, db, db, db, signer, audit)
+
+	_, err := users.Create(ctx, "user1", "User-password1", "")
+	require.NoError(t, err)
+
+	for i := range cfg.Lockout.IPMaxAttempts {
+		_, err = login.Login(ctx, fmt.Sprintf("user%d", i+10), "wrong", testIP)
+		require.ErrorIs(t, err, models.ErrInvalidCredentials)
+	}
+
+	_, err = login.Login(ctx, "user1", "User-password1", testIP)
+	requireLocked(t, err, 10*time.Minute)
+
+	_, err = login.Login(ctx, "user1", "User-password1", "192.0.2.2")
+	require.NoError(t, err)
+}
+
+func TestLoginLockoutParallel(t *testing.T) {
+	ctx := context.Background()
+	cfg := lockoutConfig()
+	db := newUserRepo()
+	audit := usecase.NewAudit(db, logger.New("error"))
+	users := usecase.NewUsers(cfg, db, db, audit)
+	login := usecase.NewLoginUser(cfg, db, db, db, signer, audit)
+
+	_, err := users.Create(ctx, "user1", "User-password1", "")
+	require.NoError(t, err)
+
+	const n = 10
+
+	var (
+		wg             sync.WaitGroup
+		failed, locked atomic.Int32
+	)
+
+	// параллельные попытки не проходят мимо задержки: пароль проверяется
+	// только у первой, остальные видят ее незавершенной.
+	for range n {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			_, err := login.Login(ctx, "user1", "wrong", testIP)
+
+			switch {
+			case errors.Is(err, models.ErrInvalidCredentials):
+				failed.Add(1)
+			case errors.Is(err, models.ErrLoginLocked):
+				locked.Add(1)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	require.Equal(t, int32(1), failed.Load())
+	require.Equal(t, int32(n-1), locked.Load())
+	require.Equal(t, 1, countAttempts(db, models.LoginFailure))
+	require.Equal(t, n-1, countAttempts(db, models.LoginLocked))
+}
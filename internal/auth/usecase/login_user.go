@@ -2,46 +2,279 @@ package usecase
 
 import (
 	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
 	"errors"
 	"fmt"
+	"time"
 
 	"github.com/Leopold1975/yadro_app/internal/auth/models"
 	"github.com/Leopold1975/yadro_app/internal/pkg/config"
-	"github.com/Leopold1975/yadro_app/internal/pkg/jwtauth"
 	"golang.org/x/crypto/bcrypt"
 )
 
+// refreshTokenBytes — длина случайной части refresh-токена.
+const refreshTokenBytes = 32
+
+// LoginUserUsecase выдает пары из короткоживущего access-токена и refresh-токена.
+// Refresh-токен одноразовый: /refresh заменяет его новым той же цепочки (family),
+// а повторное предъявление замененного токена считается утечкой и отзывает всю цепочку.
 type LoginUserUsecase struct {
-	db  Storage
-	cfg config.Auth
+	db       Storage
+	tokens   TokenStorage
+	attempts LoginAttemptStorage
+	signer   TokenSigner
+	audit    AuditUsecase
+	cfg      config.Auth
 }
 
-func NewLoginUser(cfg config.Auth, db Storage) LoginUserUsecase {
+func NewLoginUser(cfg config.Auth, db Storage, tokens TokenStorage, attempts LoginAttemptStorage,
+	signer TokenSigner, audit AuditUsecase,
+) LoginUserUsecase {
 	return LoginUserUsecase{
-		db:  db,
-		cfg: cfg,
+		db:       db,
+		tokens:   tokens,
+		attempts: attempts,
+		signer:   signer,
+		audit:    audit,
+		cfg:      cfg,
+	}
+}
+
+// Login выдает пару токенов по имени и паролю. ip — адрес клиента: неудачные попытки
+// считаются для имени и для адреса, и после них вход временно блокируется
+// (см. config.Lockout). Неизвестное имя и неверный пароль неразличимы ни по ошибке,
+// ни по времени ответа. Вход записывается в журнал аудита; пустой автор записи
+// означает недопустимое имя.
+func (a LoginUserUsecase) Login(ctx context.Context, username, password, ip string) (models.TokenPair, error) {
+	// такого имени не может быть в users, а в login_attempts оно может не поместиться.
+	if !usernameRe.MatchString(username) {
+		username = ""
+	}
+
+	tp, err := a.login(ctx, username, password, ip)
+
+	e := auditEntry(models.AuditLogin, username, "")
+	e.Actor = username
+	e.ClientIP = ip
+	a.audit.Record(ctx, e, err)
+
+	return tp, err
+}
+
+func (a LoginUserUsecase) login(ctx context.Context, username, password, ip string) (models.TokenPair, error) {
+	id, err := a.startAttempt(ctx, username, ip)
+	if err != nil {
+		return models.TokenPair{}, err
+	}
+
+	u, err := a.checkPassword(ctx, username, password)
+	if err != nil {
+		// ошибка проверки тоже считается неудачей: иначе ее можно было бы
+		// вызывать намеренно, чтобы обойти задержки.
+		if err := a.finishAttempt(ctx, id, models.LoginFailure); err != nil {
+			return models.TokenPair{}, err
+		}
+
+		return models.TokenPair{}, err
+	}
+
+	if err := a.finishAttempt(ctx, id, models.LoginSuccess); err != nil {
+		return models.TokenPair{}, err
+	}
+
+	family, err := randomToken()
+	if err != nil {
+		return models.TokenPair{}, err
+	}
+
+	refresh, stored, err := a.newRefreshToken(u.Username, family)
+	if err != nil {
+		return models.TokenPair{}, err
+	}
+
+	if err := a.tokens.SaveRefreshToken(ctx, stored); err != nil {
+		return models.TokenPair{}, fmt.Errorf("save refresh token error: %w", err)
 	}
+
+	return a.tokenPair(u, refresh)
 }
 
-func (a LoginUserUsecase) Login(ctx context.Context, username, password string) (string, error) {
+// checkPassword возвращает пользователя, если пароль верен. Для неизвестного
+// пользователя пароль сравнивается с фиктивным хэшем, чтобы не выдать его отсутствие.
+func (a LoginUserUsecase) checkPassword(ctx context.Context, username, password string) (models.User, error) {
 	u, err := a.db.GetUser(ctx, username)
 	if err != nil {
-		return "", fmt.Errorf("get user error %w", err)
+		if !errors.Is(err, models.ErrNotFound) {
+			return models.User{}, fmt.Errorf("get user error %w", err)
+		}
+
+		bcrypt.CompareHashAndPassword(dummyHash(), []byte(password)) //nolint:errcheck
+
+		return models.User{}, models.ErrInvalidCredentials
 	}
 
 	err = bcrypt.CompareHashAndPassword([]byte(u.PasswordHash), []byte(password))
 	if err != nil {
 		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
-			return "", models.ErrWrongPassword
+			return models.User{}, models.ErrInvalidCredentials
 		}
 
-		return "", fmt.Errorf("compare password error: %w", err)
+		return models.User{}, fmt.Errorf("compare password error: %w", err)
+	}
+
+	if u.Disabled {
+		return models.User{}, models.ErrUserDisabled
 	}
 
-	t, err := jwtauth.GetToken(u, a.cfg.TokenMaxTime, a.cfg.Secret)
+	return u, nil
+}
+
+// Refresh обменивает refresh-токен на новую пару токенов.
+func (a LoginUserUsecase) Refresh(ctx context.Context, refreshToken string) (models.TokenPair, error) {
+	hash := hashToken(refreshToken)
+
+	stored, err := a.tokens.GetRefreshToken(ctx, hash)
 	if err != nil {
-		return "", fmt.Errorf("get token error: %w", err)
+		if errors.Is(err, models.ErrNotFound) {
+			return models.TokenPair{}, models.ErrInvalidRefresh
+		}
+
+		return models.TokenPair{}, fmt.Errorf("get refresh token error: %w", err)
+	}
+
+	if !stored.RevokedAt.IsZero() {
+		return models.TokenPair{}, a.revokeFamily(ctx, stored.Family)
+	}
+
+	if time.Now().After(stored.ExpiresAt) {
+		return models.TokenPair{}, fmt.Errorf("%w: expired", models.ErrInvalidRefresh)
+	}
+
+	u, err := a.db.GetUser(ctx, stored.Username)
+	if err != nil {
+		return models.TokenPair{}, fmt.Errorf("get user error %w", err)
+	}
+
+	if u.Disabled {
+		return models.TokenPair{}, models.ErrUserDisabled
 	}
 
-	return t, nil
+	refresh, next, err := a.newRefreshToken(u.Username, stored.Family)
+	if err != nil {
+		return models.TokenPair{}, err
+	}
+
+	if err := a.tokens.RotateRefreshToken(ctx, hash, next); err != nil {
+		// токен заменили между чтением и ротацией: это тоже повторное использование.
+		if errors.Is(err, models.ErrTokenRevoked) {
+			return models.TokenPair{}, a.revokeFamily(ctx, stored.Family)
+		}
+
+		return models.TokenPair{}, fmt.Errorf("rotate refresh token error: %w", err)
+	}
+
+	return a.tokenPair(u, refresh)
+}
+
+// Logout отзывает access-токен пользователя p и, если передан refreshToken
+// этого пользователя, всю его цепочку. Чужой refresh-токен отклоняется
+// до отзыва, чтобы ошибка не оставляла выход сделанным наполовину.
+func (a LoginUserUsecase) Logout(ctx context.Context, p models.Principal, refreshToken string,
+) (err error) { //nolint:nonamedreturns
+	defer func() {
+		a.audit.Record(ctx, auditEntry(models.AuditLogout, p.Username, ""), err)
+	}()
+
+	var family string
+
+	if refreshToken != "" {
+		stored, err := a.tokens.GetRefreshToken(ctx, hashToken(refreshToken))
+		if err != nil {
+			if errors.Is(err, models.ErrNotFound) {
+				return models.ErrInvalidRefresh
+			}
+
+			return fmt.Errorf("get refresh token error: %w", err)
+		}
+
+		if stored.Username != p.Username {
+			return models.ErrInvalidRefresh
+		}
+
+		family = stored.Family
+	}
+
+	// после истечения токен не пройдет проверку и так, поэтому дольше
+	// хранить его в списке отозванных незачем.
+	if err := a.tokens.RevokeToken(ctx, p.TokenID, p.TokenExpiresAt); err != nil {
+		return fmt.Errorf("revoke token error: %w", err)
+	}
+
+	if family == "" {
+		return nil
+	}
+
+	if err := a.tokens.RevokeRefreshFamily(ctx, family); err != nil {
+		return fmt.Errorf("revoke refresh tokens error: %w", err)
+	}
+
+	return nil
+}
+
+func (a LoginUserUsecase) revokeFamily(ctx context.Context, family string) error {
+	if err := a.tokens.RevokeRefreshFamily(ctx, family); err != nil {
+		return fmt.Errorf("revoke refresh tokens error: %w", err)
+	}
+
+	return models.ErrRefreshReused
+}
+
+func (a LoginUserUsecase) tokenPair(u models.User, refresh string) (models.TokenPair, error) {
+	t, err := a.signer.Sign(u, a.cfg.TokenMaxTime)
+	if err != nil {
+		return models.TokenPair{}, fmt.Errorf("get token error: %w", err)
+	}
+
+	return models.TokenPair{
+		AccessToken:  t,
+		RefreshToken: refresh,
+		ExpiresIn:    a.cfg.TokenMaxTime,
+	}, nil
+}
+
+// newRefreshToken возвращает новый refresh-токен и его запись для хранилища.
+func (a LoginUserUsecase) newRefreshToken(username, family string) (string, models.RefreshToken, error) {
+	token, err := randomToken()
+	if err != nil {
+		return "", models.RefreshToken{}, err
+	}
+
+	return token, models.RefreshToken{
+		Hash:      hashToken(token),
+		Username:  username,
+		Family:    family,
+		ExpiresAt: time.Now().Add(a.cfg.RefreshTokenMaxTime),
+		RevokedAt: time.Time{},
+		CreatedAt: time.Time{},
+	}, nil
+}
+
+func randomToken() (string, error) {
+	b := make([]byte, refreshTokenBytes)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("generate token error: %w", err)
+	}
+
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// hashToken — хэш, под которым refresh-токен хранится: утечка таблицы
+// не дает готовых токенов. Токен случайный, поэтому соль не нужна.
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+
+	return hex.EncodeToString(sum[:])
 }
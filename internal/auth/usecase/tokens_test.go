@@ -0,0 +1,117 @@
+package usecase_test
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/Leopold1975/yadro_app/internal/auth/database/memorydb"
+	"github.com/Leopold1975/yadro_app/internal/auth/models"
+	"github.com/Leopold1975/yadro_app/internal/auth/usecase"
+	"github.com/Leopold1975/yadro_app/pkg/logger"
+	"github.com/stretchr/testify/require"
+)
+
+// revocations запоминает, до какого времени отозван каждый access-токен.
+type revocations struct {
+	*memorydb.UserRepo
+	expires map[string]time.Time
+}
+
+func (r revocations) RevokeToken(ctx context.Context, jti string, expiresAt time.Time) error {
+	r.expires[jti] = expiresAt
+
+	return r.UserRepo.RevokeToken(ctx, jti, expiresAt) //nolint:wrapcheck
+}
+
+func TestRefresh(t *testing.T) {
+	ctx := context.Background()
+	db := newUserRepo()
+	audit := usecase.NewAudit(db, logger.New("error"))
+	users := usecase.NewUsers(authCfg, db, db, audit)
+	login := usecase.NewLoginUser(authCfg, db, db, db, signer, audit)
+	auth := usecase.NewAuthUser(db, db, db, signer)
+
+	_, err := users.Create(ctx, "user1", "User-password1", "")
+	require.NoError(t, err)
+
+	first, err := login.Login(ctx, "user1", "User-password1", testIP)
+	require.NoError(t, err)
+	require.NotEmpty(t, first.RefreshToken)
+	require.Equal(t, authCfg.TokenMaxTime, first.ExpiresIn)
+
+	second, err := login.Refresh(ctx, first.RefreshToken)
+	require.NoError(t, err)
+	require.NotEqual(t, first.RefreshToken, second.RefreshToken)
+
+	p, err := auth.Auth(ctx, second.AccessToken)
+	require.NoError(t, err)
+	require.Equal(t, "user1", p.Username)
+
+	_, err = login.Refresh(ctx, "unknown")
+	require.ErrorIs(t, err, models.ErrInvalidRefresh)
+
+	// повторное использование замененного токена отзывает всю цепочку,
+	// включая выданный при ротации.
+	_, err = login.Refresh(ctx, first.RefreshToken)
+	require.ErrorIs(t, err, models.ErrRefreshReused)
+
+	_, err = login.Refresh(ctx, second.RefreshToken)
+	require.ErrorIs(t, err, models.ErrRefreshReused)
+
+	// смена пароля отзывает refresh-токены других сессий.
+	third, err := login.Login(ctx, "user1", "User-password1", testIP)
+	require.NoError(t, err)
+	require.NoError(t, users.ChangePassword(ctx, "user1", "User-password1", "New-password1"))
+
+	_, err = login.Refresh(ctx, third.RefreshToken)
+	require.ErrorIs(t, err, models.ErrRefreshReused)
+}
+
+func TestLogout(t *testing.T) {
+	ctx := context.Background()
+	db := newUserRepo()
+	audit := usecase.NewAudit(db, logger.New("error"))
+	tokens := revocations{UserRepo: db, expires: make(map[string]time.Time)}
+	users := usecase.NewUsers(authCfg, db, tokens, audit)
+	login := usecase.NewLoginUser(authCfg, db, tokens, db, signer, audit)
+	auth := usecase.NewAuthUser(db, tokens, db, signer)
+
+	_, err := users.Create(ctx, "user1", "User-password1", "")
+	require.NoError(t, err)
+
+	_, err = users.Create(ctx, "user2", "User-password2", "")
+	require.NoError(t, err)
+
+	tp, err := login.Login(ctx, "user1", "User-password1", testIP)
+	require.NoError(t, err)
+
+	other, err := login.Login(ctx, "user2", "User-password2", testIP)
+	require.NoError(t, err)
+
+	p, err := auth.Auth(ctx, tp.AccessToken)
+	require.NoError(t, err)
+
+	require.False(t, p.TokenExpiresAt.IsZero())
+
+	// чужой refresh-токен отклоняется, и access-токен остается действительным.
+	err = login.Logout(ctx, p, other.RefreshToken)
+	require.ErrorIs(t, err, models.ErrInvalidRefresh)
+
+	_, err = auth.Auth(ctx, tp.AccessToken)
+	require.NoError(t, err)
+
+	require.NoError(t, login.Logout(ctx, p, tp.RefreshToken))
+
+	// токен хранится в списке отозванных до своего истечения, а не до now+TokenMaxTime.
+	require.Equal(t, p.TokenExpiresAt, tokens.expires[p.TokenID])
+
+	_, err = auth.Auth(ctx, tp.AccessToken)
+	require.ErrorIs(t, err, models.ErrTokenRevoked)
+
+	_, err = login.Refresh(ctx, tp.RefreshToken)
+	require.ErrorIs(t, err, models.ErrRefreshReused)
+
+	_, err = login.Refresh(ctx, other.RefreshToken)
+	require.NoError(t, err)
+}
@@ -0,0 +1,350 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"regexp"
+	"slices"
+	"strconv"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/Leopold1975/yadro_app/internal/auth/models"
+	"github.com/Leopold1975/yadro_app/internal/pkg/config"
+	"golang.org/x/crypto/bcrypt"
+)
+
+// bcrypt учитывает только первые 72 байта пароля, поэтому более длинные
+// пароли отвергаются, а не обрезаются незаметно для пользователя.
+const maxPasswordBytes = 72
+
+// usernameRe — допустимые имена: до 32 символов, как колонка users.username.
+var usernameRe = regexp.MustCompile(`^[a-zA-Z0-9_.-]{1,32}$`) //nolint:gochecknoglobals
+
+// UsersUsecase управляет пользователями. Последнего активного администратора —
+// пользователя, чья роль дает models.PermUsersManage, — нельзя удалить, отключить
+// или перевести в роль без этого разрешения, чтобы не потерять управление пользователями.
+// Смена пароля и отключение отзывают refresh-токены пользователя.
+// Изменения записываются в журнал аудита.
+type UsersUsecase struct {
+	db     Storage
+	tokens TokenStorage
+	audit  AuditUsecase
+	policy config.PasswordPolicy
+}
+
+func NewUsers(cfg config.Auth, db Storage, tokens TokenStorage, audit AuditUsecase) UsersUsecase {
+	return UsersUsecase{
+		db:     db,
+		tokens: tokens,
+		audit:  audit,
+		policy: cfg.PasswordPolicy,
+	}
+}
+
+// Create создает пользователя с ролью role, пустая роль означает user.
+func (u UsersUsecase) Create(ctx context.Context, username, password string, role models.Role,
+) (_ models.User, err error) { //nolint:nonamedreturns
+	defer func() {
+		u.audit.Record(ctx, auditEntry(models.AuditUserCreate, username, "role="+string(role)), err)
+	}()
+
+	if !usernameRe.MatchString(username) {
+		return models.User{}, fmt.Errorf("%w: %q", models.ErrInvalidUsername, username)
+	}
+
+	if role == "" {
+		role = models.UserRole
+	}
+
+	if err := u.checkRole(ctx, role); err != nil {
+		return models.User{}, err
+	}
+
+	hash, err := u.hashPassword(password)
+	if err != nil {
+		return models.User{}, err
+	}
+
+	user := models.User{ //nolint:exhaustruct
+		Username:     username,
+		PasswordHash: hash,
+		Role:         role,
+	}
+
+	if err := u.db.CreateUser(ctx, user); err != nil {
+		return models.User{}, fmt.Errorf("create user error: %w", err)
+	}
+
+	created, err := u.db.GetUser(ctx, username)
+	if err != nil {
+		return models.User{}, fmt.Errorf("get user error: %w", err)
+	}
+
+	return created, nil
+}
+
+func (u UsersUsecase) List(ctx context.Context) ([]models.User, error) {
+	users, err := u.db.ListUsers(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("list users error: %w", err)
+	}
+
+	return users, nil
+}
+
+func (u UsersUsecase) SetRole(ctx context.Context, username string, role models.Role) error {
+	return u.Update(ctx, username, &role, nil)
+}
+
+func (u UsersUsecase) SetDisabled(ctx context.Context, username string, disabled bool) error {
+	return u.Update(ctx, username, nil, &disabled)
+}
+
+// Update меняет роль и блокировку пользователя; nil означает, что поле не меняется.
+// Оба изменения проверяются до применения любого из них, поэтому недопустимое
+// изменение одного поля не оставляет примененным другое.
+func (u UsersUsecase) Update(ctx context.Context, username string, role *models.Role, disabled *bool) error {
+	err := u.checkUpdate(ctx, username, role, disabled)
+
+	if role != nil {
+		if err == nil {
+			if err = u.db.UpdateRole(ctx, username, *role); err != nil {
+				err = fmt.Errorf("update role error: %w", err)
+			}
+		}
+
+		u.audit.Record(ctx, auditEntry(models.AuditUserSetRole, username, "role="+string(*role)), err)
+	}
+
+	if disabled != nil {
+		if err == nil {
+			err = u.setDisabled(ctx, username, *disabled)
+		}
+
+		u.audit.Record(ctx, auditEntry(models.AuditUserDisable, username,
+			"disabled="+strconv.FormatBool(*disabled)), err)
+	}
+
+	return err
+}
+
+// checkUpdate проверяет роль и то, что после изменения останется активный
+// пользователь с правом users:manage.
+func (u UsersUsecase) checkUpdate(ctx context.Context, username string, role *models.Role, disabled *bool) error {
+	if role != nil {
+		if err := u.checkRole(ctx, *role); err != nil {
+			return err
+		}
+	}
+
+	switch {
+	case disabled != nil && *disabled:
+		return u.checkNotLastAdmin(ctx, username, "")
+	case role != nil:
+		return u.checkNotLastAdmin(ctx, username, *role)
+	default:
+		return nil
+	}
+}
+
+func (u UsersUsecase) setDisabled(ctx context.Context, username string, disabled bool) error {
+	if err := u.db.SetDisabled(ctx, username, disabled); err != nil {
+		return fmt.Errorf("set disabled error: %w", err)
+	}
+
+	if !disabled {
+		return nil
+	}
+
+	if err := u.tokens.RevokeUserRefreshTokens(ctx, username); err != nil {
+		return fmt.Errorf("revoke refresh tokens error: %w", err)
+	}
+
+	return nil
+}
+
+func (u UsersUsecase) Delete(ctx context.Context, username string) (err error) { //nolint:nonamedreturns
+	defer func() {
+		u.audit.Record(ctx, auditEntry(models.AuditUserDelete, username, ""), err)
+	}()
+
+	if err := u.checkNotLastAdmin(ctx, username, ""); err != nil {
+		return err
+	}
+
+	if err := u.db.DeleteUser(ctx, username); err != nil {
+		return fmt.Errorf("delete user error: %w", err)
+	}
+
+	return nil
+}
+
+// ChangePassword меняет пароль пользователя, если oldPassword совпадает с текущим.
+func (u UsersUsecase) ChangePassword(ctx context.Context, username, oldPassword, newPassword string,
+) (err error) { //nolint:nonamedreturns
+	defer func() {
+		u.audit.Record(ctx, auditEntry(models.AuditUserPassword, username, ""), err)
+	}()
+
+	user, err := u.db.GetUser(ctx, username)
+	if err != nil {
+		return fmt.Errorf("get user error: %w", err)
+	}
+
+	err = bcrypt.CompareHashAndPassword([]byte(user.PasswordHash), []byte(oldPassword))
+	if err != nil {
+		if errors.Is(err, bcrypt.ErrMismatchedHashAndPassword) {
+			return models.ErrWrongPassword
+		}
+
+		return fmt.Errorf("compare password error: %w", err)
+	}
+
+	hash, err := u.hashPassword(newPassword)
+	if err != nil {
+		return err
+	}
+
+	if err := u.db.UpdatePassword(ctx, username, hash); err != nil {
+		return fmt.Errorf("update password error: %w", err)
+	}
+
+	if err := u.tokens.RevokeUserRefreshTokens(ctx, username); err != nil {
+		return fmt.Errorf("revoke refresh tokens error: %w", err)
+	}
+
+	return nil
+}
+
+// ValidatePassword проверяет пароль на соответствие политике.
+func (u UsersUsecase) ValidatePassword(password string) error {
+	if n := utf8.RuneCountInString(password); n < u.policy.MinLength {
+		return fmt.Errorf("%w: at least %d characters required, got %d", models.ErrWeakPassword, u.policy.MinLength, n)
+	}
+
+	if len(password) > maxPasswordBytes {
+		return fmt.Errorf("%w: longer than %d bytes", models.ErrWeakPassword, maxPasswordBytes)
+	}
+
+	var lower, upper, digit, other bool
+
+	for _, r := range password {
+		switch {
+		case unicode.IsLower(r):
+			lower = true
+		case unicode.IsUpper(r):
+			upper = true
+		case unicode.IsDigit(r):
+			digit = true
+		default:
+			other = true
+		}
+	}
+
+	classes := 0
+
+	for _, ok := range []bool{lower, upper, digit, other} {
+		if ok {
+			classes++
+		}
+	}
+
+	if classes < u.policy.MinClasses {
+		return fmt.Errorf("%w: at least %d of lowercase, uppercase, digits and other characters required",
+			models.ErrWeakPassword, u.policy.MinClasses)
+	}
+
+	return nil
+}
+
+func (u UsersUsecase) hashPassword(password string) (string, error) {
+	if err := u.ValidatePassword(password); err != nil {
+		return "", err
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.DefaultCost)
+	if err != nil {
+		return "", fmt.Errorf("hash password error: %w", err)
+	}
+
+	return string(hash), nil
+}
+
+// checkRole возвращает models.ErrInvalidRole, если роли нет в хранилище.
+func (u UsersUsecase) checkRole(ctx context.Context, role models.Role) error {
+	if _, err := u.db.GetPermissions(ctx, role); err != nil {
+		if errors.Is(err, models.ErrInvalidRole) {
+			return fmt.Errorf("%w: %q", models.ErrInvalidRole, role)
+		}
+
+		return fmt.Errorf("get permissions error: %w", err)
+	}
+
+	return nil
+}
+
+// checkNotLastAdmin возвращает models.ErrLastAdmin, если username — единственный
+// активный пользователь с models.PermUsersManage, а его новая роль next (пустая
+// при отключении и удалении) этого разрешения не дает. Проверка и изменение
+// не атомарны: одновременное отключение двух последних администраторов разными
+// запросами не предотвращается.
+func (u UsersUsecase) checkNotLastAdmin(ctx context.Context, username string, next models.Role) error {
+	managers := make(map[models.Role]bool)
+
+	canManage := func(role models.Role) (bool, error) {
+		if can, ok := managers[role]; ok {
+			return can, nil
+		}
+
+		perms, err := u.db.GetPermissions(ctx, role)
+		if err != nil && !errors.Is(err, models.ErrInvalidRole) {
+			return false, fmt.Errorf("get permissions error: %w", err)
+		}
+
+		managers[role] = slices.Contains(perms, models.PermUsersManage)
+
+		return managers[role], nil
+	}
+
+	if next != "" {
+		if can, err := canManage(next); err != nil || can {
+			return err
+		}
+	}
+
+	users, err := u.db.ListUsers(ctx)
+	if err != nil {
+		return fmt.Errorf("list users error: %w", err)
+	}
+
+	target, others := false, 0
+
+	for _, user := range users {
+		if user.Disabled {
+			continue
+		}
+
+		can, err := canManage(user.Role)
+		if err != nil {
+			return err
+		}
+
+		if !can {
+			continue
+		}
+
+		if user.Username == username {
+			target = true
+		} else {
+			others++
+		}
+	}
+
+	if target && others == 0 {
+		return models.ErrLastAdmin
+	}
+
+	return nil
+}
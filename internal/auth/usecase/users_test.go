@@ -0,0 +1,191 @@
+package usecase_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/Leopold1975/yadro_app/internal/auth/database/memorydb"
+	"github.com/Leopold1975/yadro_app/internal/auth/models"
+	"github.com/Leopold1975/yadro_app/internal/auth/usecase"
+	"github.com/Leopold1975/yadro_app/internal/pkg/config"
+	"github.com/Leopold1975/yadro_app/internal/pkg/jwtauth"
+	"github.com/Leopold1975/yadro_app/pkg/logger"
+	"github.com/stretchr/testify/require"
+)
+
+// newUserRepo возвращает хранилище пользователей с ролями auditor без разрешений
+// и manager, которая, как и admin, дает users:manage.
+func newUserRepo() *memorydb.UserRepo {
+	db := memorydb.New()
+	db.SetRolePermissions("auditor", nil)
+	db.SetRolePermissions("manager", []models.Permission{models.PermSearchRead, models.PermUsersManage})
+
+	return &db
+}
+
+var authCfg = config.Auth{ //nolint:exhaustruct
+	Secret:              "secret",
+	TokenMaxTime:        time.Minute,
+	RefreshTokenMaxTime: time.Hour,
+	PasswordPolicy:      config.PasswordPolicy{MinLength: 10, MinClasses: 3},
+}
+
+var signer = jwtauth.NewHMAC(authCfg.Secret) //nolint:gochecknoglobals
+
+func TestValidatePassword(t *testing.T) {
+	db := newUserRepo()
+	audit := usecase.NewAudit(db, logger.New("error"))
+	users := usecase.NewUsers(authCfg, db, db, audit)
+
+	require.NoError(t, users.ValidatePassword("Correct-horse1"))
+	require.NoError(t, users.ValidatePassword("correcthorse-1"))
+	require.ErrorIs(t, users.ValidatePassword("Short1!"), models.ErrWeakPassword)
+	require.ErrorIs(t, users.ValidatePassword("onlylowercase"), models.ErrWeakPassword)
+	require.ErrorIs(t, users.ValidatePassword("Aa1"+strings.Repeat("x", 70)), models.ErrWeakPassword)
+}
+
+func TestUsers(t *testing.T) {
+	ctx := context.Background()
+	db := newUserRepo()
+	audit := usecase.NewAudit(db, logger.New("error"))
+	users := usecase.NewUsers(authCfg, db, db, audit)
+	login := usecase.NewLoginUser(authCfg, db, db, db, signer, audit)
+
+	admin, err := users.Create(ctx, "admin", "Admin-password1", models.AdminRole)
+	require.NoError(t, err)
+	require.Equal(t, models.AdminRole, admin.Role)
+
+	u, err := users.Create(ctx, "user1", "User-password1", "")
+	require.NoError(t, err)
+	require.Equal(t, models.UserRole, u.Role)
+
+	_, err = users.Create(ctx, "user1", "User-password1", "")
+	require.ErrorIs(t, err, models.ErrUserExists)
+
+	_, err = users.Create(ctx, "bad name", "User-password1", "")
+	require.ErrorIs(t, err, models.ErrInvalidUsername)
+
+	_, err = users.Create(ctx, "user2", "User-password1", "root")
+	require.ErrorIs(t, err, models.ErrInvalidRole)
+
+	// последнего администратора нельзя отключить, понизить или удалить.
+	require.ErrorIs(t, users.SetDisabled(ctx, "admin", true), models.ErrLastAdmin)
+	require.ErrorIs(t, users.SetRole(ctx, "admin", models.UserRole), models.ErrLastAdmin)
+	require.ErrorIs(t, users.Delete(ctx, "admin"), models.ErrLastAdmin)
+
+	require.NoError(t, users.SetRole(ctx, "user1", models.AdminRole))
+	require.NoError(t, users.SetDisabled(ctx, "admin", true))
+
+	_, err = login.Login(ctx, "admin", "Admin-password1", testIP)
+	require.ErrorIs(t, err, models.ErrUserDisabled)
+
+	require.ErrorIs(t, users.ChangePassword(ctx, "user1", "wrong", "New-password1"), models.ErrWrongPassword)
+	require.ErrorIs(t, users.ChangePassword(ctx, "user1", "User-password1", "weak"), models.ErrWeakPassword)
+	require.NoError(t, users.ChangePassword(ctx, "user1", "User-password1", "New-password1"))
+
+	_, err = login.Login(ctx, "user1", "New-password1", testIP)
+	require.NoError(t, err)
+
+	require.NoError(t, users.Delete(ctx, "admin"))
+	require.ErrorIs(t, users.Delete(ctx, "admin"), models.ErrNotFound)
+
+	list, err := users.List(ctx)
+	require.NoError(t, err)
+	require.Len(t, list, 1)
+}
+
+func TestPermissions(t *testing.T) {
+	ctx := context.Background()
+	db := newUserRepo()
+	audit := usecase.NewAudit(db, logger.New("error"))
+	users := usecase.NewUsers(authCfg, db, db, audit)
+	login := usecase.NewLoginUser(authCfg, db, db, db, signer, audit)
+	auth := usecase.NewAuthUser(db, db, db, signer)
+
+	_, err := users.Create(ctx, "admin", "Admin-password1", models.AdminRole)
+	require.NoError(t, err)
+
+	_, err = users.Create(ctx, "user1", "User-password1", "")
+	require.NoError(t, err)
+
+	tp, err := login.Login(ctx, "user1", "User-password1", testIP)
+	require.NoError(t, err)
+
+	p, err := auth.Auth(ctx, tp.AccessToken)
+	require.NoError(t, err)
+	require.True(t, p.Can(models.PermSearchRead))
+	require.False(t, p.Can(models.PermUsersManage))
+
+	// роль из хранилища действует сразу, без нового токена.
+	require.NoError(t, users.SetRole(ctx, "user1", "auditor"))
+
+	p, err = auth.Auth(ctx, tp.AccessToken)
+	require.NoError(t, err)
+	require.Equal(t, models.Role("auditor"), p.Role)
+	require.False(t, p.Can(models.PermSearchRead))
+
+	require.ErrorIs(t, users.SetRole(ctx, "user1", "root"), models.ErrInvalidRole)
+}
+
+func TestLastAdminByPermission(t *testing.T) {
+	ctx := context.Background()
+	db := newUserRepo()
+	audit := usecase.NewAudit(db, logger.New("error"))
+	users := usecase.NewUsers(authCfg, db, db, audit)
+
+	_, err := users.Create(ctx, "admin", "Admin-password1", models.AdminRole)
+	require.NoError(t, err)
+
+	_, err = users.Create(ctx, "manager", "Manager-password1", "manager")
+	require.NoError(t, err)
+
+	// администратором считается любой, чья роль дает users:manage, а не только роль admin.
+	require.NoError(t, users.SetRole(ctx, "admin", models.UserRole))
+	require.ErrorIs(t, users.SetDisabled(ctx, "manager", true), models.ErrLastAdmin)
+	require.ErrorIs(t, users.SetRole(ctx, "manager", "auditor"), models.ErrLastAdmin)
+	require.ErrorIs(t, users.Delete(ctx, "manager"), models.ErrLastAdmin)
+
+	// роль, которая тоже дает users:manage, не лишает доступа.
+	require.NoError(t, users.SetRole(ctx, "manager", models.AdminRole))
+	require.NoError(t, users.SetRole(ctx, "manager", "manager"))
+}
+
+func TestUpdateUser(t *testing.T) {
+	ctx := context.Background()
+	db := newUserRepo()
+	audit := usecase.NewAudit(db, logger.New("error"))
+	users := usecase.NewUsers(authCfg, db, db, audit)
+
+	_, err := users.Create(ctx, "admin", "Admin-password1", models.AdminRole)
+	require.NoError(t, err)
+
+	_, err = users.Create(ctx, "user1", "User-password1", "")
+	require.NoError(t, err)
+
+	role, disabled := models.Role("manager"), true
+
+	// допустимая сама по себе роль не применяется, если нельзя отключить пользователя.
+	require.ErrorIs(t, users.Update(ctx, "admin", &role, &disabled), models.ErrLastAdmin)
+
+	admin, err := db.GetUser(ctx, "admin")
+	require.NoError(t, err)
+	require.Equal(t, models.AdminRole, admin.Role)
+	require.False(t, admin.Disabled)
+
+	// и отключение не применяется, если роль недопустима.
+	invalid := models.Role("root")
+	require.ErrorIs(t, users.Update(ctx, "user1", &invalid, &disabled), models.ErrInvalidRole)
+
+	u, err := db.GetUser(ctx, "user1")
+	require.NoError(t, err)
+	require.False(t, u.Disabled)
+
+	require.NoError(t, users.Update(ctx, "user1", &role, &disabled))
+
+	u, err = db.GetUser(ctx, "user1")
+	require.NoError(t, err)
+	require.Equal(t, role, u.Role)
+	require.True(t, u.Disabled)
+}
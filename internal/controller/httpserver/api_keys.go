@@ -0,0 +1,113 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	user "github.com/Leopold1975/yadro_app/internal/auth/models"
+	auth "github.com/Leopold1975/yadro_app/internal/auth/usecase"
+)
+
+var ErrInvalidExpiresIn = errors.New("expiresIn must be a positive duration")
+
+// issueAPIKeyHandler выдает ключ и отвечает 201 с самим ключом. Ключ показывается
+// один раз: хранилище знает только его хэш.
+func issueAPIKeyHandler(apiKeys auth.APIKeysUsecase) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		var req CreateAPIKeyRequest
+
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, fmt.Errorf("decode error %w", err), http.StatusBadRequest)
+
+			return
+		}
+
+		var ttl time.Duration
+
+		if req.ExpiresIn != "" {
+			d, err := time.ParseDuration(req.ExpiresIn)
+			if err != nil || d <= 0 {
+				writeError(w, fmt.Errorf("%w: %q", ErrInvalidExpiresIn, req.ExpiresIn), http.StatusBadRequest)
+
+				return
+			}
+
+			ttl = d
+		}
+
+		p, ok := user.PrincipalFrom(r.Context())
+		if !ok {
+			writeError(w, fmt.Errorf("unexpected principal type"), http.StatusInternalServerError) //nolint:goerr113,perfsprint
+
+			return
+		}
+
+		if req.Owner == "" {
+			req.Owner = p.Username
+		}
+
+		scopes := make([]user.Permission, 0, len(req.Scopes))
+		for _, s := range req.Scopes {
+			scopes = append(scopes, user.Permission(s))
+		}
+
+		key, k, err := apiKeys.Issue(r.Context(), p, req.Owner, req.Name, scopes, ttl)
+		if err != nil {
+			writeUserError(w, err)
+
+			return
+		}
+
+		w.WriteHeader(http.StatusCreated)
+
+		resp := IssuedAPIKeyResponse{Key: key, APIKeyResponse: toAPIKeyResponse(k)}
+
+		if err := json.NewEncoder(w).Encode(resp); err != nil {
+			writeError(w, err, http.StatusInternalServerError)
+		}
+	}
+}
+
+func listAPIKeysHandler(apiKeys auth.APIKeysUsecase) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		keys, err := apiKeys.List(r.Context())
+		if err != nil {
+			writeError(w, err, http.StatusInternalServerError)
+
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(toAPIKeysResponse(keys)); err != nil {
+			writeError(w, err, http.StatusInternalServerError)
+		}
+	}
+}
+
+func revokeAPIKeyHandler(apiKeys auth.APIKeysUsecase) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		id, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil {
+			writeError(w, fmt.Errorf("parse id error %w", err), http.StatusBadRequest)
+
+			return
+		}
+
+		if err := apiKeys.Revoke(r.Context(), id); err != nil {
+			writeUserError(w, err)
+
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
@@ -0,0 +1,82 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	user "github.com/Leopold1975/yadro_app/internal/auth/models"
+	auth "github.com/Leopold1975/yadro_app/internal/auth/usecase"
+)
+
+var ErrInvalidTime = errors.New("time must be in RFC 3339 format")
+
+// auditHandler отвечает записями журнала аудита, новыми первыми. Параметры from и to
+// (RFC 3339) задают полуинтервал [from, to), actor и action отбирают записи
+// пользователя и вида действия, limit и offset — страницу.
+func auditHandler(audit auth.AuditUsecase) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		f, err := parseAuditFilter(r)
+		if err != nil {
+			writeError(w, err, http.StatusBadRequest)
+
+			return
+		}
+
+		entries, err := audit.List(r.Context(), f)
+		if err != nil {
+			if errors.Is(err, auth.ErrInvalidTimeRange) {
+				writeError(w, err, http.StatusBadRequest)
+
+				return
+			}
+
+			writeError(w, err, http.StatusInternalServerError)
+
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(toAuditResponse(entries)); err != nil {
+			writeError(w, err, http.StatusInternalServerError)
+		}
+	}
+}
+
+func parseAuditFilter(r *http.Request) (user.AuditFilter, error) {
+	page, err := parsePage(r)
+	if err != nil {
+		return user.AuditFilter{}, err
+	}
+
+	f := user.AuditFilter{
+		From:   time.Time{},
+		To:     time.Time{},
+		Actor:  r.FormValue("actor"),
+		Action: user.AuditAction(r.FormValue("action")),
+		Limit:  page.Limit,
+		Offset: page.Offset,
+	}
+
+	for _, p := range []struct {
+		name string
+		dst  *time.Time
+	}{{"from", &f.From}, {"to", &f.To}} {
+		v := r.FormValue(p.name)
+		if v == "" {
+			continue
+		}
+
+		t, err := time.Parse(time.RFC3339, v)
+		if err != nil {
+			return user.AuditFilter{}, fmt.Errorf("%w: %s=%q", ErrInvalidTime, p.name, v)
+		}
+
+		*p.dst = t
+	}
+
+	return f, nil
+}
@@ -1,7 +1,6 @@
 package middlewares
 
 import (
-	"context"
 	"fmt"
 	"net/http"
 	"strings"
@@ -10,41 +9,72 @@ import (
 	"github.com/Leopold1975/yadro_app/internal/auth/usecase"
 )
 
-func AuthMidleware(next http.Handler, auth usecase.AuthUserUsecase) http.Handler {
+// AccessPolicy сообщает, какое разрешение требует запрос и нужна ли для него аутентификация.
+type AccessPolicy interface {
+	Access(r *http.Request) (perm models.Permission, public bool)
+}
+
+// AuthMidleware аутентифицирует запросы к непубличным маршрутам policy по JWT или
+// API-ключу и отвечает 403, если у пользователя нет требуемого маршрутом разрешения.
+func AuthMidleware(next http.Handler, auth usecase.AuthUserUsecase, policy AccessPolicy) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if r.URL.Path == "/login" {
+		perm, public := policy.Access(r)
+		if public {
 			next.ServeHTTP(w, r)
 
 			return
 		}
 
-		tokenBearer := r.Header.Get("Authorization")
-
-		if tokenBearer == "" {
-			http.Error(w, "missing Authorization Header", http.StatusUnauthorized)
-
+		token, ok := requestToken(w, r)
+		if !ok {
 			return
 		}
 
-		s := strings.Split(tokenBearer, " ")
-		if len(s) < 2 { //nolint:gomnd
-			http.Error(w, "invalid bearer token", http.StatusBadRequest)
+		p, err := auth.Auth(r.Context(), token)
+		if err != nil {
+			http.Error(w, fmt.Errorf("auth error %w", err).Error(), http.StatusUnauthorized)
 
 			return
 		}
 
-		token := s[1]
-
-		role, err := auth.Auth(r.Context(), token)
-		if err != nil {
-			http.Error(w, fmt.Errorf("auth error %w", err).Error(), http.StatusUnauthorized)
+		if perm != "" && !p.Can(perm) {
+			http.Error(w, fmt.Sprintf("permission %s required", perm), http.StatusForbidden)
 
 			return
 		}
 
-		ctxR := context.WithValue(r.Context(), models.RoleKey, models.Role(role))
-		r = r.WithContext(ctxR)
+		if info := models.RequestInfoFrom(r.Context()); info != nil {
+			info.Principal = p
+		}
+
+		r = r.WithContext(models.WithPrincipal(r.Context(), p))
 
 		next.ServeHTTP(w, r)
 	})
 }
+
+// requestToken возвращает API-ключ из заголовка X-API-Key или токен из Authorization.
+// API-ключ можно передать и в Authorization: Bearer, он отличается по префиксу.
+// Возвращает false, если ответ уже отправлен.
+func requestToken(w http.ResponseWriter, r *http.Request) (string, bool) {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key, true
+	}
+
+	tokenBearer := r.Header.Get("Authorization")
+
+	if tokenBearer == "" {
+		http.Error(w, "missing Authorization Header", http.StatusUnauthorized)
+
+		return "", false
+	}
+
+	s := strings.Split(tokenBearer, " ")
+	if len(s) < 2 { //nolint:gomnd
+		http.Error(w, "invalid bearer token", http.StatusBadRequest)
+
+		return "", false
+	}
+
+	return s[1], true
+}
@@ -0,0 +1,175 @@
+package middlewares_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/Leopold1975/yadro_app/internal/auth/database/memorydb"
+	"github.com/Leopold1975/yadro_app/internal/auth/models"
+	auth "github.com/Leopold1975/yadro_app/internal/auth/usecase"
+	"github.com/Leopold1975/yadro_app/internal/controller/httpserver"
+	"github.com/Leopold1975/yadro_app/internal/controller/httpserver/middlewares"
+	"github.com/Leopold1975/yadro_app/internal/pkg/config"
+	"github.com/Leopold1975/yadro_app/internal/pkg/jwtauth"
+	"github.com/Leopold1975/yadro_app/internal/usecase"
+	"github.com/Leopold1975/yadro_app/pkg/logger"
+	"github.com/stretchr/testify/require"
+)
+
+var authCfg = config.Auth{ //nolint:exhaustruct,gochecknoglobals
+	Secret:              "secret",
+	TokenMaxTime:        time.Minute,
+	RefreshTokenMaxTime: time.Hour,
+	PasswordPolicy:      config.PasswordPolicy{MinLength: 10, MinClasses: 3},
+}
+
+// newRoutes возвращает маршруты API с пустыми usecase комиксов: обработчики
+// маршрутов в тесте не вызываются, нужны только их разрешения.
+func newRoutes(login auth.LoginUserUsecase, users auth.UsersUsecase, apiKeys auth.APIKeysUsecase,
+	keys *jwtauth.KeySet, audit auth.AuditUsecase,
+) *httpserver.Router {
+	var (
+		find    usecase.FindComicsUsecase
+		image   usecase.ComicsImageUsecase
+		jobs    usecase.UpdateJobsUsecase
+		refresh usecase.BackgroundRefreshUsecase
+		reindex usecase.ReindexUsecase
+		check   usecase.IndexCheckUsecase
+	)
+
+	return httpserver.NewRouter(find, image, jobs, refresh, reindex, check, login, users, apiKeys, keys, audit)
+}
+
+func TestAuthMiddleware(t *testing.T) {
+	ctx := context.Background()
+	db := memorydb.New()
+	signer := jwtauth.NewHMAC(authCfg.Secret)
+	audit := auth.NewAudit(&db, logger.New("error"))
+	users := auth.NewUsers(authCfg, &db, &db, audit)
+	login := auth.NewLoginUser(authCfg, &db, &db, &db, signer, audit)
+	apiKeys := auth.NewAPIKeys(&db, &db, audit)
+	routes := newRoutes(login, users, apiKeys, signer, audit)
+
+	_, err := users.Create(ctx, "admin", "Admin-password1", models.AdminRole)
+	require.NoError(t, err)
+
+	_, err = users.Create(ctx, "user1", "User-password1", "")
+	require.NoError(t, err)
+
+	adminTokens, err := login.Login(ctx, "admin", "Admin-password1", "192.0.2.1")
+	require.NoError(t, err)
+
+	userTokens, err := login.Login(ctx, "user1", "User-password1", "192.0.2.1")
+	require.NoError(t, err)
+
+	admin := models.Principal{ //nolint:exhaustruct
+		Username:    "admin",
+		Role:        models.AdminRole,
+		Permissions: []models.Permission{models.PermAPIKeyManage},
+	}
+
+	// ключ администратора только для управления ключами.
+	keysOnly, _, err := apiKeys.Issue(ctx, admin, "admin", "keys", []models.Permission{models.PermAPIKeyManage}, 0)
+	require.NoError(t, err)
+
+	// следующий обработчик отвечает 200, если запрос прошел проверку.
+	next := http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	})
+	h := middlewares.AuthMidleware(next, auth.NewAuthUser(&db, &db, &db, signer), routes)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		header http.Header
+		code   int
+	}{
+		{"public route", http.MethodGet, "/.well-known/jwks.json", nil, http.StatusOK},
+		{"public login", http.MethodPost, "/login", nil, http.StatusOK},
+		{"missing token", http.MethodGet, "/pics", nil, http.StatusUnauthorized},
+		{"missing token on unknown route", http.MethodGet, "/nope", nil, http.StatusUnauthorized},
+		{"invalid token", http.MethodGet, "/pics", bearer("invalid"), http.StatusUnauthorized},
+		{"permission granted", http.MethodGet, "/pics", bearer(userTokens.AccessToken), http.StatusOK},
+		{"missing permission", http.MethodPost, "/update", bearer(userTokens.AccessToken), http.StatusForbidden},
+		{"admin permission", http.MethodPost, "/update", bearer(adminTokens.AccessToken), http.StatusOK},
+		{"authenticated only", http.MethodPost, "/logout", bearer(userTokens.AccessToken), http.StatusOK},
+		{
+			"path pattern granted", http.MethodGet, "/comics/42/image",
+			bearer(userTokens.AccessToken), http.StatusOK,
+		},
+		{
+			"path pattern denied", http.MethodPatch, "/admin/users/user1",
+			bearer(userTokens.AccessToken), http.StatusForbidden,
+		},
+		{
+			"api key scope granted", http.MethodDelete, "/admin/api-keys/7",
+			http.Header{"X-Api-Key": {keysOnly}}, http.StatusOK,
+		},
+		{
+			"api key scope denied", http.MethodDelete, "/admin/users/user1",
+			http.Header{"X-Api-Key": {keysOnly}}, http.StatusForbidden,
+		},
+		{
+			"api key scope on pattern", http.MethodGet, "/comics/42/image",
+			http.Header{"X-Api-Key": {keysOnly}}, http.StatusForbidden,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			r := httptest.NewRequest(tt.method, tt.path, nil)
+			for k, v := range tt.header {
+				r.Header[k] = v
+			}
+
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, r)
+
+			require.Equal(t, tt.code, w.Code, w.Body.String())
+		})
+	}
+}
+
+func TestRouterAccess(t *testing.T) {
+	var (
+		login   auth.LoginUserUsecase
+		users   auth.UsersUsecase
+		apiKeys auth.APIKeysUsecase
+		audit   auth.AuditUsecase
+	)
+
+	routes := newRoutes(login, users, apiKeys, jwtauth.NewHMAC(authCfg.Secret), audit)
+
+	tests := []struct {
+		method string
+		path   string
+		perm   models.Permission
+		public bool
+	}{
+		{http.MethodGet, "/comics/42", models.PermSearchRead, false},
+		{http.MethodGet, "/comics/42/image", models.PermSearchRead, false},
+		{http.MethodGet, "/update/abc", models.PermComicsUpdate, false},
+		{http.MethodPatch, "/admin/users/bob", models.PermUsersManage, false},
+		{http.MethodDelete, "/admin/api-keys/1", models.PermAPIKeyManage, false},
+		{http.MethodGet, "/admin/audit", models.PermAuditRead, false},
+		{http.MethodPost, "/me/password", "", false},
+		{http.MethodPost, "/refresh", "", true},
+		// метод, для которого нет маршрута, требует аутентификации.
+		{http.MethodDelete, "/login", "", false},
+	}
+
+	for _, tt := range tests {
+		perm, public := routes.Access(httptest.NewRequest(tt.method, tt.path, nil))
+
+		require.Equal(t, tt.perm, perm, "%s %s", tt.method, tt.path)
+		require.Equal(t, tt.public, public, "%s %s", tt.method, tt.path)
+	}
+}
+
+func bearer(token string) http.Header {
+	return http.Header{"Authorization": {"Bearer " + token}}
+}
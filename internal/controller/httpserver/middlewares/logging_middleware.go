@@ -1,9 +1,11 @@
 package middlewares
 
 import (
+	"net"
 	"net/http"
 	"time"
 
+	"github.com/Leopold1975/yadro_app/internal/auth/models"
 	"github.com/Leopold1975/yadro_app/pkg/logger"
 )
 
@@ -29,12 +31,17 @@ func (rw *syncResponseWriter) WriteHeader(code int) {
 	rw.wroteHeader = true
 }
 
+// LogMiddleware пишет в лог каждый запрос. Адрес клиента и пользователя, которого
+// заполняет AuthMidleware, он передает дальше через models.RequestInfo в контексте.
 func LogMiddleware(next http.Handler, l logger.Logger) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		start := time.Now()
 
 		rr := syncResponseWriter{ResponseWriter: w} //nolint:exhaustruct
 
+		info := &models.RequestInfo{ClientIP: clientIP(r)} //nolint:exhaustruct
+		r = r.WithContext(models.WithRequestInfo(r.Context(), info))
+
 		defer func() {
 			if rr.status == 0 {
 				rr.status = http.StatusOK // HTTP 200 OK, если статус код не был установлен.
@@ -46,6 +53,7 @@ func LogMiddleware(next http.Handler, l logger.Logger) http.Handler {
 				"Addr", r.URL.RequestURI(),
 				"Client", r.RemoteAddr,
 				"Agent", r.UserAgent(),
+				"User", info.Principal.Username,
 				"CODE", rr.status,
 				"LATENCY", latency.String(),
 			)
@@ -54,3 +62,13 @@ func LogMiddleware(next http.Handler, l logger.Logger) http.Handler {
 		next.ServeHTTP(&rr, r)
 	})
 }
+
+// clientIP — адрес клиента без порта. Обработчики берут его из models.RequestInfo.
+func clientIP(r *http.Request) string {
+	ip, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return ip
+}
@@ -1,7 +1,6 @@
 package middlewares
 
 import (
-	"net"
 	"net/http"
 	"sync"
 
@@ -27,12 +26,7 @@ func NewRateLimiter(cfg config.Ratelimit) *RateLimiter {
 
 func (rl *RateLimiter) RatelimiterMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		ip, _, err := net.SplitHostPort(r.RemoteAddr)
-		if err != nil {
-			http.Error(w, "invalid IP address", http.StatusInternalServerError)
-
-			return
-		}
+		ip := clientIP(r)
 
 		var limiter *rate.Limiter
 
@@ -1,6 +1,73 @@
 package httpserver
 
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/Leopold1975/yadro_app/internal/models"
+)
+
+var (
+	ErrInvalidPage = errors.New("limit and offset must be non-negative integers")
+	ErrNotSession  = errors.New("request is authenticated with an api key, not a session token")
+)
+
 type LoginRequest struct {
 	Username string `json:"username"`
 	Password string `json:"password"`
 }
+
+type RefreshRequest struct {
+	RefreshToken string `json:"refreshToken"`
+}
+
+type CreateUserRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+	Role     string `json:"role"`
+}
+
+type UpdateUserRequest struct {
+	Role     *string `json:"role"`
+	Disabled *bool   `json:"disabled"`
+}
+
+// CreateAPIKeyRequest — запрос ключа. Пустой Owner — ключ для самого администратора,
+// ExpiresIn — длительность в формате time.ParseDuration, пустая — бессрочный ключ.
+type CreateAPIKeyRequest struct {
+	Name      string   `json:"name"`
+	Owner     string   `json:"owner"`
+	Scopes    []string `json:"scopes"`
+	ExpiresIn string   `json:"expiresIn"`
+}
+
+type ChangePasswordRequest struct {
+	OldPassword string `json:"oldPassword"`
+	NewPassword string `json:"newPassword"`
+}
+
+// parsePage читает параметры limit и offset. Отсутствующий параметр считается равным нулю.
+func parsePage(r *http.Request) (models.Page, error) {
+	var page models.Page
+
+	for _, p := range []struct {
+		name string
+		dst  *int
+	}{{"limit", &page.Limit}, {"offset", &page.Offset}} {
+		v := r.FormValue(p.name)
+		if v == "" {
+			continue
+		}
+
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return models.Page{}, fmt.Errorf("%w: %s=%q", ErrInvalidPage, p.name, v)
+		}
+
+		*p.dst = n
+	}
+
+	return page, nil
+}
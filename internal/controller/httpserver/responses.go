@@ -0,0 +1,404 @@
+package httpserver
+
+import (
+	"time"
+
+	user "github.com/Leopold1975/yadro_app/internal/auth/models"
+	"github.com/Leopold1975/yadro_app/internal/models"
+	"github.com/Leopold1975/yadro_app/internal/usecase"
+)
+
+type ComicsResponse struct {
+	ID         string `json:"id"`
+	URL        string `json:"url"`
+	Title      string `json:"title"`
+	SafeTitle  string `json:"safeTitle"`
+	Alt        string `json:"alt"`
+	Transcript string `json:"transcript"`
+	Link       string `json:"link"`
+	News       string `json:"news"`
+	Date       string `json:"date"`
+}
+
+type FoundComicsResponse struct {
+	ID    string  `json:"id"`
+	URL   string  `json:"url"`
+	Title string  `json:"title"`
+	Alt   string  `json:"alt"`
+	Date  string  `json:"date"`
+	Score float64 `json:"score"`
+}
+
+type PicsResponse struct {
+	Comics     []FoundComicsResponse `json:"comics"`
+	URLs       []string              `json:"urls"` // оставлено для совместимости со старыми клиентами.
+	Total      int                   `json:"total"`
+	Limit      int                   `json:"limit"`
+	Offset     int                   `json:"offset"`
+	DidYouMean string                `json:"did_you_mean,omitempty"` //nolint:tagliatelle
+}
+
+type SuggestionResponse struct {
+	Word  string `json:"word"`
+	Count int    `json:"count"`
+}
+
+type SuggestResponse struct {
+	Suggestions []SuggestionResponse `json:"suggestions"`
+}
+
+type FailedComicsResponse struct {
+	ID     string `json:"id"`
+	Reason string `json:"reason"`
+}
+
+type UpdateResponse struct {
+	New     int                    `json:"new"`
+	Total   int                    `json:"total"`
+	Fetched []string               `json:"fetched"`
+	Failed  []FailedComicsResponse `json:"failed"`
+	Skipped []string               `json:"skipped"`
+}
+
+type ProgressResponse struct {
+	Total   int `json:"total"`
+	Fetched int `json:"fetched"`
+	Failed  int `json:"failed"`
+	Skipped int `json:"skipped"`
+}
+
+type UpdateJobResponse struct {
+	ID         string           `json:"id"`
+	Status     string           `json:"status"`
+	Joined     bool             `json:"joined"`
+	StartedAt  time.Time        `json:"startedAt"`
+	FinishedAt *time.Time       `json:"finishedAt,omitempty"`
+	Progress   ProgressResponse `json:"progress"`
+	Result     *UpdateResponse  `json:"result,omitempty"`
+	Error      string           `json:"error,omitempty"`
+}
+
+type RefreshStatusResponse struct {
+	Schedule    string     `json:"schedule"`
+	Running     bool       `json:"running"`
+	LastRun     *time.Time `json:"lastRun,omitempty"`
+	LastSuccess *time.Time `json:"lastSuccess,omitempty"`
+	LastError   string     `json:"lastError,omitempty"`
+	NextRun     *time.Time `json:"nextRun,omitempty"`
+}
+
+type ReindexStatusResponse struct {
+	Running    bool                    `json:"running"`
+	Joined     bool                    `json:"joined"`
+	Stemmer    string                  `json:"stemmer"`
+	StartedAt  *time.Time              `json:"startedAt,omitempty"`
+	FinishedAt *time.Time              `json:"finishedAt,omitempty"`
+	Progress   ReindexProgressResponse `json:"progress"`
+	Error      string                  `json:"error,omitempty"`
+}
+
+type ReindexProgressResponse struct {
+	Total   int `json:"total"`
+	Indexed int `json:"indexed"`
+	Skipped int `json:"skipped"`
+}
+
+type IndexReportResponse struct {
+	Checked        int                 `json:"checked"`
+	Consistent     bool                `json:"consistent"`
+	Diverged       []IndexDiffResponse `json:"diverged"`
+	OrphanKeywords int                 `json:"orphanKeywords"`
+}
+
+type IndexDiffResponse struct {
+	ID      string   `json:"id"`
+	Missing []string `json:"missing,omitempty"`
+	Extra   []string `json:"extra,omitempty"`
+	Changed []string `json:"changed,omitempty"`
+}
+
+type TokenResponse struct {
+	AccessToken  string `json:"accessToken"`
+	RefreshToken string `json:"refreshToken"`
+	TokenType    string `json:"tokenType"`
+	ExpiresIn    int    `json:"expiresIn"` // секунды
+}
+
+type UserResponse struct {
+	Username  string    `json:"username"`
+	Role      string    `json:"role"`
+	Disabled  bool      `json:"disabled"`
+	CreatedAt time.Time `json:"createdAt"`
+}
+
+type APIKeyResponse struct {
+	ID         int        `json:"id"`
+	Prefix     string     `json:"prefix"`
+	Name       string     `json:"name"`
+	Owner      string     `json:"owner"`
+	Scopes     []string   `json:"scopes"`
+	CreatedAt  time.Time  `json:"createdAt"`
+	ExpiresAt  *time.Time `json:"expiresAt,omitempty"`
+	LastUsedAt *time.Time `json:"lastUsedAt,omitempty"`
+	RevokedAt  *time.Time `json:"revokedAt,omitempty"`
+}
+
+// IssuedAPIKeyResponse — выданный ключ. Key больше нигде не возвращается.
+type IssuedAPIKeyResponse struct {
+	Key string `json:"key"`
+	APIKeyResponse
+}
+
+type APIKeysResponse struct {
+	Keys []APIKeyResponse `json:"keys"`
+}
+
+type UsersResponse struct {
+	Users []UserResponse `json:"users"`
+}
+
+type AuditEntryResponse struct {
+	ID        int64     `json:"id"`
+	CreatedAt time.Time `json:"createdAt"`
+	Actor     string    `json:"actor"`
+	APIKeyID  int       `json:"apiKeyId,omitempty"`
+	Action    string    `json:"action"`
+	Target    string    `json:"target,omitempty"`
+	Details   string    `json:"details,omitempty"`
+	Outcome   string    `json:"outcome"`
+	ClientIP  string    `json:"clientIp,omitempty"`
+}
+
+type AuditResponse struct {
+	Entries []AuditEntryResponse `json:"entries"`
+}
+
+func toComicsResponse(c models.ComicsInfo) ComicsResponse {
+	return ComicsResponse{
+		ID:         c.ID,
+		URL:        c.URL,
+		Title:      c.Title,
+		SafeTitle:  c.SafeTitle,
+		Alt:        c.Alt,
+		Transcript: c.Transcript,
+		Link:       c.Link,
+		News:       c.News,
+		Date:       c.Date,
+	}
+}
+
+func toPicsResponse(sr usecase.SearchResult) PicsResponse {
+	result := PicsResponse{
+		Comics:     make([]FoundComicsResponse, 0, len(sr.Comics)),
+		URLs:       make([]string, 0, len(sr.Comics)),
+		Total:      sr.Total,
+		Limit:      sr.Page.Limit,
+		Offset:     sr.Page.Offset,
+		DidYouMean: sr.DidYouMean,
+	}
+
+	for _, c := range sr.Comics {
+		result.Comics = append(result.Comics, FoundComicsResponse{
+			ID:    c.ID,
+			URL:   c.URL,
+			Title: c.Title,
+			Alt:   c.Alt,
+			Date:  c.Date,
+			Score: c.Score,
+		})
+		result.URLs = append(result.URLs, c.URL)
+	}
+
+	return result
+}
+
+func toSuggestResponse(keywords []models.Keyword) SuggestResponse {
+	result := SuggestResponse{
+		Suggestions: make([]SuggestionResponse, 0, len(keywords)),
+	}
+
+	for _, k := range keywords {
+		result.Suggestions = append(result.Suggestions, SuggestionResponse{Word: k.Word, Count: k.DocFreq})
+	}
+
+	return result
+}
+
+func toUpdateResponse(fr usecase.FetchResponse) UpdateResponse {
+	result := UpdateResponse{
+		New:     fr.New,
+		Total:   fr.Total,
+		Fetched: fr.Fetched,
+		Failed:  make([]FailedComicsResponse, 0, len(fr.Failed)),
+		Skipped: fr.Skipped,
+	}
+
+	for _, fc := range fr.Failed {
+		result.Failed = append(result.Failed, FailedComicsResponse{ID: fc.ID, Reason: fc.Reason})
+	}
+
+	return result
+}
+
+func toUpdateJobResponse(job usecase.UpdateJob, joined bool) UpdateJobResponse {
+	result := UpdateJobResponse{
+		ID:         job.ID,
+		Status:     string(job.Status),
+		Joined:     joined,
+		StartedAt:  job.StartedAt,
+		FinishedAt: optionalTime(job.FinishedAt),
+		Progress: ProgressResponse{
+			Total:   job.Progress.Total,
+			Fetched: job.Progress.Fetched,
+			Failed:  job.Progress.Failed,
+			Skipped: job.Progress.Skipped,
+		},
+		Result: nil,
+		Error:  job.Error,
+	}
+
+	if job.Status == usecase.JobDone {
+		ur := toUpdateResponse(job.Result)
+		result.Result = &ur
+	}
+
+	return result
+}
+
+func toRefreshStatusResponse(rs usecase.RefreshStatus) RefreshStatusResponse {
+	return RefreshStatusResponse{
+		Schedule:    rs.Schedule,
+		Running:     rs.Running,
+		LastRun:     optionalTime(rs.LastRun),
+		LastSuccess: optionalTime(rs.LastSuccess),
+		LastError:   rs.LastError,
+		NextRun:     optionalTime(rs.NextRun),
+	}
+}
+
+func toReindexStatusResponse(rs usecase.ReindexStatus, joined bool) ReindexStatusResponse {
+	return ReindexStatusResponse{
+		Running:    rs.Running,
+		Joined:     joined,
+		Stemmer:    rs.Stemmer,
+		StartedAt:  optionalTime(rs.StartedAt),
+		FinishedAt: optionalTime(rs.FinishedAt),
+		Progress: ReindexProgressResponse{
+			Total:   rs.Progress.Total,
+			Indexed: rs.Progress.Indexed,
+			Skipped: rs.Progress.Skipped,
+		},
+		Error: rs.Error,
+	}
+}
+
+func toIndexReportResponse(r models.IndexReport) IndexReportResponse {
+	diverged := make([]IndexDiffResponse, 0, len(r.Diverged))
+	for _, d := range r.Diverged {
+		diverged = append(diverged, IndexDiffResponse{
+			ID:      d.ID,
+			Missing: d.Missing,
+			Extra:   d.Extra,
+			Changed: d.Changed,
+		})
+	}
+
+	return IndexReportResponse{
+		Checked:        r.Checked,
+		Consistent:     len(r.Diverged) == 0 && r.OrphanKeywords == 0,
+		Diverged:       diverged,
+		OrphanKeywords: r.OrphanKeywords,
+	}
+}
+
+func toTokenResponse(tp user.TokenPair) TokenResponse {
+	return TokenResponse{
+		AccessToken:  tp.AccessToken,
+		RefreshToken: tp.RefreshToken,
+		TokenType:    "Bearer",
+		ExpiresIn:    int(tp.ExpiresIn.Seconds()),
+	}
+}
+
+func toUserResponse(u user.User) UserResponse {
+	return UserResponse{
+		Username:  u.Username,
+		Role:      string(u.Role),
+		Disabled:  u.Disabled,
+		CreatedAt: u.CreatedAt,
+	}
+}
+
+func toUsersResponse(users []user.User) UsersResponse {
+	result := UsersResponse{
+		Users: make([]UserResponse, 0, len(users)),
+	}
+
+	for _, u := range users {
+		result.Users = append(result.Users, toUserResponse(u))
+	}
+
+	return result
+}
+
+func toAPIKeyResponse(k user.APIKey) APIKeyResponse {
+	scopes := make([]string, 0, len(k.Scopes))
+	for _, s := range k.Scopes {
+		scopes = append(scopes, string(s))
+	}
+
+	return APIKeyResponse{
+		ID:         k.ID,
+		Prefix:     k.Prefix,
+		Name:       k.Name,
+		Owner:      k.Owner,
+		Scopes:     scopes,
+		CreatedAt:  k.CreatedAt,
+		ExpiresAt:  optionalTime(k.ExpiresAt),
+		LastUsedAt: optionalTime(k.LastUsedAt),
+		RevokedAt:  optionalTime(k.RevokedAt),
+	}
+}
+
+func toAPIKeysResponse(keys []user.APIKey) APIKeysResponse {
+	result := APIKeysResponse{
+		Keys: make([]APIKeyResponse, 0, len(keys)),
+	}
+
+	for _, k := range keys {
+		result.Keys = append(result.Keys, toAPIKeyResponse(k))
+	}
+
+	return result
+}
+
+func toAuditResponse(entries []user.AuditEntry) AuditResponse {
+	result := AuditResponse{
+		Entries: make([]AuditEntryResponse, 0, len(entries)),
+	}
+
+	for _, e := range entries {
+		result.Entries = append(result.Entries, AuditEntryResponse{
+			ID:        e.ID,
+			CreatedAt: e.CreatedAt,
+			Actor:     e.Actor,
+			APIKeyID:  e.APIKeyID,
+			Action:    string(e.Action),
+			Target:    e.Target,
+			Details:   e.Details,
+			Outcome:   string(e.Outcome),
+			ClientIP:  e.ClientIP,
+		})
+	}
+
+	return result
+}
+
+// optionalTime возвращает nil для нулевого времени, чтобы оно не попадало в ответ.
+func optionalTime(t time.Time) *time.Time {
+	if t.IsZero() {
+		return nil
+	}
+
+	return &t
+}
@@ -1,74 +1,291 @@
 package httpserver
 
 import (
+	"context"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
+	"math"
 	"net/http"
+	"strconv"
+	"time"
 
 	user "github.com/Leopold1975/yadro_app/internal/auth/models"
 	auth "github.com/Leopold1975/yadro_app/internal/auth/usecase"
 	"github.com/Leopold1975/yadro_app/internal/models"
+	"github.com/Leopold1975/yadro_app/internal/pkg/jwtauth"
 	"github.com/Leopold1975/yadro_app/internal/usecase"
 )
 
-func NewRouter(find usecase.FindComicsUsecase, fetch usecase.FetchComicsUsecase,
-	login auth.LoginUserUsecase,
-) http.Handler {
-	mux := http.NewServeMux()
+// Картинка по id комикса может измениться только при повторной загрузке,
+// поэтому ее можно кэшировать на сутки, а затем перепроверять по ETag.
+const imageCacheControl = "public, max-age=86400"
 
-	mux.HandleFunc("POST /update", updateHandler(fetch))
-	mux.HandleFunc("GET /pics", getPicsHandle(find))
+// JWKS меняется только при ротации ключей. Встретив токен с неизвестным kid,
+// клиент должен перезапросить ключи, не дожидаясь истечения кэша.
+const jwksCacheControl = "public, max-age=300"
 
-	mux.HandleFunc("POST /login", loginHandler(login))
+// Router — маршруты API вместе с разрешениями, которые они требуют.
+// Разрешения проверяет middlewares.AuthMidleware, узнавая их через Access.
+type Router struct {
+	mux    *http.ServeMux
+	access map[string]access
+}
+
+type access struct {
+	public bool
+	perm   user.Permission
+}
+
+func NewRouter(find usecase.FindComicsUsecase, image usecase.ComicsImageUsecase, jobs usecase.UpdateJobsUsecase,
+	refresh usecase.BackgroundRefreshUsecase, reindex usecase.ReindexUsecase, check usecase.IndexCheckUsecase,
+	login auth.LoginUserUsecase, users auth.UsersUsecase, apiKeys auth.APIKeysUsecase, keys *jwtauth.KeySet,
+	audit auth.AuditUsecase,
+) *Router {
+	rt := &Router{
+		mux:    http.NewServeMux(),
+		access: make(map[string]access),
+	}
+
+	rt.handle("POST /update", user.PermComicsUpdate, updateHandler(jobs))
+	rt.handle("GET /update/{id}", user.PermComicsUpdate, getUpdateHandler(jobs))
+	rt.handle("GET /admin/refresh", user.PermComicsUpdate, refreshStatusHandler(refresh))
+	rt.handle("POST /admin/reindex", user.PermIndexManage, reindexHandler(reindex))
+	rt.handle("GET /admin/reindex", user.PermIndexManage, reindexStatusHandler(reindex))
+	rt.handle("GET /admin/index/check", user.PermIndexManage, indexCheckHandler(check.Check))
+	rt.handle("POST /admin/index/repair", user.PermIndexManage, indexCheckHandler(check.Repair))
+	rt.handle("GET /pics", user.PermSearchRead, getPicsHandle(find))
+	rt.handle("GET /comics/{id}", user.PermSearchRead, getComicsHandler(find))
+	rt.handle("GET /comics/{id}/image", user.PermSearchRead, getImageHandler(image))
+	rt.handle("GET /suggest", user.PermSearchRead, suggestHandler(find))
+
+	rt.handle("POST /admin/users", user.PermUsersManage, createUserHandler(users))
+	rt.handle("GET /admin/users", user.PermUsersManage, listUsersHandler(users))
+	rt.handle("PATCH /admin/users/{username}", user.PermUsersManage, updateUserHandler(users))
+	rt.handle("DELETE /admin/users/{username}", user.PermUsersManage, deleteUserHandler(users))
+	rt.handle("POST /admin/api-keys", user.PermAPIKeyManage, issueAPIKeyHandler(apiKeys))
+	rt.handle("GET /admin/api-keys", user.PermAPIKeyManage, listAPIKeysHandler(apiKeys))
+	rt.handle("DELETE /admin/api-keys/{id}", user.PermAPIKeyManage, revokeAPIKeyHandler(apiKeys))
+	rt.handle("GET /admin/audit", user.PermAuditRead, auditHandler(audit))
+	rt.authenticated("POST /me/password", changePasswordHandler(users))
+	rt.authenticated("POST /logout", logoutHandler(login))
+
+	rt.public("POST /login", loginHandler(login))
+	rt.public("POST /refresh", refreshHandler(login))
+	rt.public("GET /.well-known/jwks.json", jwksHandler(keys))
+
+	return rt
+}
+
+func (rt *Router) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rt.mux.ServeHTTP(w, r)
+}
+
+// Access возвращает разрешение, которое требует маршрут запроса, или пустое, если
+// достаточно аутентификации. public равен true для маршрутов без аутентификации.
+// Запросы к несуществующим маршрутам тоже требуют аутентификации, чтобы по ответам
+// 404 и 405 нельзя было перебрать маршруты без токена.
+func (rt *Router) Access(r *http.Request) (perm user.Permission, public bool) { //nolint:nonamedreturns
+	_, pattern := rt.mux.Handler(r)
+
+	a := rt.access[pattern]
+
+	return a.perm, a.public
+}
+
+// handle регистрирует маршрут, доступный пользователям с разрешением perm.
+func (rt *Router) handle(pattern string, perm user.Permission, h http.HandlerFunc) {
+	rt.access[pattern] = access{public: false, perm: perm}
+	rt.mux.HandleFunc(pattern, h)
+}
 
-	return mux
+// authenticated регистрирует маршрут, доступный любому вошедшему пользователю.
+func (rt *Router) authenticated(pattern string, h http.HandlerFunc) {
+	rt.handle(pattern, "", h)
 }
 
-func updateHandler(fetch usecase.FetchComicsUsecase) func(http.ResponseWriter, *http.Request) {
+// public регистрирует маршрут без аутентификации.
+func (rt *Router) public(pattern string, h http.HandlerFunc) {
+	rt.access[pattern] = access{public: true, perm: ""}
+	rt.mux.HandleFunc(pattern, h)
+}
+
+// updateHandler запускает задание загрузки комиксов и сразу отвечает 202 с его id.
+// Если задание уже выполняется, возвращается оно.
+func updateHandler(jobs usecase.UpdateJobsUsecase) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 
-		role, ok := r.Context().Value(user.RoleKey).(user.Role)
-		if !ok {
-			writeError(w, fmt.Errorf("unexpected role type"), http.StatusInternalServerError) //nolint:goerr113,perfsprint
+		job, joined := jobs.Start(r.Context())
 
-			return
-		}
+		w.Header().Set("Location", "/update/"+job.ID)
+		w.WriteHeader(http.StatusAccepted)
 
-		if role != user.AdminRole {
-			w.WriteHeader(http.StatusForbidden)
+		if err := json.NewEncoder(w).Encode(toUpdateJobResponse(job, joined)); err != nil {
+			writeError(w, err, http.StatusInternalServerError)
 
 			return
 		}
+	}
+}
+
+func getUpdateHandler(jobs usecase.UpdateJobsUsecase) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
 
-		fResp, err := fetch.FetchComics(r.Context())
+		job, err := jobs.Get(r.PathValue("id"))
 		if err != nil {
+			if errors.Is(err, models.ErrNotFound) {
+				writeError(w, err, http.StatusNotFound)
+
+				return
+			}
+
 			writeError(w, err, http.StatusInternalServerError)
 
 			return
 		}
 
-		result := struct {
-			New   int `json:"new"`
-			Total int `json:"total"`
-		}{New: fResp.New, Total: fResp.Total}
+		if err := json.NewEncoder(w).Encode(toUpdateJobResponse(job, false)); err != nil {
+			writeError(w, err, http.StatusInternalServerError)
+		}
+	}
+}
+
+func refreshStatusHandler(refresh usecase.BackgroundRefreshUsecase) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		if err := json.NewEncoder(w).Encode(toRefreshStatusResponse(refresh.Status())); err != nil {
+			writeError(w, err, http.StatusInternalServerError)
+		}
+	}
+}
+
+// reindexHandler запускает перестройку индекса и сразу отвечает 202.
+// Ход перестройки доступен через GET /admin/reindex.
+func reindexHandler(reindex usecase.ReindexUsecase) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		status, joined := reindex.Start(r.Context())
+
+		w.Header().Set("Location", "/admin/reindex")
+		w.WriteHeader(http.StatusAccepted)
+
+		if err := json.NewEncoder(w).Encode(toReindexStatusResponse(status, joined)); err != nil {
+			writeError(w, err, http.StatusInternalServerError)
+		}
+	}
+}
+
+func reindexStatusHandler(reindex usecase.ReindexUsecase) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		if err := json.NewEncoder(w).Encode(toReindexStatusResponse(reindex.Status(), false)); err != nil {
+			writeError(w, err, http.StatusInternalServerError)
+		}
+	}
+}
+
+// indexCheckHandler отвечает отчетом проверки или исправления индекса.
+// Если хранилище не поддерживает проверку, отвечает 501.
+func indexCheckHandler(check func(ctx context.Context) (models.IndexReport, error),
+) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		report, err := check(r.Context())
+		if err != nil {
+			if errors.Is(err, usecase.ErrIndexCheckUnsupported) {
+				writeError(w, err, http.StatusNotImplemented)
+
+				return
+			}
 
-		if err := json.NewEncoder(w).Encode(result); err != nil {
 			writeError(w, err, http.StatusInternalServerError)
 
 			return
 		}
+
+		if err := json.NewEncoder(w).Encode(toIndexReportResponse(report)); err != nil {
+			writeError(w, err, http.StatusInternalServerError)
+		}
+	}
+}
+
+// withIndexStrategy переносит стратегию поиска из параметра index в контекст запроса.
+// Параметр нужен для сравнения стратегий и требует разрешения index:manage.
+// Если хранилище не умеет искать выбранной стратегией, отвечает 400.
+// Возвращает false, если ответ уже отправлен.
+func withIndexStrategy(w http.ResponseWriter, r *http.Request, find usecase.FindComicsUsecase,
+) (*http.Request, bool) {
+	param := r.FormValue("index")
+	if param == "" {
+		return r, true
+	}
+
+	if !requirePermission(w, r, user.PermIndexManage) {
+		return r, false
+	}
+
+	strategy, err := models.ParseIndexStrategy(param)
+	if err != nil {
+		writeError(w, err, http.StatusBadRequest)
+
+		return r, false
+	}
+
+	if !find.SupportsStrategy(strategy) {
+		writeError(w, fmt.Errorf("%w: %s", usecase.ErrStrategyUnsupported, strategy), http.StatusBadRequest)
+
+		return r, false
+	}
+
+	return r.WithContext(models.WithIndexStrategy(r.Context(), strategy)), true
+}
+
+// requirePermission отвечает 403, если у пользователя запроса нет разрешения perm.
+// Нужна для проверок внутри обработчика, например по параметрам запроса;
+// разрешения маршрутов проверяет middlewares.AuthMidleware.
+func requirePermission(w http.ResponseWriter, r *http.Request, perm user.Permission) bool {
+	p, ok := user.PrincipalFrom(r.Context())
+	if !ok {
+		writeError(w, fmt.Errorf("unexpected principal type"), http.StatusInternalServerError) //nolint:goerr113,perfsprint
+
+		return false
+	}
+
+	if !p.Can(perm) {
+		w.WriteHeader(http.StatusForbidden)
+
+		return false
 	}
+
+	return true
 }
 
 func getPicsHandle(find usecase.FindComicsUsecase) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
 
+		r, ok := withIndexStrategy(w, r, find)
+		if !ok {
+			return
+		}
+
 		s := r.FormValue("search")
 
-		comics, err := find.GetComics(r.Context(), s)
+		page, err := parsePage(r)
+		if err != nil {
+			writeError(w, err, http.StatusBadRequest)
+
+			return
+		}
+
+		comics, err := find.GetComics(r.Context(), s, page)
 		if err != nil {
 			if errors.Is(err, models.ErrNotFound) {
 				writeError(w, err, http.StatusNotFound)
@@ -76,26 +293,100 @@ func getPicsHandle(find usecase.FindComicsUsecase) func(http.ResponseWriter, *ht
 				return
 			}
 
+			if errors.Is(err, usecase.ErrInvalidQuery) || errors.Is(err, usecase.ErrFullTextUnsupported) {
+				writeError(w, err, http.StatusBadRequest)
+
+				return
+			}
+
 			writeError(w, err, http.StatusInternalServerError)
 
 			return
 		}
 
-		urls := make([]string, 0, len(comics))
-		for _, c := range comics {
-			urls = append(urls, c.URL)
+		if err := json.NewEncoder(w).Encode(toPicsResponse(comics)); err != nil {
+			writeError(w, err, http.StatusInternalServerError)
 		}
+	}
+}
 
-		result := struct {
-			URLs []string `json:"urls"`
-		}{URLs: urls}
+func getComicsHandler(find usecase.FindComicsUsecase) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
 
-		if err := json.NewEncoder(w).Encode(result); err != nil {
+		c, err := find.GetComicsByID(r.Context(), r.PathValue("id"))
+		if err != nil {
+			if errors.Is(err, models.ErrNotFound) {
+				writeError(w, err, http.StatusNotFound)
+
+				return
+			}
+
+			writeError(w, err, http.StatusInternalServerError)
+
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(toComicsResponse(c)); err != nil {
+			writeError(w, err, http.StatusInternalServerError)
+		}
+	}
+}
+
+// getImageHandler отдает локальную копию картинки. ETag — хэш содержимого,
+// поэтому клиент может проверить актуальность закэшированной картинки через If-None-Match.
+func getImageHandler(image usecase.ComicsImageUsecase) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		img, rc, err := image.GetImage(r.Context(), r.PathValue("id"))
+		if err != nil {
+			w.Header().Set("Content-Type", "application/json")
+
+			if errors.Is(err, models.ErrNotFound) {
+				writeError(w, err, http.StatusNotFound)
+
+				return
+			}
+
+			writeError(w, err, http.StatusInternalServerError)
+
+			return
+		}
+		defer rc.Close()
+
+		w.Header().Set("Content-Type", img.ContentType)
+		w.Header().Set("ETag", `"`+img.Hash+`"`)
+		w.Header().Set("Cache-Control", imageCacheControl)
+
+		http.ServeContent(w, r, "", time.Time{}, rc)
+	}
+}
+
+func suggestHandler(find usecase.FindComicsUsecase) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		page, err := parsePage(r)
+		if err != nil {
+			writeError(w, err, http.StatusBadRequest)
+
+			return
+		}
+
+		keywords, err := find.Suggest(r.Context(), r.FormValue("prefix"), page.Limit)
+		if err != nil {
+			writeError(w, err, http.StatusInternalServerError)
+
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(toSuggestResponse(keywords)); err != nil {
 			writeError(w, err, http.StatusInternalServerError)
 		}
 	}
 }
 
+// loginHandler отвечает парой токенов. Access-токен также передается
+// в заголовке Authorization, как до появления refresh-токенов.
 func loginHandler(login auth.LoginUserUsecase) func(http.ResponseWriter, *http.Request) {
 	return func(w http.ResponseWriter, r *http.Request) {
 		w.Header().Set("Content-Type", "application/json")
@@ -111,13 +402,133 @@ func loginHandler(login auth.LoginUserUsecase) func(http.ResponseWriter, *http.R
 			return
 		}
 
-		t, err := login.Login(r.Context(), lr.Username, lr.Password)
+		// адрес клиента определяет middlewares.LogMiddleware.
+		info := user.RequestInfoFrom(r.Context())
+		if info == nil {
+			writeError(w, fmt.Errorf("no request info"), http.StatusInternalServerError) //nolint:goerr113,perfsprint
+
+			return
+		}
+
+		tp, err := login.Login(r.Context(), lr.Username, lr.Password, info.ClientIP)
 		if err != nil {
-			writeError(w, fmt.Errorf("login error %w", err), http.StatusUnauthorized)
+			writeLoginError(w, err)
 
 			return
 		}
 
-		w.Header().Add("Authorization", "Bearer "+t)
+		writeTokenPair(w, tp)
+	}
+}
+
+// writeLoginError отвечает одинаково на неизвестное имя и неверный пароль,
+// а на блокировку — 429 с Retry-After.
+func writeLoginError(w http.ResponseWriter, err error) {
+	var locked user.LockedError
+
+	switch {
+	case errors.As(err, &locked):
+		w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(locked.RetryAfter.Seconds()))))
+		writeError(w, user.ErrLoginLocked, http.StatusTooManyRequests)
+	case errors.Is(err, user.ErrInvalidCredentials):
+		writeError(w, user.ErrInvalidCredentials, http.StatusUnauthorized)
+	case errors.Is(err, user.ErrUserDisabled):
+		writeError(w, user.ErrUserDisabled, http.StatusUnauthorized)
+	default:
+		writeError(w, err, http.StatusInternalServerError)
+	}
+}
+
+func refreshHandler(login auth.LoginUserUsecase) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		var rr RefreshRequest
+
+		if err := json.NewDecoder(r.Body).Decode(&rr); err != nil {
+			writeError(w, fmt.Errorf("decode error %w", err), http.StatusBadRequest)
+
+			return
+		}
+
+		tp, err := login.Refresh(r.Context(), rr.RefreshToken)
+		if err != nil {
+			if errors.Is(err, user.ErrInvalidRefresh) || errors.Is(err, user.ErrRefreshReused) ||
+				errors.Is(err, user.ErrUserDisabled) || errors.Is(err, user.ErrNotFound) {
+				writeError(w, fmt.Errorf("refresh error %w", err), http.StatusUnauthorized)
+
+				return
+			}
+
+			writeError(w, err, http.StatusInternalServerError)
+
+			return
+		}
+
+		writeTokenPair(w, tp)
+	}
+}
+
+// logoutHandler отзывает access-токен запроса и, если он передан в теле, refresh-токен.
+func logoutHandler(login auth.LoginUserUsecase) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		p, ok := user.PrincipalFrom(r.Context())
+		if !ok {
+			writeError(w, fmt.Errorf("unexpected principal type"), http.StatusInternalServerError) //nolint:goerr113,perfsprint
+
+			return
+		}
+
+		if p.TokenID == "" {
+			writeError(w, ErrNotSession, http.StatusBadRequest)
+
+			return
+		}
+
+		var rr RefreshRequest
+
+		// тело необязательно: без него отзывается только access-токен.
+		if err := json.NewDecoder(r.Body).Decode(&rr); err != nil && !errors.Is(err, io.EOF) {
+			writeError(w, fmt.Errorf("decode error %w", err), http.StatusBadRequest)
+
+			return
+		}
+
+		if err := login.Logout(r.Context(), p, rr.RefreshToken); err != nil {
+			if errors.Is(err, user.ErrInvalidRefresh) {
+				writeError(w, err, http.StatusBadRequest)
+
+				return
+			}
+
+			writeError(w, err, http.StatusInternalServerError)
+
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// jwksHandler отдает открытые ключи, которыми другие сервисы могут проверять токены
+// без обращения к серверу. При подписи HS256 список ключей пуст.
+func jwksHandler(keys *jwtauth.KeySet) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Cache-Control", jwksCacheControl)
+
+		if err := json.NewEncoder(w).Encode(keys.JWKS()); err != nil {
+			writeError(w, err, http.StatusInternalServerError)
+		}
+	}
+}
+
+func writeTokenPair(w http.ResponseWriter, tp user.TokenPair) {
+	w.Header().Add("Authorization", "Bearer "+tp.AccessToken)
+
+	if err := json.NewEncoder(w).Encode(toTokenResponse(tp)); err != nil {
+		writeError(w, err, http.StatusInternalServerError)
 	}
 }
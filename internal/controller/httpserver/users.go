@@ -0,0 +1,148 @@
+package httpserver
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+
+	user "github.com/Leopold1975/yadro_app/internal/auth/models"
+	auth "github.com/Leopold1975/yadro_app/internal/auth/usecase"
+)
+
+func createUserHandler(users auth.UsersUsecase) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		var req CreateUserRequest
+
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, fmt.Errorf("decode error %w", err), http.StatusBadRequest)
+
+			return
+		}
+
+		u, err := users.Create(r.Context(), req.Username, req.Password, user.Role(req.Role))
+		if err != nil {
+			writeUserError(w, err)
+
+			return
+		}
+
+		w.Header().Set("Location", "/admin/users/"+u.Username)
+		w.WriteHeader(http.StatusCreated)
+
+		if err := json.NewEncoder(w).Encode(toUserResponse(u)); err != nil {
+			writeError(w, err, http.StatusInternalServerError)
+		}
+	}
+}
+
+func listUsersHandler(users auth.UsersUsecase) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		list, err := users.List(r.Context())
+		if err != nil {
+			writeError(w, err, http.StatusInternalServerError)
+
+			return
+		}
+
+		if err := json.NewEncoder(w).Encode(toUsersResponse(list)); err != nil {
+			writeError(w, err, http.StatusInternalServerError)
+		}
+	}
+}
+
+// updateUserHandler меняет роль и/или признак отключения пользователя.
+// Отсутствующие в запросе поля не меняются.
+func updateUserHandler(users auth.UsersUsecase) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		var req UpdateUserRequest
+
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, fmt.Errorf("decode error %w", err), http.StatusBadRequest)
+
+			return
+		}
+
+		var role *user.Role
+
+		if req.Role != nil {
+			v := user.Role(*req.Role)
+			role = &v
+		}
+
+		if err := users.Update(r.Context(), r.PathValue("username"), role, req.Disabled); err != nil {
+			writeUserError(w, err)
+
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+func deleteUserHandler(users auth.UsersUsecase) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		if err := users.Delete(r.Context(), r.PathValue("username")); err != nil {
+			writeUserError(w, err)
+
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// changePasswordHandler меняет пароль пользователя, выполняющего запрос.
+func changePasswordHandler(users auth.UsersUsecase) func(http.ResponseWriter, *http.Request) {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+
+		p, ok := user.PrincipalFrom(r.Context())
+		if !ok {
+			writeError(w, fmt.Errorf("unexpected principal type"), http.StatusInternalServerError) //nolint:goerr113,perfsprint
+
+			return
+		}
+
+		var req ChangePasswordRequest
+
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			writeError(w, fmt.Errorf("decode error %w", err), http.StatusBadRequest)
+
+			return
+		}
+
+		if err := users.ChangePassword(r.Context(), p.Username, req.OldPassword, req.NewPassword); err != nil {
+			writeUserError(w, err)
+
+			return
+		}
+
+		w.WriteHeader(http.StatusNoContent)
+	}
+}
+
+// writeUserError выбирает код ответа по ошибке управления пользователями.
+func writeUserError(w http.ResponseWriter, err error) {
+	switch {
+	case errors.Is(err, user.ErrNotFound):
+		writeError(w, err, http.StatusNotFound)
+	case errors.Is(err, user.ErrUserExists), errors.Is(err, user.ErrLastAdmin):
+		writeError(w, err, http.StatusConflict)
+	case errors.Is(err, user.ErrInvalidUsername), errors.Is(err, user.ErrInvalidRole),
+		errors.Is(err, user.ErrWeakPassword), errors.Is(err, user.ErrInvalidScope):
+		writeError(w, err, http.StatusBadRequest)
+	case errors.Is(err, user.ErrWrongPassword), errors.Is(err, user.ErrForbidden):
+		writeError(w, err, http.StatusForbidden)
+	default:
+		writeError(w, err, http.StatusInternalServerError)
+	}
+}
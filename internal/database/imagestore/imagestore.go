@@ -0,0 +1,105 @@
+package imagestore
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	_ "image/gif"  // регистрация декодеров для image.DecodeConfig.
+	_ "image/jpeg" // регистрация декодеров для image.DecodeConfig.
+	_ "image/png"  // регистрация декодеров для image.DecodeConfig.
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+
+	"github.com/Leopold1975/yadro_app/internal/models"
+	"github.com/Leopold1975/yadro_app/pkg/atomicfile"
+)
+
+const (
+	dirPerm  = 0o755
+	filePerm = 0o644
+	// Картинки раскладываются по подкаталогам по первым символам хэша,
+	// чтобы в одном каталоге не было тысяч файлов.
+	prefixLen = 2
+)
+
+var ErrNoDir = errors.New("images dir is not set")
+
+// Store — файловое хранилище картинок, адресуемых SHA-256 хэшем содержимого.
+// Одинаковые картинки хранятся в одном файле.
+type Store struct {
+	dir string
+}
+
+func New(dir string) (Store, error) {
+	if dir == "" {
+		return Store{}, ErrNoDir
+	}
+
+	if err := os.MkdirAll(dir, dirPerm); err != nil {
+		return Store{}, fmt.Errorf("create images dir error: %w", err)
+	}
+
+	return Store{dir: dir}, nil
+}
+
+// Put сохраняет картинку и возвращает ее хэш, размер, тип и, если формат
+// поддерживается, ширину и высоту.
+func (s Store) Put(_ context.Context, data []byte) (models.Image, error) {
+	sum := sha256.Sum256(data)
+
+	img := models.Image{
+		Hash:        hex.EncodeToString(sum[:]),
+		Size:        int64(len(data)),
+		Width:       0,
+		Height:      0,
+		ContentType: http.DetectContentType(data),
+	}
+
+	if cfg, _, err := image.DecodeConfig(bytes.NewReader(data)); err == nil {
+		img.Width, img.Height = cfg.Width, cfg.Height
+	}
+
+	path := s.path(img.Hash)
+
+	if _, err := os.Stat(path); err == nil {
+		return img, nil
+	}
+
+	if err := os.MkdirAll(filepath.Dir(path), dirPerm); err != nil {
+		return models.Image{}, fmt.Errorf("create dir error: %w", err)
+	}
+
+	if err := atomicfile.Write(path, filePerm, bytes.NewReader(data)); err != nil {
+		return models.Image{}, fmt.Errorf("write image error: %w", err)
+	}
+
+	return img, nil
+}
+
+// Open открывает картинку по хэшу. Возвращает models.ErrNotFound, если ее нет.
+func (s Store) Open(hash string) (io.ReadSeekCloser, error) { //nolint:ireturn
+	if b, err := hex.DecodeString(hash); err != nil || len(b) != sha256.Size {
+		return nil, fmt.Errorf("image %q: %w", hash, models.ErrNotFound)
+	}
+
+	f, err := os.Open(s.path(hash))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, fmt.Errorf("image %s: %w", hash, models.ErrNotFound)
+		}
+
+		return nil, fmt.Errorf("open image error: %w", err)
+	}
+
+	return f, nil
+}
+
+func (s Store) path(hash string) string {
+	return filepath.Join(s.dir, hash[:prefixLen], hash)
+}
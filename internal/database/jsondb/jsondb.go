@@ -0,0 +1,123 @@
+package jsondb
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"sync"
+
+	"github.com/Leopold1975/yadro_app/internal/database/memorydb"
+	"github.com/Leopold1975/yadro_app/internal/models"
+	"github.com/Leopold1975/yadro_app/internal/pkg/config"
+	"github.com/Leopold1975/yadro_app/pkg/atomicfile"
+)
+
+const filePerm = 0o644 // CreateTemp создает файл с правами 0600.
+
+var ErrNoPath = errors.New("json db path is not set")
+
+// metaSuffix добавляется к пути базы для файла с метаданными индекса,
+// чтобы не менять формат database.json.
+const metaSuffix = ".meta"
+
+// ComicsRepo хранит комиксы в файле формата database.json (map[id]ComicsInfo).
+// Поиск и индекс обслуживаются встроенным memorydb.ComicsRepo, файл перезаписывается при Flush.
+type ComicsRepo struct {
+	memorydb.ComicsRepo
+	flushMu   *sync.Mutex // не дает старому снимку перезаписать более новый.
+	path      string
+	indexPath string
+}
+
+func New(cfg config.DB) (ComicsRepo, error) {
+	if cfg.JSONPath == "" {
+		return ComicsRepo{}, ErrNoPath
+	}
+
+	comics := make(map[string]models.ComicsInfo)
+	if err := load(cfg.JSONPath, &comics); err != nil {
+		return ComicsRepo{}, err
+	}
+
+	meta := make(map[string]string)
+	if err := load(cfg.JSONPath+metaSuffix, &meta); err != nil {
+		return ComicsRepo{}, err
+	}
+
+	cr := ComicsRepo{
+		ComicsRepo: memorydb.NewFrom(comics),
+		flushMu:    &sync.Mutex{},
+		path:       cfg.JSONPath,
+		indexPath:  cfg.IndexPath,
+	}
+
+	for k, v := range meta {
+		cr.SetIndexMeta(context.Background(), k, v) //nolint:errcheck // memorydb не возвращает ошибок.
+	}
+
+	return cr, nil
+}
+
+// Flush атомарно перезаписывает файл базы снимком хранилища, а при updateIndex
+// дополнительно сохраняет индекс в cfg.IndexPath (если путь задан). Новыми
+// сохраненными считаются только комиксы, попавшие в снимок.
+func (cr *ComicsRepo) Flush(_ context.Context, updateIndex bool) (int, int, error) {
+	cr.flushMu.Lock()
+	defer cr.flushMu.Unlock()
+
+	s := cr.Snapshot()
+
+	if err := writeJSON(cr.path, s.Comics); err != nil {
+		return 0, 0, fmt.Errorf("write db error: %w", err)
+	}
+
+	if err := writeJSON(cr.path+metaSuffix, s.Meta); err != nil {
+		return 0, 0, fmt.Errorf("write meta error: %w", err)
+	}
+
+	if updateIndex && cr.indexPath != "" {
+		if err := writeJSON(cr.indexPath, s.Index); err != nil {
+			return 0, 0, fmt.Errorf("write index error: %w", err)
+		}
+	}
+
+	cr.Flushed(s.NewComics)
+
+	return len(s.Comics), s.NewComics, nil
+}
+
+// load читает JSON файл в v. Отсутствующий или пустой файл не считается ошибкой.
+func load(path string, v any) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+
+		return fmt.Errorf("read file error: %w", err)
+	}
+
+	if len(data) == 0 {
+		return nil
+	}
+
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("unmarshal error: %w", err)
+	}
+
+	return nil
+}
+
+// writeJSON атомарно записывает v в файл path в формате JSON.
+func writeJSON(path string, v any) error {
+	data, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Errorf("marshal error: %w", err)
+	}
+
+	return atomicfile.Write(path, filePerm, bytes.NewReader(append(data, '\n'))) //nolint:wrapcheck
+}
@@ -0,0 +1,113 @@
+package jsondb_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/Leopold1975/yadro_app/internal/database/jsondb"
+	"github.com/Leopold1975/yadro_app/internal/models"
+	"github.com/Leopold1975/yadro_app/internal/pkg/config"
+	"github.com/stretchr/testify/require"
+)
+
+func comics(id, title string) models.ComicsInfo {
+	return models.ComicsInfo{ //nolint:exhaustruct
+		ID:       id,
+		URL:      "https://imgs.xkcd.com/comics/" + id + ".png",
+		Title:    title,
+		Keywords: []string{strings.ToLower(title)},
+		Terms:    map[string]int{strings.ToLower(title): 1},
+		Length:   1,
+	}
+}
+
+func TestReopen(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	cfg := config.DB{ //nolint:exhaustruct
+		JSONPath:  filepath.Join(dir, "database.json"),
+		IndexPath: filepath.Join(dir, "index.json"),
+	}
+
+	db, err := jsondb.New(cfg)
+	require.NoError(t, err)
+
+	require.NoError(t, db.AddOne(ctx, comics("1", "Barrel")))
+	require.NoError(t, db.AddOne(ctx, comics("2", "Island")))
+	require.NoError(t, db.SetIndexMeta(ctx, "stemmer", "porter2"))
+
+	total, added, err := db.Flush(ctx, true)
+	require.NoError(t, err)
+	require.Equal(t, 2, total)
+	require.Equal(t, 2, added)
+	require.FileExists(t, cfg.IndexPath)
+
+	db, err = jsondb.New(cfg)
+	require.NoError(t, err)
+
+	ci, err := db.GetByID(ctx, "2")
+	require.NoError(t, err)
+	require.Equal(t, "Island", ci.Title)
+
+	found, err := db.GetByWord(ctx, "barrel", models.Page{Limit: 10, Offset: 0})
+	require.NoError(t, err)
+	require.Len(t, found, 1)
+	require.Equal(t, "1", found[0].ID)
+
+	// метаданные индекса хранятся в отдельном файле и переживают перезапуск.
+	stemmer, err := db.GetIndexMeta(ctx, "stemmer")
+	require.NoError(t, err)
+	require.Equal(t, "porter2", stemmer)
+
+	// загруженные из файла комиксы не считаются новыми.
+	total, added, err = db.Flush(ctx, false)
+	require.NoError(t, err)
+	require.Equal(t, 2, total)
+	require.Equal(t, 0, added)
+}
+
+func TestNoPath(t *testing.T) {
+	_, err := jsondb.New(config.DB{}) //nolint:exhaustruct
+	require.ErrorIs(t, err, jsondb.ErrNoPath)
+}
+
+func TestFailedFlush(t *testing.T) {
+	ctx := context.Background()
+
+	// имя временного файла длиннее имени базы на суффикс ".<random>.tmp",
+	// поэтому при имени базы в 250 символов его нельзя создать и запись не удается.
+	path := filepath.Join(t.TempDir(), strings.Repeat("d", 245)+".json")
+	prev := []byte(`{"1":{"id":"1","url":"https://imgs.xkcd.com/comics/1.png","title":"Barrel","keywords":["barrel"]}}` + "\n")
+	require.NoError(t, os.WriteFile(path, prev, 0o600))
+
+	cfg := config.DB{JSONPath: path} //nolint:exhaustruct
+
+	db, err := jsondb.New(cfg)
+	require.NoError(t, err)
+	require.NoError(t, db.AddOne(ctx, comics("2", "Island")))
+
+	_, _, err = db.Flush(ctx, false)
+	require.Error(t, err)
+
+	// неудачная запись не затрагивает прежний файл и не оставляет временных файлов.
+	data, err := os.ReadFile(path)
+	require.NoError(t, err)
+	require.Equal(t, prev, data)
+
+	entries, err := os.ReadDir(filepath.Dir(path))
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+
+	db, err = jsondb.New(cfg)
+	require.NoError(t, err)
+
+	_, err = db.GetByID(ctx, "2")
+	require.ErrorIs(t, err, models.ErrNotFound)
+
+	ci, err := db.GetByID(ctx, "1")
+	require.NoError(t, err)
+	require.Equal(t, "Barrel", ci.Title)
+}
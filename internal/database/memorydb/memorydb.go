@@ -0,0 +1,391 @@
+package memorydb
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/Leopold1975/yadro_app/internal/models"
+)
+
+// ComicsRepo хранит комиксы и инвертированный индекс (keyword -> отсортированный список id)
+// только в памяти процесса. Безопасен для конкурентного использования.
+type ComicsRepo struct {
+	mu        *sync.RWMutex
+	comics    map[string]models.ComicsInfo
+	index     map[string][]string
+	length    int // суммарная длина всех комиксов для IndexStats.
+	newComics int
+	meta      map[string]string
+}
+
+func New() ComicsRepo {
+	return NewFrom(nil)
+}
+
+// NewFrom создает хранилище, заполненное переданными комиксами.
+// Загруженные комиксы не считаются новыми при Flush.
+func NewFrom(comics map[string]models.ComicsInfo) ComicsRepo {
+	cr := ComicsRepo{
+		mu:        &sync.RWMutex{},
+		comics:    make(map[string]models.ComicsInfo, len(comics)),
+		index:     make(map[string][]string),
+		length:    0,
+		newComics: 0,
+		meta:      make(map[string]string),
+	}
+
+	for id, ci := range comics {
+		cr.comics[id] = ci
+		cr.length += ci.DocLength()
+		cr.addToIndex(ci)
+	}
+
+	return cr
+}
+
+func (cr *ComicsRepo) AddOne(_ context.Context, ci models.ComicsInfo) error {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+
+	cr.add(ci)
+
+	return nil
+}
+
+// AddMany сохраняет комиксы под одной блокировкой.
+func (cr *ComicsRepo) AddMany(_ context.Context, comics []models.ComicsInfo) error {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+
+	for _, ci := range comics {
+		cr.add(ci)
+	}
+
+	return nil
+}
+
+func (cr *ComicsRepo) add(ci models.ComicsInfo) {
+	if old, ok := cr.comics[ci.ID]; ok {
+		cr.length -= old.DocLength()
+		cr.removeFromIndex(old)
+	} else {
+		cr.newComics++
+	}
+
+	cr.comics[ci.ID] = ci
+	cr.length += ci.DocLength()
+	cr.addToIndex(ci)
+}
+
+// SetImage заменяет картинку сохраненного комикса. Возвращает models.ErrNotFound, если комикса нет.
+func (cr *ComicsRepo) SetImage(_ context.Context, id string, img models.Image) error {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+
+	ci, ok := cr.comics[id]
+	if !ok {
+		return models.ErrNotFound
+	}
+
+	ci.Image = img
+	cr.comics[id] = ci
+
+	return nil
+}
+
+// ReplaceIndex собирает пачки build и заменяет ими индекс под одной блокировкой,
+// поэтому поиск видит либо старый индекс, либо новый целиком. Индекс комиксов,
+// не переданных в build, не меняется.
+func (cr *ComicsRepo) ReplaceIndex(_ context.Context, build func(put models.PutIndexFunc) error) error {
+	updated := make(map[string]models.ComicsInfo)
+
+	err := build(func(_ context.Context, comics []models.ComicsInfo) error {
+		for _, ci := range comics {
+			updated[ci.ID] = ci
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+
+	index := make(map[string][]string, len(cr.index))
+	length := 0
+
+	for id, ci := range cr.comics {
+		if u, ok := updated[id]; ok {
+			ci.Keywords, ci.Terms, ci.Length, ci.Positions = u.Keywords, u.Terms, u.Length, u.Positions
+			cr.comics[id] = ci
+		}
+
+		for _, k := range ci.Keywords {
+			index[k] = append(index[k], id)
+		}
+
+		length += ci.DocLength()
+	}
+
+	for _, ids := range index {
+		sort.Slice(ids, func(i, j int) bool { return models.LessID(ids[i], ids[j]) })
+	}
+
+	cr.index, cr.length = index, length
+
+	return nil
+}
+
+func (cr *ComicsRepo) GetByID(_ context.Context, id string) (models.ComicsInfo, error) {
+	cr.mu.RLock()
+	defer cr.mu.RUnlock()
+
+	ci, ok := cr.comics[id]
+	if !ok {
+		return models.ComicsInfo{}, models.ErrNotFound
+	}
+
+	return ci, nil
+}
+
+// GetByIDs возвращает найденные комиксы в порядке переданных id, отсутствующие id пропускаются.
+func (cr *ComicsRepo) GetByIDs(_ context.Context, ids []string) ([]models.ComicsInfo, error) {
+	cr.mu.RLock()
+	defer cr.mu.RUnlock()
+
+	result := make([]models.ComicsInfo, 0, len(ids))
+
+	for _, id := range ids {
+		if ci, ok := cr.comics[id]; ok {
+			result = append(result, ci)
+		}
+	}
+
+	return result, nil
+}
+
+// GetMissingIDs возвращает отсутствующие в хранилище id от 1 до maxID включительно.
+func (cr *ComicsRepo) GetMissingIDs(_ context.Context, maxID int) ([]string, error) {
+	cr.mu.RLock()
+	defer cr.mu.RUnlock()
+
+	result := make([]string, 0)
+
+	for i := 1; i <= maxID; i++ {
+		id := strconv.Itoa(i)
+		if _, ok := cr.comics[id]; !ok {
+			result = append(result, id)
+		}
+	}
+
+	return result, nil
+}
+
+// GetAllIDs возвращает id всех комиксов по возрастанию.
+func (cr *ComicsRepo) GetAllIDs(_ context.Context) ([]string, error) {
+	cr.mu.RLock()
+	defer cr.mu.RUnlock()
+
+	result := make([]string, 0, len(cr.comics))
+	for id := range cr.comics {
+		result = append(result, id)
+	}
+
+	sort.Slice(result, func(i, j int) bool { return models.LessID(result[i], result[j]) })
+
+	return result, nil
+}
+
+func (cr *ComicsRepo) GetByWord(_ context.Context, word string, page models.Page) ([]models.ComicsInfo, error) {
+	cr.mu.RLock()
+	defer cr.mu.RUnlock()
+
+	ids := cr.index[word]
+
+	if page.Offset >= len(ids) {
+		return []models.ComicsInfo{}, nil
+	}
+
+	ids = ids[max(page.Offset, 0):]
+	if page.Limit > 0 && len(ids) > page.Limit {
+		ids = ids[:page.Limit]
+	}
+
+	result := make([]models.ComicsInfo, 0, len(ids))
+	for _, id := range ids {
+		result = append(result, cr.comics[id])
+	}
+
+	return result, nil
+}
+
+func (cr *ComicsRepo) GetPostings(_ context.Context, word string) ([]models.Posting, error) {
+	cr.mu.RLock()
+	defer cr.mu.RUnlock()
+
+	ids := cr.index[word]
+	result := make([]models.Posting, 0, len(ids))
+
+	for _, id := range ids {
+		ci := cr.comics[id]
+
+		result = append(result, models.Posting{
+			ID:        id,
+			TermFreq:  ci.TermFreq(word),
+			Length:    ci.DocLength(),
+			Positions: ci.Positions[word],
+		})
+	}
+
+	return result, nil
+}
+
+func (cr *ComicsRepo) GetStats(_ context.Context) (models.IndexStats, error) {
+	cr.mu.RLock()
+	defer cr.mu.RUnlock()
+
+	stats := models.IndexStats{
+		Total:     len(cr.comics),
+		AvgLength: 0,
+	}
+
+	if stats.Total > 0 {
+		stats.AvgLength = float64(cr.length) / float64(stats.Total)
+	}
+
+	return stats, nil
+}
+
+func (cr *ComicsRepo) GetVocabulary(_ context.Context) ([]models.Keyword, error) {
+	cr.mu.RLock()
+	defer cr.mu.RUnlock()
+
+	result := make([]models.Keyword, 0, len(cr.index))
+	for w, ids := range cr.index {
+		result = append(result, models.Keyword{Word: w, DocFreq: len(ids)})
+	}
+
+	return result, nil
+}
+
+func (cr *ComicsRepo) GetIndexMeta(_ context.Context, key string) (string, error) {
+	cr.mu.RLock()
+	defer cr.mu.RUnlock()
+
+	v, ok := cr.meta[key]
+	if !ok {
+		return "", models.ErrNotFound
+	}
+
+	return v, nil
+}
+
+func (cr *ComicsRepo) SetIndexMeta(_ context.Context, key, value string) error {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+
+	cr.meta[key] = value
+
+	return nil
+}
+
+// Flush ничего не сохраняет, а только возвращает общее количество комиксов
+// и количество добавленных с прошлого вызова.
+func (cr *ComicsRepo) Flush(_ context.Context, _ bool) (int, int, error) {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+
+	newC := cr.newComics
+	cr.newComics = 0
+
+	return len(cr.comics), newC, nil
+}
+
+// Snapshot — согласованная копия хранилища: комиксы, индекс и метаданные индекса
+// на один момент и число комиксов, добавленных с прошлого Flush или Flushed.
+type Snapshot struct {
+	Comics    map[string]models.ComicsInfo
+	Index     map[string][]string
+	Meta      map[string]string
+	NewComics int
+}
+
+// Snapshot возвращает копию хранилища, снятую под одной блокировкой.
+func (cr *ComicsRepo) Snapshot() Snapshot {
+	cr.mu.RLock()
+	defer cr.mu.RUnlock()
+
+	comics := make(map[string]models.ComicsInfo, len(cr.comics))
+	for id, ci := range cr.comics {
+		comics[id] = ci
+	}
+
+	index := make(map[string][]string, len(cr.index))
+	for k, ids := range cr.index {
+		index[k] = append([]string(nil), ids...)
+	}
+
+	meta := make(map[string]string, len(cr.meta))
+	for k, v := range cr.meta {
+		meta[k] = v
+	}
+
+	return Snapshot{
+		Comics:    comics,
+		Index:     index,
+		Meta:      meta,
+		NewComics: cr.newComics,
+	}
+}
+
+// Flushed отмечает сохраненными n новых комиксов снимка. Комиксы, добавленные
+// после снимка, остаются новыми до следующего сохранения.
+func (cr *ComicsRepo) Flushed(n int) {
+	cr.mu.Lock()
+	defer cr.mu.Unlock()
+
+	cr.newComics -= n
+}
+
+func (cr *ComicsRepo) addToIndex(ci models.ComicsInfo) {
+	for _, k := range ci.Keywords {
+		ids := cr.index[k]
+
+		i := sort.Search(len(ids), func(i int) bool { return !models.LessID(ids[i], ci.ID) })
+		if i < len(ids) && ids[i] == ci.ID {
+			continue
+		}
+
+		ids = append(ids, "")
+		copy(ids[i+1:], ids[i:])
+		ids[i] = ci.ID
+
+		cr.index[k] = ids
+	}
+}
+
+func (cr *ComicsRepo) removeFromIndex(ci models.ComicsInfo) {
+	for _, k := range ci.Keywords {
+		ids := cr.index[k]
+
+		for i, id := range ids {
+			if id == ci.ID {
+				ids = append(ids[:i], ids[i+1:]...)
+
+				break
+			}
+		}
+
+		if len(ids) == 0 {
+			delete(cr.index, k)
+
+			continue
+		}
+
+		cr.index[k] = ids
+	}
+}
@@ -0,0 +1,186 @@
+package postgresdb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/Leopold1975/yadro_app/internal/models"
+	"github.com/Leopold1975/yadro_app/pkg/pgtools"
+	"github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v5"
+)
+
+//nolint:gochecknoglobals
+var (
+	copyComicsColumns = []string{
+		"id", "url", "keywords", "terms", "length", "positions",
+		"title", "safe_title", "alt", "transcript", "link", "news", "published",
+		"image_hash", "image_size", "image_width", "image_height", "image_type",
+	}
+	copyMapColumns = []string{"keyword_id", "comics_id", "tf", "positions"}
+)
+
+// AddMany сохраняет комиксы одной транзакцией: строки comics и keyword_comics_map
+// записываются через COPY, а новые слова — одним INSERT. Если хотя бы один комикс
+// не удалось сохранить (например, он уже есть), не сохраняется ни один.
+func (cr *ComicsRepo) AddMany(ctx context.Context, comics []models.ComicsInfo) (err error) {
+	if len(comics) == 0 {
+		return nil
+	}
+
+	tx, err := cr.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin tx error %w", err)
+	}
+
+	defer func() {
+		err = pgtools.CommitOrRollback(ctx, tx, err, "add many")
+	}()
+
+	rows := make([][]any, 0, len(comics))
+
+	for _, ci := range comics {
+		row, err := comicsRow(ci)
+		if err != nil {
+			return fmt.Errorf("comics %s: %w", ci.ID, err)
+		}
+
+		rows = append(rows, row)
+	}
+
+	if _, err = tx.CopyFrom(ctx, pgx.Identifier{"comics"}, copyComicsColumns, pgx.CopyFromRows(rows)); err != nil {
+		return fmt.Errorf("copy comics error %w", err)
+	}
+
+	keywordIDs, err := upsertKeywords(ctx, tx, comics)
+	if err != nil {
+		return err
+	}
+
+	mapRows := make([][]any, 0)
+
+	for i, ci := range comics {
+		for _, keyword := range ci.Keywords {
+			jsonPositions, err := json.Marshal(ci.Positions[keyword])
+			if err != nil {
+				return fmt.Errorf("mashal positions error %w", err)
+			}
+
+			// rows[i][0] — числовой id комикса, уже проверенный comicsRow.
+			mapRows = append(mapRows, []any{keywordIDs[keyword], rows[i][0], ci.TermFreq(keyword), string(jsonPositions)})
+		}
+	}
+
+	_, err = tx.CopyFrom(ctx, pgx.Identifier{"keyword_comics_map"}, copyMapColumns, pgx.CopyFromRows(mapRows))
+	if err != nil {
+		return fmt.Errorf("copy keyword_comics_map error %w", err)
+	}
+
+	cr.newComics.Add(int32(len(comics)))
+
+	return nil
+}
+
+// comicsRow возвращает значения колонок copyComicsColumns.
+func comicsRow(ci models.ComicsInfo) ([]any, error) {
+	id, err := strconv.Atoi(ci.ID)
+	if err != nil {
+		return nil, fmt.Errorf("parse id error %w", err)
+	}
+
+	jsonKeywords, err := json.Marshal(ci.Keywords)
+	if err != nil {
+		return nil, fmt.Errorf("mashal keywords error %w", err)
+	}
+
+	jsonTerms, err := json.Marshal(ci.Terms)
+	if err != nil {
+		return nil, fmt.Errorf("mashal terms error %w", err)
+	}
+
+	jsonPositions, err := json.Marshal(ci.Positions)
+	if err != nil {
+		return nil, fmt.Errorf("mashal positions error %w", err)
+	}
+
+	var published any
+
+	if ci.Date != "" {
+		date, err := time.Parse(models.DateLayout, ci.Date)
+		if err != nil {
+			return nil, fmt.Errorf("parse date error %w", err)
+		}
+
+		published = date
+	}
+
+	return []any{
+		id, ci.URL, string(jsonKeywords), string(jsonTerms), ci.DocLength(), string(jsonPositions),
+		ci.Title, ci.SafeTitle, ci.Alt, ci.Transcript, ci.Link, ci.News, published,
+		ci.Image.Hash, ci.Image.Size, ci.Image.Width, ci.Image.Height, ci.Image.ContentType,
+	}, nil
+}
+
+// upsertKeywords добавляет отсутствующие слова комиксов и возвращает id всех их слов.
+func upsertKeywords(ctx context.Context, tx pgx.Tx, comics []models.ComicsInfo) (map[string]int, error) {
+	seen := make(map[string]struct{})
+	keywords := make([]string, 0)
+
+	for _, ci := range comics {
+		for _, k := range ci.Keywords {
+			if _, ok := seen[k]; !ok {
+				seen[k] = struct{}{}
+				keywords = append(keywords, k)
+			}
+		}
+	}
+
+	pb := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar)
+
+	query, args, err := pb.Insert("keywords").Columns("keyword").
+		Select(squirrel.Select().Column(squirrel.Expr("unnest(?::text[])", keywords))).
+		Suffix("ON CONFLICT (keyword) DO NOTHING").ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("to sql error %w", err)
+	}
+
+	if _, err := tx.Exec(ctx, query, args...); err != nil {
+		return nil, fmt.Errorf("exec error %w", err)
+	}
+
+	query, args, err = pb.Select("id", "keyword").From("keywords").
+		Where(squirrel.Expr("keyword = ANY(?)", keywords)).ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("to sql error %w", err)
+	}
+
+	rows, err := tx.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query error %w", err)
+	}
+
+	defer rows.Close()
+
+	ids := make(map[string]int, len(keywords))
+
+	for rows.Next() {
+		var id int
+
+		var keyword string
+
+		if err := rows.Scan(&id, &keyword); err != nil {
+			return nil, fmt.Errorf("scan error %w", err)
+		}
+
+		ids[keyword] = id
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error %w", err)
+	}
+
+	return ids, nil
+}
@@ -0,0 +1,166 @@
+package postgresdb
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/Leopold1975/yadro_app/internal/models"
+	"github.com/Leopold1975/yadro_app/pkg/pgtools"
+	"github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v5"
+)
+
+// divergedQuery сравнивает слова, частоты и позиции из comics.keywords, comics.terms
+// и comics.positions каждого комикса с его строками в keyword_comics_map и возвращает
+// комиксы, у которых они не совпадают. Частоты и позиции нормализуются так же,
+// как их записывает updateIndex: частота без записи в terms равна 1, позиции без
+// записи — JSON null.
+const divergedQuery = `
+WITH j AS (
+	SELECT c.id, kw,
+		COALESCE((c.terms->>kw)::int, 1) AS tf,
+		COALESCE(c.positions->kw, 'null') AS positions
+	FROM comics c, jsonb_array_elements_text(COALESCE(c.keywords, '[]')) kw
+), m AS (
+	SELECT kc.comics_id AS id, k.keyword AS kw, kc.tf, COALESCE(kc.positions, 'null') AS positions
+	FROM keyword_comics_map kc JOIN keywords k ON k.id = kc.keyword_id
+)
+SELECT COALESCE(j.id, m.id) AS id,
+	COALESCE(array_agg(j.kw ORDER BY j.kw) FILTER (WHERE m.kw IS NULL), '{}') AS missing,
+	COALESCE(array_agg(m.kw ORDER BY m.kw) FILTER (WHERE j.kw IS NULL), '{}') AS extra,
+	COALESCE(array_agg(j.kw ORDER BY j.kw) FILTER (WHERE j.kw IS NOT NULL AND m.kw IS NOT NULL), '{}') AS changed
+FROM j FULL JOIN m ON j.id = m.id AND j.kw = m.kw
+WHERE j.kw IS NULL OR m.kw IS NULL OR j.tf <> m.tf OR j.positions <> m.positions
+GROUP BY 1
+ORDER BY 1`
+
+// orphanKeywordsCond выбирает слова, не связанные ни с одним комиксом.
+const orphanKeywordsCond = "NOT EXISTS (SELECT 1 FROM keyword_comics_map kc WHERE kc.keyword_id = k.id)"
+
+// querier — общее для пула и транзакции.
+type querier interface {
+	Query(ctx context.Context, sql string, args ...any) (pgx.Rows, error)
+	QueryRow(ctx context.Context, sql string, args ...any) pgx.Row
+}
+
+// CheckIndex сравнивает два представления индекса: колонки comics.keywords,
+// comics.terms и comics.positions и таблицы keywords/keyword_comics_map.
+// Совпадать должны набор слов каждого комикса и частота и позиции каждого слова.
+func (cr *ComicsRepo) CheckIndex(ctx context.Context) (models.IndexReport, error) {
+	return checkIndex(ctx, cr.db)
+}
+
+// RepairIndex перестраивает строки keyword_comics_map разошедшихся комиксов
+// по колонкам comics, которые считаются источником истины, и удаляет слова без комиксов.
+// Возвращает найденные до исправления расхождения.
+func (cr *ComicsRepo) RepairIndex(ctx context.Context) (report models.IndexReport, err error) { //nolint:nonamedreturns
+	tx, err := cr.db.Begin(ctx)
+	if err != nil {
+		return models.IndexReport{}, fmt.Errorf("begin tx error %w", err)
+	}
+
+	defer func() {
+		err = pgtools.CommitOrRollback(ctx, tx, err, "repair index")
+	}()
+
+	report, err = checkIndex(ctx, tx)
+	if err != nil {
+		return models.IndexReport{}, err
+	}
+
+	pb := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar)
+
+	for _, d := range report.Diverged {
+		query, args, err := pb.Select(comicsColumns...).From("comics").
+			Where(squirrel.Eq{"comics.id": d.ID}).ToSql()
+		if err != nil {
+			return models.IndexReport{}, fmt.Errorf("to sql error %w", err)
+		}
+
+		ci, err := scanComics(tx.QueryRow(ctx, query, args...))
+		if err != nil {
+			return models.IndexReport{}, fmt.Errorf("comics %s: %w", d.ID, err)
+		}
+
+		if err := replaceIndex(ctx, tx, ci); err != nil {
+			return models.IndexReport{}, fmt.Errorf("repair comics %s: %w", d.ID, err)
+		}
+	}
+
+	if err := deleteOrphanKeywords(ctx, tx); err != nil {
+		return models.IndexReport{}, err
+	}
+
+	return report, nil
+}
+
+func checkIndex(ctx context.Context, q querier) (models.IndexReport, error) {
+	report := models.IndexReport{
+		Checked:        0,
+		Diverged:       make([]models.IndexDiff, 0),
+		OrphanKeywords: 0,
+	}
+
+	pb := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar)
+
+	query, _, err := pb.Select("COUNT(id)").From("comics").ToSql()
+	if err != nil {
+		return models.IndexReport{}, fmt.Errorf("to sql error %w", err)
+	}
+
+	if err := q.QueryRow(ctx, query).Scan(&report.Checked); err != nil {
+		return models.IndexReport{}, fmt.Errorf("scan error %w", err)
+	}
+
+	query, _, err = pb.Select("COUNT(k.id)").From("keywords k").Where(orphanKeywordsCond).ToSql()
+	if err != nil {
+		return models.IndexReport{}, fmt.Errorf("to sql error %w", err)
+	}
+
+	if err := q.QueryRow(ctx, query).Scan(&report.OrphanKeywords); err != nil {
+		return models.IndexReport{}, fmt.Errorf("scan error %w", err)
+	}
+
+	rows, err := q.Query(ctx, divergedQuery)
+	if err != nil {
+		return models.IndexReport{}, fmt.Errorf("query error %w", err)
+	}
+
+	defer rows.Close()
+
+	for rows.Next() {
+		var id int
+
+		var d models.IndexDiff
+
+		if err := rows.Scan(&id, &d.Missing, &d.Extra, &d.Changed); err != nil {
+			return models.IndexReport{}, fmt.Errorf("scan error %w", err)
+		}
+
+		d.ID = strconv.Itoa(id)
+		report.Diverged = append(report.Diverged, d)
+	}
+
+	if err := rows.Err(); err != nil {
+		return models.IndexReport{}, fmt.Errorf("rows error %w", err)
+	}
+
+	return report, nil
+}
+
+// deleteOrphanKeywords удаляет слова, не связанные ни с одним комиксом.
+func deleteOrphanKeywords(ctx context.Context, tx pgx.Tx) error {
+	pb := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar)
+
+	query, args, err := pb.Delete("keywords k").Where(orphanKeywordsCond).ToSql()
+	if err != nil {
+		return fmt.Errorf("to sql error %w", err)
+	}
+
+	if _, err := tx.Exec(ctx, query, args...); err != nil {
+		return fmt.Errorf("exec error %w", err)
+	}
+
+	return nil
+}
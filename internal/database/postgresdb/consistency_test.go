@@ -0,0 +1,74 @@
+package postgresdb_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Leopold1975/yadro_app/internal/models"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckIndex(t *testing.T) {
+	ctx := context.Background()
+
+	db, pool := testDB(t, "english")
+
+	err := db.AddOne(ctx, models.ComicsInfo{ //nolint:exhaustruct
+		ID:       "1",
+		URL:      "https://example.com/1.png",
+		Title:    "Apple apple tree",
+		Keywords: []string{"appl", "tree"},
+		Terms:    map[string]int{"appl": 2, "tree": 1},
+		Length:   3,
+		Positions: map[string]models.Positions{
+			"appl": {models.FieldTitle: {0, 1}},
+			"tree": {models.FieldTitle: {2}},
+		},
+	})
+	require.NoError(t, err)
+
+	report, err := db.CheckIndex(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, report.Checked)
+	require.Empty(t, report.Diverged)
+
+	// одинаковые наборы слов, но разные частота и позиции.
+	_, err = pool.Exec(ctx, `UPDATE keyword_comics_map SET tf = 1
+		WHERE keyword_id = (SELECT id FROM keywords WHERE keyword = 'appl')`)
+	require.NoError(t, err)
+
+	_, err = pool.Exec(ctx, `UPDATE keyword_comics_map SET positions = '{"title": [5]}'
+		WHERE keyword_id = (SELECT id FROM keywords WHERE keyword = 'tree')`)
+	require.NoError(t, err)
+
+	report, err = db.CheckIndex(ctx)
+	require.NoError(t, err)
+	require.Equal(t, []models.IndexDiff{
+		{ID: "1", Missing: []string{}, Extra: []string{}, Changed: []string{"appl", "tree"}},
+	}, report.Diverged)
+
+	// слово без комикса и пропавшая строка keyword_comics_map.
+	_, err = pool.Exec(ctx, `INSERT INTO keywords (keyword) VALUES ('orphan')`)
+	require.NoError(t, err)
+
+	_, err = pool.Exec(ctx, `DELETE FROM keyword_comics_map
+		WHERE keyword_id = (SELECT id FROM keywords WHERE keyword = 'tree')`)
+	require.NoError(t, err)
+
+	report, err = db.RepairIndex(ctx)
+	require.NoError(t, err)
+	require.Equal(t, 1, report.OrphanKeywords)
+	require.Equal(t, []models.IndexDiff{
+		{ID: "1", Missing: []string{"tree"}, Extra: []string{}, Changed: []string{"appl"}},
+	}, report.Diverged)
+
+	report, err = db.CheckIndex(ctx)
+	require.NoError(t, err)
+	require.Empty(t, report.Diverged)
+	require.Zero(t, report.OrphanKeywords)
+
+	postings, err := db.GetPostings(models.WithIndexStrategy(ctx, models.IndexTable), "appl")
+	require.NoError(t, err)
+	require.Len(t, postings, 1)
+	require.Equal(t, 2, postings[0].TermFreq)
+}
@@ -0,0 +1,146 @@
+package postgresdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/Leopold1975/yadro_app/pkg/pgtools"
+	"github.com/Masterminds/squirrel"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var ErrUnsupportedLanguage = errors.New("unsupported full-text search language")
+
+// tsvLanguageKey — ключ index_meta с конфигурацией текстового поиска колонки tsv.
+// Миграция 000008 создает колонку с конфигурацией english и ключ не записывает.
+const (
+	tsvLanguageKey     = "tsv_language"
+	defaultTSVLanguage = "english"
+)
+
+// textSearchConfigs — встроенные конфигурации текстового поиска Postgres для языков
+// search.language. Только имена из этого списка подставляются в DDL колонки tsv.
+var textSearchConfigs = map[string]struct{}{ //nolint:gochecknoglobals
+	"english":   {},
+	"french":    {},
+	"hungarian": {},
+	"norwegian": {},
+	"russian":   {},
+	"spanish":   {},
+	"swedish":   {},
+}
+
+// textSearchConfig возвращает конфигурацию текстового поиска для языка lang.
+// Пустой язык означает english, как и в words.NewStemmer.
+func textSearchConfig(lang string) (string, error) {
+	if lang == "" {
+		return defaultTSVLanguage, nil
+	}
+
+	if _, ok := textSearchConfigs[lang]; !ok {
+		return "", fmt.Errorf("%w: %s", ErrUnsupportedLanguage, lang)
+	}
+
+	return lang, nil
+}
+
+// ensureTSVLanguage пересоздает колонку tsv и ее индекс, если они построены
+// не для конфигурации tsConfig. Блокировка не дает двум экземплярам
+// перестраивать колонку одновременно.
+func ensureTSVLanguage(ctx context.Context, db *pgxpool.Pool, tsConfig string) (err error) { //nolint:nonamedreturns
+	tx, err := db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin tx error %w", err)
+	}
+
+	defer func() {
+		err = pgtools.CommitOrRollback(ctx, tx, err, "ensure tsv language")
+	}()
+
+	if _, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock(hashtext($1))", tsvLanguageKey); err != nil {
+		return fmt.Errorf("lock error %w", err)
+	}
+
+	current := defaultTSVLanguage
+
+	err = tx.QueryRow(ctx, "SELECT value FROM index_meta WHERE key = $1", tsvLanguageKey).Scan(&current)
+	if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("scan error %w", err)
+	}
+
+	if current == tsConfig {
+		return nil
+	}
+
+	// tsConfig проверен textSearchConfig, поэтому его можно подставить в DDL.
+	statements := []string{
+		"DROP INDEX IF EXISTS comics_tsv_idx",
+		"ALTER TABLE comics DROP COLUMN IF EXISTS tsv",
+		fmt.Sprintf(`ALTER TABLE comics ADD COLUMN tsv tsvector GENERATED ALWAYS AS (
+			setweight(to_tsvector('%[1]s', title), 'A') ||
+			setweight(to_tsvector('%[1]s', alt), 'B') ||
+			setweight(to_tsvector('%[1]s', transcript), 'C')
+		) STORED`, tsConfig),
+		"CREATE INDEX comics_tsv_idx ON comics USING GIN (tsv)",
+	}
+
+	for _, s := range statements {
+		if _, err := tx.Exec(ctx, s); err != nil {
+			return fmt.Errorf("rebuild tsv error %w", err)
+		}
+	}
+
+	_, err = tx.Exec(ctx, `INSERT INTO index_meta (key, value) VALUES ($1, $2)
+		ON CONFLICT (key) DO UPDATE SET value = EXCLUDED.value`, tsvLanguageKey, tsConfig)
+	if err != nil {
+		return fmt.Errorf("exec error %w", err)
+	}
+
+	return nil
+}
+
+// SearchFullText ищет комиксы по колонке tsv. Запрос разбирается websearch_to_tsquery
+// с той же конфигурацией, что и колонка: поддерживаются фразы в кавычках, OR
+// и исключение через "-". Возвращает ts_rank_cd каждого найденного комикса.
+func (cr *ComicsRepo) SearchFullText(ctx context.Context, phrase string) (map[string]float64, error) {
+	pb := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar)
+
+	query, args, err := pb.Select("comics.id").
+		Column("ts_rank_cd(comics.tsv, q)").
+		From("comics").
+		JoinClause(squirrel.Expr("CROSS JOIN websearch_to_tsquery(?::regconfig, ?) q", cr.tsConfig, phrase)).
+		Where("comics.tsv @@ q").ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("to sql error %w", err)
+	}
+
+	rows, err := cr.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query error %w", err)
+	}
+
+	defer rows.Close()
+
+	result := make(map[string]float64)
+
+	for rows.Next() {
+		var id int
+
+		var rank float64
+
+		if err := rows.Scan(&id, &rank); err != nil {
+			return nil, fmt.Errorf("scan error %w", err)
+		}
+
+		result[strconv.Itoa(id)] = rank
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error %w", err)
+	}
+
+	return result, nil
+}
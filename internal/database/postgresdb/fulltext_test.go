@@ -0,0 +1,44 @@
+package postgresdb_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/Leopold1975/yadro_app/internal/database/postgresdb"
+	"github.com/Leopold1975/yadro_app/internal/models"
+	"github.com/Leopold1975/yadro_app/internal/pkg/config"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUnsupportedLanguage(t *testing.T) {
+	_, err := postgresdb.New(context.Background(), config.DB{}, models.IndexFullText, "klingon") //nolint:exhaustruct
+	require.ErrorIs(t, err, postgresdb.ErrUnsupportedLanguage)
+}
+
+func TestSearchFullTextLanguage(t *testing.T) {
+	ctx := context.Background()
+
+	db, _ := testDB(t, "russian")
+
+	err := db.AddOne(ctx, models.ComicsInfo{ //nolint:exhaustruct
+		ID: "9001", URL: "https://example.com/9001.png", Title: "Кошки", Keywords: []string{"кошк"},
+	})
+	require.NoError(t, err)
+
+	// колонка tsv перестроена для russian: словоформы сводятся к одной основе.
+	scores, err := db.SearchFullText(ctx, "кошка")
+	require.NoError(t, err)
+	require.Contains(t, scores, "9001")
+
+	// возврат к english снова перестраивает колонку.
+	db, _ = testDB(t, "english")
+
+	err = db.AddOne(ctx, models.ComicsInfo{ //nolint:exhaustruct
+		ID: "9001", URL: "https://example.com/9001.png", Title: "Кошки", Keywords: []string{"кошк"},
+	})
+	require.NoError(t, err)
+
+	scores, err = db.SearchFullText(ctx, "кошка")
+	require.NoError(t, err)
+	require.NotContains(t, scores, "9001")
+}
@@ -5,6 +5,7 @@ import (
 	"encoding/json"
 	"errors"
 	"fmt"
+	"strconv"
 	"sync/atomic"
 
 	"github.com/Leopold1975/yadro_app/internal/models"
@@ -16,13 +17,34 @@ import (
 	_ "github.com/jackc/pgx/v5/stdlib" // used for driver
 )
 
+// docLengthExpr вычисляет длину комикса с учетом строк без колонки length.
+const docLengthExpr = "COALESCE(comics.length, jsonb_array_length(comics.keywords))"
+
+// comicsColumns — колонки, которые читает scanComics.
+var comicsColumns = []string{ //nolint:gochecknoglobals
+	"comics.id", "comics.url", "comics.keywords", "COALESCE(comics.terms, '{}')", "COALESCE(comics.length, 0)",
+	"COALESCE(comics.positions, '{}')",
+	"comics.title", "comics.safe_title", "comics.alt", "comics.transcript", "comics.link", "comics.news",
+	"COALESCE(comics.published::text, '')",
+	"comics.image_hash", "comics.image_size", "comics.image_width", "comics.image_height", "comics.image_type",
+}
+
 type ComicsRepo struct {
-	db            *pgxpool.Pool
-	newComics     atomic.Int32
-	useIndexTable bool
+	db        *pgxpool.Pool
+	newComics atomic.Int32
+	strategy  models.IndexStrategy // стратегия поиска, если она не задана в контексте запроса.
+	tsConfig  string               // конфигурация текстового поиска колонки tsv и запросов.
 }
 
-func New(ctx context.Context, cfg config.DB, useIndexTable bool) (ComicsRepo, error) {
+// New подключается к базе и применяет миграции. strategy — стратегия поиска
+// для запросов, в контексте которых она не задана. lang — язык search.language:
+// колонка tsv перестраивается под него, если была построена для другого языка.
+func New(ctx context.Context, cfg config.DB, strategy models.IndexStrategy, lang string) (ComicsRepo, error) {
+	tsConfig, err := textSearchConfig(lang)
+	if err != nil {
+		return ComicsRepo{}, err
+	}
+
 	connString := "postgres://" + cfg.Username + ":" + cfg.Password + "@" +
 		cfg.Addr + "/" + cfg.DB + "?" + "sslmode=" + cfg.SSLmode + "&pool_max_conns=" + cfg.MaxConns
 
@@ -38,10 +60,15 @@ func New(ctx context.Context, cfg config.DB, useIndexTable bool) (ComicsRepo, er
 		return ComicsRepo{}, fmt.Errorf("apply migration error: %w", err)
 	}
 
+	if err := ensureTSVLanguage(ctx, db, tsConfig); err != nil {
+		return ComicsRepo{}, fmt.Errorf("full-text search language error: %w", err)
+	}
+
 	return ComicsRepo{
-		db:            db,
-		newComics:     atomic.Int32{},
-		useIndexTable: useIndexTable,
+		db:        db,
+		newComics: atomic.Int32{},
+		strategy:  strategy,
+		tsConfig:  tsConfig,
 	}, nil
 }
 
@@ -60,10 +87,26 @@ func (cr *ComicsRepo) AddOne(ctx context.Context, ci models.ComicsInfo) (err err
 		return fmt.Errorf("mashal keywords error %w", err)
 	}
 
+	jsonTerms, err := json.Marshal(ci.Terms)
+	if err != nil {
+		return fmt.Errorf("mashal terms error %w", err)
+	}
+
+	jsonPositions, err := json.Marshal(ci.Positions)
+	if err != nil {
+		return fmt.Errorf("mashal positions error %w", err)
+	}
+
 	pb := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar)
 
-	query, args, err := pb.Insert("comics").Columns("id", "url", "keywords").
-		Values(ci.ID, ci.URL, string(jsonKeywords)).
+	query, args, err := pb.Insert("comics").
+		Columns("id", "url", "keywords", "terms", "length", "positions",
+			"title", "safe_title", "alt", "transcript", "link", "news", "published",
+			"image_hash", "image_size", "image_width", "image_height", "image_type").
+		Values(ci.ID, ci.URL, string(jsonKeywords), string(jsonTerms), ci.DocLength(), string(jsonPositions),
+			ci.Title, ci.SafeTitle, ci.Alt, ci.Transcript, ci.Link, ci.News,
+			squirrel.Expr("NULLIF(?, '')::date", ci.Date),
+			ci.Image.Hash, ci.Image.Size, ci.Image.Width, ci.Image.Height, ci.Image.ContentType).
 		ToSql()
 	if err != nil {
 		return fmt.Errorf("to sql error %w", err)
@@ -74,7 +117,7 @@ func (cr *ComicsRepo) AddOne(ctx context.Context, ci models.ComicsInfo) (err err
 		return fmt.Errorf("exec error %w", err)
 	}
 
-	if err := updateIndex(ctx, tx, ci.Keywords, ci.ID); err != nil {
+	if err := updateIndex(ctx, tx, ci); err != nil {
 		return err
 	}
 
@@ -86,35 +129,313 @@ func (cr *ComicsRepo) AddOne(ctx context.Context, ci models.ComicsInfo) (err err
 func (cr *ComicsRepo) GetByID(ctx context.Context, id string) (models.ComicsInfo, error) {
 	pb := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar)
 
-	query, args, err := pb.Select("id", "url", "keywords").From("comics").
-		Where(squirrel.Eq{"id": id}).ToSql()
+	query, args, err := pb.Select(comicsColumns...).From("comics").
+		Where(squirrel.Eq{"comics.id": id}).ToSql()
 	if err != nil {
 		return models.ComicsInfo{}, fmt.Errorf("to sql error %w", err)
 	}
 
-	row := cr.db.QueryRow(ctx, query, args...)
+	ci, err := scanComics(cr.db.QueryRow(ctx, query, args...))
+	if err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return models.ComicsInfo{}, models.ErrNotFound
+		}
+
+		return models.ComicsInfo{}, err
+	}
+
+	return ci, nil
+}
 
-	var ci models.ComicsInfo
+// GetByIDs возвращает найденные комиксы в порядке переданных id, отсутствующие id пропускаются.
+func (cr *ComicsRepo) GetByIDs(ctx context.Context, ids []string) ([]models.ComicsInfo, error) {
+	if len(ids) == 0 {
+		return []models.ComicsInfo{}, nil
+	}
 
-	var keywords string
+	pb := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar)
 
-	if err := row.Scan(&ci.ID, &ci.URL, &keywords); err != nil {
-		if errors.Is(err, pgx.ErrNoRows) {
-			return models.ComicsInfo{}, models.ErrNotFound
+	query, args, err := pb.Select(comicsColumns...).From("comics").
+		Where(squirrel.Eq{"comics.id": ids}).ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("to sql error %w", err)
+	}
+
+	found, err := cr.queryComics(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	byID := make(map[string]models.ComicsInfo, len(found))
+	for _, ci := range found {
+		byID[ci.ID] = ci
+	}
+
+	result := make([]models.ComicsInfo, 0, len(found))
+
+	for _, id := range ids {
+		if ci, ok := byID[id]; ok {
+			result = append(result, ci)
 		}
+	}
 
-		return models.ComicsInfo{}, fmt.Errorf("scan error %w", err)
+	return result, nil
+}
+
+// GetMissingIDs возвращает отсутствующие в таблице comics id от 1 до maxID включительно.
+func (cr *ComicsRepo) GetMissingIDs(ctx context.Context, maxID int) ([]string, error) {
+	pb := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar)
+
+	query, args, err := pb.Select("g.id").
+		From("generate_series(1, ?::int) g(id)").
+		LeftJoin("comics ON comics.id = g.id").
+		Where(squirrel.Eq{"comics.id": nil}).
+		OrderBy("g.id").ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("to sql error %w", err)
 	}
 
-	if err := json.Unmarshal([]byte(keywords), &ci.Keywords); err != nil {
-		return models.ComicsInfo{}, fmt.Errorf("unmarshal error %w", err)
+	args = append([]interface{}{maxID}, args...) // From не принимает аргументы, maxID соответствует $1.
+
+	rows, err := cr.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query error %w", err)
 	}
 
-	return ci, nil
+	defer rows.Close()
+
+	result := make([]string, 0)
+
+	for rows.Next() {
+		var id int
+
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("scan error %w", err)
+		}
+
+		result = append(result, strconv.Itoa(id))
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error %w", err)
+	}
+
+	return result, nil
+}
+
+// GetAllIDs возвращает id всех комиксов по возрастанию.
+func (cr *ComicsRepo) GetAllIDs(ctx context.Context) ([]string, error) {
+	pb := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar)
+
+	query, _, err := pb.Select("id").From("comics").OrderBy("id").ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("to sql error %w", err)
+	}
+
+	rows, err := cr.db.Query(ctx, query)
+	if err != nil {
+		return nil, fmt.Errorf("query error %w", err)
+	}
+
+	defer rows.Close()
+
+	result := make([]string, 0)
+
+	for rows.Next() {
+		var id int
+
+		if err := rows.Scan(&id); err != nil {
+			return nil, fmt.Errorf("scan error %w", err)
+		}
+
+		result = append(result, strconv.Itoa(id))
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error %w", err)
+	}
+
+	return result, nil
+}
+
+func (cr *ComicsRepo) SetImage(ctx context.Context, id string, img models.Image) error {
+	pb := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar)
+
+	query, args, err := pb.Update("comics").
+		Set("image_hash", img.Hash).
+		Set("image_size", img.Size).
+		Set("image_width", img.Width).
+		Set("image_height", img.Height).
+		Set("image_type", img.ContentType).
+		Where(squirrel.Eq{"id": id}).ToSql()
+	if err != nil {
+		return fmt.Errorf("to sql error %w", err)
+	}
+
+	tag, err := cr.db.Exec(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("exec error %w", err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return models.ErrNotFound
+	}
+
+	return nil
+}
+
+// ReplaceIndex записывает все пачки build в одной транзакции, поэтому до ее фиксации
+// поиск работает по старому индексу. Ключевые слова, которые больше не встречаются
+// ни в одном комиксе, удаляются.
+func (cr *ComicsRepo) ReplaceIndex(ctx context.Context, build func(put models.PutIndexFunc) error) (err error) {
+	tx, err := cr.db.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("begin tx error %w", err)
+	}
+
+	defer func() {
+		err = pgtools.CommitOrRollback(ctx, tx, err, "replace index")
+	}()
+
+	err = build(func(ctx context.Context, comics []models.ComicsInfo) error {
+		for _, ci := range comics {
+			if err := replaceIndex(ctx, tx, ci); err != nil {
+				return fmt.Errorf("replace index of %s: %w", ci.ID, err)
+			}
+		}
+
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return deleteOrphanKeywords(ctx, tx)
+}
+
+// replaceIndex обновляет индекс комикса в comics и заменяет его строки в keyword_comics_map.
+func replaceIndex(ctx context.Context, tx pgx.Tx, ci models.ComicsInfo) error {
+	jsonKeywords, err := json.Marshal(ci.Keywords)
+	if err != nil {
+		return fmt.Errorf("mashal keywords error %w", err)
+	}
+
+	jsonTerms, err := json.Marshal(ci.Terms)
+	if err != nil {
+		return fmt.Errorf("mashal terms error %w", err)
+	}
+
+	jsonPositions, err := json.Marshal(ci.Positions)
+	if err != nil {
+		return fmt.Errorf("mashal positions error %w", err)
+	}
+
+	pb := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar)
+
+	query, args, err := pb.Update("comics").
+		Set("keywords", string(jsonKeywords)).
+		Set("terms", string(jsonTerms)).
+		Set("length", ci.DocLength()).
+		Set("positions", string(jsonPositions)).
+		Where(squirrel.Eq{"id": ci.ID}).ToSql()
+	if err != nil {
+		return fmt.Errorf("to sql error %w", err)
+	}
+
+	tag, err := tx.Exec(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("exec error %w", err)
+	}
+
+	if tag.RowsAffected() == 0 {
+		return models.ErrNotFound
+	}
+
+	query, args, err = pb.Delete("keyword_comics_map").Where(squirrel.Eq{"comics_id": ci.ID}).ToSql()
+	if err != nil {
+		return fmt.Errorf("to sql error %w", err)
+	}
+
+	if _, err = tx.Exec(ctx, query, args...); err != nil {
+		return fmt.Errorf("exec error %w", err)
+	}
+
+	return updateIndex(ctx, tx, ci)
 }
 
-func (cr *ComicsRepo) GetByWord(ctx context.Context, word string, resultLen int) ([]models.ComicsInfo, error) {
-	result := make([]models.ComicsInfo, 0, resultLen)
+func (cr *ComicsRepo) GetByWord(ctx context.Context, word string, page models.Page) ([]models.ComicsInfo, error) {
+	pb := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar)
+
+	var sb squirrel.SelectBuilder
+
+	if cr.useTable(ctx) {
+		sb = pb.Select(comicsColumns...).From("comics").
+			Join("keyword_comics_map kc ON kc.comics_id = comics.id").
+			Join("keywords k ON k.id = kc.keyword_id").
+			Where(squirrel.Eq{"k.keyword": word})
+	} else {
+		contains, err := keywordsContain(word)
+		if err != nil {
+			return nil, err
+		}
+
+		sb = pb.Select(comicsColumns...).From("comics").Where(contains)
+	}
+
+	sb = sb.OrderBy("comics.id").Offset(uint64(max(page.Offset, 0)))
+	if page.Limit > 0 {
+		sb = sb.Limit(uint64(page.Limit))
+	}
+
+	query, args, err := sb.ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("to sql error %w", err)
+	}
+
+	return cr.queryComics(ctx, query, args...)
+}
+
+// keywordsContain возвращает условие "в keywords есть word". Значение для @> кодируется
+// json.Marshal: слово из запроса может содержать кавычки и обратные слэши.
+func keywordsContain(word string) (squirrel.Sqlizer, error) { //nolint:ireturn
+	data, err := json.Marshal([]string{word})
+	if err != nil {
+		return nil, fmt.Errorf("marshal keyword error %w", err)
+	}
+
+	return squirrel.Expr("keywords @> ?", string(data)), nil
+}
+
+func (cr *ComicsRepo) queryComics(ctx context.Context, query string, args ...interface{}) ([]models.ComicsInfo, error) {
+	rows, err := cr.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query error %w", err)
+	}
+
+	defer rows.Close()
+
+	result := make([]models.ComicsInfo, 0)
+
+	for rows.Next() {
+		m, err := scanComics(rows)
+		if err != nil {
+			return nil, err
+		}
+
+		result = append(result, m)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error %w", err)
+	}
+
+	return result, nil
+}
+
+// GetPostings возвращает частоту слова и длину каждого комикса, содержащего слово.
+// Для строк, записанных до миграции 000003, частота считается равной 1,
+// а длина — количеству ключевых слов.
+func (cr *ComicsRepo) GetPostings(ctx context.Context, word string) ([]models.Posting, error) {
 	pb := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar)
 
 	var query string
@@ -123,20 +444,29 @@ func (cr *ComicsRepo) GetByWord(ctx context.Context, word string, resultLen int)
 
 	var err error
 
-	if cr.useIndexTable {
-		query, args, err = pb.Select("comics.id", "comics.url", "comics.keywords").From("comics").
-			Join("keyword_comics_map kc ON kc.comics_id = comics.id").
+	if cr.useTable(ctx) {
+		query, args, err = pb.Select("kc.comics_id", "kc.tf", docLengthExpr, "COALESCE(kc.positions, '{}')").
+			From("keyword_comics_map kc").
 			Join("keywords k ON k.id = kc.keyword_id").
+			Join("comics ON comics.id = kc.comics_id").
 			Where(squirrel.Eq{"k.keyword": word}).ToSql()
-		if err != nil {
-			return nil, fmt.Errorf("to sql error %w", err)
-		}
 	} else {
-		query, args, err = pb.Select("id", "url", "keywords").From("comics").
-			Where(squirrel.Expr("keywords @> ?", fmt.Sprintf(`"%s"`, word))).ToSql()
-		if err != nil {
-			return nil, fmt.Errorf("to sql error %w", err)
+		var contains squirrel.Sqlizer
+
+		if contains, err = keywordsContain(word); err != nil {
+			return nil, err
 		}
+
+		query, args, err = pb.Select("id").
+			Column(squirrel.Expr("COALESCE((terms->>?)::int, 1)", word)).
+			Column(docLengthExpr).
+			Column(squirrel.Expr("COALESCE(positions->?, '{}')", word)).
+			From("comics").
+			Where(contains).ToSql()
+	}
+
+	if err != nil {
+		return nil, fmt.Errorf("to sql error %w", err)
 	}
 
 	rows, err := cr.db.Query(ctx, query, args...)
@@ -146,25 +476,130 @@ func (cr *ComicsRepo) GetByWord(ctx context.Context, word string, resultLen int)
 
 	defer rows.Close()
 
+	result := make([]models.Posting, 0)
+
 	for rows.Next() {
-		var m models.ComicsInfo
+		var p models.Posting
 
-		var keywordsJSON string
+		var positions string
 
-		if err := rows.Scan(&m.ID, &m.URL, &keywordsJSON); err != nil {
+		if err := rows.Scan(&p.ID, &p.TermFreq, &p.Length, &positions); err != nil {
 			return nil, fmt.Errorf("scan error %w", err)
 		}
 
-		if err := json.Unmarshal([]byte(keywordsJSON), &m.Keywords); err != nil {
+		if err := json.Unmarshal([]byte(positions), &p.Positions); err != nil {
 			return nil, fmt.Errorf("unmarshal error %w", err)
 		}
 
-		result = append(result, m)
+		result = append(result, p)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error %w", err)
 	}
 
 	return result, nil
 }
 
+func (cr *ComicsRepo) GetStats(ctx context.Context) (models.IndexStats, error) {
+	pb := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar)
+
+	query, _, err := pb.Select("COUNT(id)", "COALESCE(AVG("+docLengthExpr+"), 0)").From("comics").ToSql()
+	if err != nil {
+		return models.IndexStats{}, fmt.Errorf("to sql error %w", err)
+	}
+
+	var stats models.IndexStats
+
+	if err := cr.db.QueryRow(ctx, query).Scan(&stats.Total, &stats.AvgLength); err != nil {
+		return models.IndexStats{}, fmt.Errorf("scan error %w", err)
+	}
+
+	return stats, nil
+}
+
+func (cr *ComicsRepo) GetVocabulary(ctx context.Context) ([]models.Keyword, error) {
+	pb := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar)
+
+	var sb squirrel.SelectBuilder
+
+	if cr.useTable(ctx) {
+		sb = pb.Select("k.keyword", "COUNT(kc.comics_id)").From("keywords k").
+			Join("keyword_comics_map kc ON kc.keyword_id = k.id").
+			GroupBy("k.keyword")
+	} else {
+		sb = pb.Select("kw", "COUNT(*)").From("comics, jsonb_array_elements_text(comics.keywords) kw").
+			GroupBy("kw")
+	}
+
+	query, args, err := sb.ToSql()
+	if err != nil {
+		return nil, fmt.Errorf("to sql error %w", err)
+	}
+
+	rows, err := cr.db.Query(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("query error %w", err)
+	}
+
+	defer rows.Close()
+
+	result := make([]models.Keyword, 0)
+
+	for rows.Next() {
+		var k models.Keyword
+
+		if err := rows.Scan(&k.Word, &k.DocFreq); err != nil {
+			return nil, fmt.Errorf("scan error %w", err)
+		}
+
+		result = append(result, k)
+	}
+
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("rows error %w", err)
+	}
+
+	return result, nil
+}
+
+func (cr *ComicsRepo) GetIndexMeta(ctx context.Context, key string) (string, error) {
+	pb := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar)
+
+	query, args, err := pb.Select("value").From("index_meta").Where(squirrel.Eq{"key": key}).ToSql()
+	if err != nil {
+		return "", fmt.Errorf("to sql error %w", err)
+	}
+
+	var value string
+
+	if err := cr.db.QueryRow(ctx, query, args...).Scan(&value); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return "", models.ErrNotFound
+		}
+
+		return "", fmt.Errorf("scan error %w", err)
+	}
+
+	return value, nil
+}
+
+func (cr *ComicsRepo) SetIndexMeta(ctx context.Context, key, value string) error {
+	pb := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar)
+
+	query, args, err := pb.Insert("index_meta").Columns("key", "value").Values(key, value).
+		Suffix("ON CONFLICT (key) DO UPDATE SET value = EXCLUDED.value").ToSql()
+	if err != nil {
+		return fmt.Errorf("to sql error %w", err)
+	}
+
+	if _, err := cr.db.Exec(ctx, query, args...); err != nil {
+		return fmt.Errorf("exec error %w", err)
+	}
+
+	return nil
+}
+
 func (cr *ComicsRepo) Flush(ctx context.Context, _ bool) (int, int, error) {
 	pb := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar)
 
@@ -187,10 +622,46 @@ func (cr *ComicsRepo) Flush(ctx context.Context, _ bool) (int, int, error) {
 	return total, newC, nil
 }
 
-func updateIndex(ctx context.Context, tx pgx.Tx, keywords []string, comicsID string) error {
+// useTable сообщает, ищет ли запрос по keyword_comics_map (см. models.WithIndexStrategy).
+func (cr *ComicsRepo) useTable(ctx context.Context) bool {
+	return models.IndexStrategyFrom(ctx, cr.strategy) == models.IndexTable
+}
+
+func scanComics(row pgx.Row) (models.ComicsInfo, error) {
+	var ci models.ComicsInfo
+
+	var keywords, terms, positions string
+
+	if err := row.Scan(&ci.ID, &ci.URL, &keywords, &terms, &ci.Length, &positions,
+		&ci.Title, &ci.SafeTitle, &ci.Alt, &ci.Transcript, &ci.Link, &ci.News, &ci.Date,
+		&ci.Image.Hash, &ci.Image.Size, &ci.Image.Width, &ci.Image.Height, &ci.Image.ContentType); err != nil {
+		return models.ComicsInfo{}, fmt.Errorf("scan error %w", err)
+	}
+
+	if err := json.Unmarshal([]byte(positions), &ci.Positions); err != nil {
+		return models.ComicsInfo{}, fmt.Errorf("unmarshal error %w", err)
+	}
+
+	if err := json.Unmarshal([]byte(keywords), &ci.Keywords); err != nil {
+		return models.ComicsInfo{}, fmt.Errorf("unmarshal error %w", err)
+	}
+
+	if err := json.Unmarshal([]byte(terms), &ci.Terms); err != nil {
+		return models.ComicsInfo{}, fmt.Errorf("unmarshal error %w", err)
+	}
+
+	return ci, nil
+}
+
+func updateIndex(ctx context.Context, tx pgx.Tx, ci models.ComicsInfo) error {
 	pb := squirrel.StatementBuilder.PlaceholderFormat(squirrel.Dollar)
 
-	for _, keyword := range keywords {
+	for _, keyword := range ci.Keywords {
+		jsonPositions, err := json.Marshal(ci.Positions[keyword])
+		if err != nil {
+			return fmt.Errorf("mashal positions error %w", err)
+		}
+
 		query, args, err := pb.Insert("keywords").Columns("keyword").
 			Values(keyword).
 			Suffix("ON CONFLICT (keyword) DO NOTHING"). // Игнорируем конфликт уникальности
@@ -207,8 +678,11 @@ func updateIndex(ctx context.Context, tx pgx.Tx, keywords []string, comicsID str
 		subQuery := squirrel.Select("id").From("keywords").Where(squirrel.Eq{"keyword": keyword})
 
 		query, args, err = pb.Insert("keyword_comics_map").
-			Columns("keyword_id", "comics_id").
-			Select(subQuery.Column(squirrel.Expr("? AS comics_id", comicsID))).
+			Columns("keyword_id", "comics_id", "tf", "positions").
+			Select(subQuery.
+				Column(squirrel.Expr("? AS comics_id", ci.ID)).
+				Column(squirrel.Expr("? AS tf", ci.TermFreq(keyword))).
+				Column(squirrel.Expr("?::jsonb AS positions", string(jsonPositions)))).
 			Suffix("ON CONFLICT (keyword_id, comics_id) DO NOTHING").
 			ToSql()
 		if err != nil {
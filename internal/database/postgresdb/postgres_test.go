@@ -0,0 +1,84 @@
+package postgresdb_test
+
+import (
+	"context"
+	"os"
+	"testing"
+
+	"github.com/Leopold1975/yadro_app/internal/database/postgresdb"
+	"github.com/Leopold1975/yadro_app/internal/models"
+	"github.com/Leopold1975/yadro_app/internal/pkg/config"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/stretchr/testify/require"
+)
+
+// testDB подключается к базе из POSTGRES_TEST_ADDR, POSTGRES_USER, POSTGRES_PASSWORD
+// и POSTGRES_DB, применяет миграции и очищает таблицы комиксов. Второе значение —
+// пул для запросов, которых нет в ComicsRepo.
+func testDB(t *testing.T, lang string) (*postgresdb.ComicsRepo, *pgxpool.Pool) {
+	t.Helper()
+
+	addr := os.Getenv("POSTGRES_TEST_ADDR")
+	if addr == "" {
+		t.Skip("POSTGRES_TEST_ADDR is not set")
+	}
+
+	// миграции читаются из migrations в корне репозитория.
+	if _, err := os.Stat("migrations"); err != nil {
+		wd, err := os.Getwd()
+		require.NoError(t, err)
+		require.NoError(t, os.Chdir("../../.."))
+		t.Cleanup(func() { os.Chdir(wd) }) //nolint:errcheck
+	}
+
+	cfg := config.DB{ //nolint:exhaustruct
+		Type:     "postgres",
+		Addr:     addr,
+		Username: os.Getenv("POSTGRES_USER"),
+		Password: os.Getenv("POSTGRES_PASSWORD"),
+		DB:       os.Getenv("POSTGRES_DB"),
+		SSLmode:  "disable",
+		MaxConns: "4",
+		Version:  15,
+	}
+
+	ctx := context.Background()
+
+	db, err := postgresdb.New(ctx, cfg, models.IndexJSONB, lang)
+	require.NoError(t, err)
+
+	pool, err := pgxpool.New(ctx, "postgres://"+cfg.Username+":"+cfg.Password+"@"+cfg.Addr+"/"+cfg.DB+
+		"?sslmode="+cfg.SSLmode)
+	require.NoError(t, err)
+	t.Cleanup(pool.Close)
+
+	_, err = pool.Exec(ctx, "TRUNCATE comics, keywords, keyword_comics_map")
+	require.NoError(t, err)
+
+	return &db, pool
+}
+
+func TestGetByWordSpecialChars(t *testing.T) {
+	ctx := context.Background()
+
+	db, _ := testDB(t, "english")
+
+	word := `a"b\c`
+
+	err := db.AddOne(ctx, models.ComicsInfo{ //nolint:exhaustruct
+		ID: "9002", URL: "https://example.com/9002.png", Title: "Quotes",
+		Keywords: []string{word}, Terms: map[string]int{word: 1}, Length: 1,
+	})
+	require.NoError(t, err)
+
+	// кавычки и обратные слэши в слове не ломают значение jsonb.
+	found, err := db.GetByWord(ctx, word, models.Page{Limit: 10, Offset: 0})
+	require.NoError(t, err)
+	require.Len(t, found, 1)
+	require.Equal(t, "9002", found[0].ID)
+
+	postings, err := db.GetPostings(ctx, word)
+	require.NoError(t, err)
+	require.Len(t, postings, 1)
+	require.Equal(t, "9002", postings[0].ID)
+}
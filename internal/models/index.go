@@ -0,0 +1,67 @@
+package models
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// IndexStrategy определяет, по какому представлению индекса хранилище ищет комиксы.
+type IndexStrategy string
+
+const (
+	// IndexJSONB — поиск по колонке comics.keywords.
+	IndexJSONB IndexStrategy = "jsonb"
+	// IndexTable — поиск по таблицам keywords и keyword_comics_map.
+	IndexTable IndexStrategy = "table"
+	// IndexFullText — полнотекстовый поиск Postgres по колонке comics.tsv
+	// с ранжированием ts_rank_cd вместо собственного стемминга и BM25.
+	IndexFullText IndexStrategy = "tsvector"
+)
+
+var ErrUnknownStrategy = errors.New("unknown index strategy")
+
+// ParseIndexStrategy проверяет название стратегии.
+func ParseIndexStrategy(s string) (IndexStrategy, error) {
+	switch st := IndexStrategy(s); st {
+	case IndexJSONB, IndexTable, IndexFullText:
+		return st, nil
+	default:
+		return "", fmt.Errorf("%w: %q", ErrUnknownStrategy, s)
+	}
+}
+
+type strategyKey struct{}
+
+// WithIndexStrategy возвращает контекст, в котором хранилище ищет по стратегии s
+// вместо выбранной при запуске.
+func WithIndexStrategy(ctx context.Context, s IndexStrategy) context.Context {
+	return context.WithValue(ctx, strategyKey{}, s)
+}
+
+// IndexStrategyFrom возвращает стратегию из контекста или def, если она не задана.
+func IndexStrategyFrom(ctx context.Context, def IndexStrategy) IndexStrategy {
+	if s, ok := ctx.Value(strategyKey{}).(IndexStrategy); ok {
+		return s
+	}
+
+	return def
+}
+
+// IndexDiff — расхождение представлений индекса одного комикса.
+// Missing — слова из comics.keywords, которых нет в keyword_comics_map, Extra — наоборот,
+// Changed — слова из обоих представлений с разными частотами или позициями.
+type IndexDiff struct {
+	ID      string
+	Missing []string
+	Extra   []string
+	Changed []string
+}
+
+// IndexReport — результат проверки согласованности индекса.
+// OrphanKeywords — слова из keywords, не связанные ни с одним комиксом.
+type IndexReport struct {
+	Checked        int
+	Diverged       []IndexDiff
+	OrphanKeywords int
+}
@@ -1,47 +1,230 @@
 package models
 
 import (
+	"context"
 	"fmt"
+	"sort"
 	"strconv"
+	"time"
 
 	"github.com/Leopold1975/yadro_app/pkg/words"
 )
 
 type ComicsInfo struct {
-	ID       string   `json:"id"`
-	URL      string   `json:"url"`
-	Keywords []string `json:"keywords"`
+	ID         string         `json:"id"`
+	URL        string         `json:"url"`
+	Title      string         `json:"title,omitempty"`
+	SafeTitle  string         `json:"safeTitle,omitempty"`
+	Alt        string         `json:"alt,omitempty"`
+	Transcript string         `json:"transcript,omitempty"`
+	Link       string         `json:"link,omitempty"`
+	News       string         `json:"news,omitempty"`
+	Date       string         `json:"date,omitempty"` // дата публикации в формате DateLayout.
+	Keywords   []string       `json:"keywords"`
+	Terms      map[string]int `json:"terms,omitempty"`  // частота каждого ключевого слова.
+	Length     int            `json:"length,omitempty"` // количество слов после нормализации.
+	// Positions — позиции каждого ключевого слова по полям: keyword -> field -> позиции.
+	Positions map[string]Positions `json:"positions,omitempty"`
+	Image     Image                `json:"image"` // локальная копия картинки, если она скачана.
+}
+
+// Image описывает картинку комикса в локальном хранилище.
+// Картинка адресуется SHA-256 хэшем содержимого, пустой Hash означает, что картинки нет.
+type Image struct {
+	Hash        string `json:"hash,omitempty"`
+	Size        int64  `json:"size,omitempty"`
+	Width       int    `json:"width,omitempty"`
+	Height      int    `json:"height,omitempty"`
+	ContentType string `json:"contentType,omitempty"`
+}
+
+// Positions хранит номера слов в нормализованном тексте каждого поля комикса.
+type Positions map[string][]int
+
+// Поля комикса, по которым строится индекс.
+const (
+	FieldTitle      = "title"
+	FieldAlt        = "alt"
+	FieldTranscript = "transcript"
+)
+
+const DateLayout = "2006-01-02"
+
+// LessID сравнивает id комиксов как числа, чтобы "10" шел после "9".
+// Нечисловые id сравниваются как строки.
+func LessID(a, b string) bool {
+	ai, errA := strconv.Atoi(a)
+	bi, errB := strconv.Atoi(b)
+
+	if errA != nil || errB != nil {
+		return a < b
+	}
+
+	return ai < bi
+}
+
+// TermFreq возвращает частоту слова. Для комиксов, сохраненных
+// до появления Terms, каждое ключевое слово считается встреченным один раз.
+func (ci ComicsInfo) TermFreq(word string) int {
+	if f, ok := ci.Terms[word]; ok {
+		return f
+	}
+
+	return 1
+}
+
+// DocLength возвращает длину документа для ранжирования.
+func (ci ComicsInfo) DocLength() int {
+	if ci.Length > 0 {
+		return ci.Length
+	}
+
+	return len(ci.Keywords)
+}
+
+// Posting описывает вхождение слова в комикс.
+// Positions пуст для комиксов, проиндексированных без позиций.
+type Posting struct {
+	ID        string
+	TermFreq  int
+	Length    int
+	Positions Positions
+}
+
+// Keyword — слово словаря индекса и количество комиксов, в которых оно встречается.
+type Keyword struct {
+	Word    string
+	DocFreq int
+}
+
+// Page задает окно выборки. Limit <= 0 означает отсутствие ограничения.
+type Page struct {
+	Limit  int
+	Offset int
+}
+
+// IndexStats содержит статистику коллекции, необходимую для BM25.
+type IndexStats struct {
+	Total     int
+	AvgLength float64
 }
 
 var ErrNotFound = fmt.Errorf("resource not found") //nolint:perfsprint
 
 type XKCDModel struct {
 	Num        int    `json:"num"`
-	Title      string `json:"safe_title"` //nolint:tagliatelle
+	Title      string `json:"title"`
+	SafeTitle  string `json:"safe_title"` //nolint:tagliatelle
 	Transcript string `json:"transcript"`
 	Alt        string `json:"alt"`
 	Img        string `json:"img"`
+	Link       string `json:"link"`
+	News       string `json:"news"`
+	Year       string `json:"year"`
+	Month      string `json:"month"`
+	Day        string `json:"day"`
 }
 
-func ToDBComicsInfo(m XKCDModel) (ComicsInfo, error) {
-	keywords, err := words.StemWords(m.Alt + " " + m.Transcript + " " + m.Title)
-	if err != nil {
-		return ComicsInfo{}, fmt.Errorf("stem words error: %w", err)
+// Date собирает дату публикации из полей year, month и day.
+// Возвращает пустую строку, если дата не указана или некорректна.
+func (m XKCDModel) Date() string {
+	year, errY := strconv.Atoi(m.Year)
+	month, errM := strconv.Atoi(m.Month)
+	day, errD := strconv.Atoi(m.Day)
+
+	if errY != nil || errM != nil || errD != nil {
+		return ""
 	}
 
-	return ComicsInfo{
-		ID:       strconv.Itoa(m.Num),
-		URL:      m.Img,
-		Keywords: keywords,
-	}, nil
+	return time.Date(year, time.Month(month), day, 0, 0, 0, 0, time.UTC).Format(DateLayout)
+}
+
+// ToDBComicsInfo переводит ответ xkcd в комикс и строит его индекс стеммером s.
+func ToDBComicsInfo(m XKCDModel, s words.Stemmer) (ComicsInfo, error) {
+	title := m.Title
+	if title == "" {
+		title = m.SafeTitle
+	}
+
+	ci := ComicsInfo{
+		ID:         strconv.Itoa(m.Num),
+		URL:        m.Img,
+		Title:      title,
+		SafeTitle:  m.SafeTitle,
+		Alt:        m.Alt,
+		Transcript: m.Transcript,
+		Link:       m.Link,
+		News:       m.News,
+		Date:       m.Date(),
+		Keywords:   nil,
+		Terms:      nil,
+		Length:     0,
+		Positions:  nil,
+		Image:      Image{}, //nolint:exhaustruct
+	}
+
+	return IndexComics(ci, s), nil
+}
+
+// IndexComics заново строит ключевые слова, частоты и позиции комикса
+// из его заголовка, alt и транскрипта стеммером s.
+func IndexComics(ci ComicsInfo, s words.Stemmer) ComicsInfo {
+	fields := []struct {
+		name string
+		text string
+	}{
+		{FieldAlt, ci.Alt},
+		{FieldTranscript, ci.Transcript},
+		{FieldTitle, ci.Title},
+	}
+
+	terms := make(map[string]int)
+	positions := make(map[string]Positions)
+	length := 0
+
+	for _, f := range fields {
+		for i, w := range words.Tokens(s, f.text) {
+			terms[w]++
+
+			if positions[w] == nil {
+				positions[w] = make(Positions)
+			}
+
+			positions[w][f.name] = append(positions[w][f.name], i)
+			length++
+		}
+	}
+
+	keywords := make([]string, 0, len(terms))
+	for w := range terms {
+		keywords = append(keywords, w)
+	}
+
+	sort.Strings(keywords)
+
+	ci.Keywords = keywords
+	ci.Terms = terms
+	ci.Length = length
+	ci.Positions = positions
+
+	return ci
+}
+
+// PutIndexFunc записывает пачку комиксов с перестроенным индексом при замене индекса хранилища.
+type PutIndexFunc func(ctx context.Context, comics []ComicsInfo) error
+
+// HasText сообщает, есть ли у комикса текст для построения индекса. У комиксов,
+// сохраненных до появления метаданных, текста нет, и их индекс нельзя перестроить.
+func (ci ComicsInfo) HasText() bool {
+	return ci.Title != "" || ci.Alt != "" || ci.Transcript != ""
 }
 
-func ToDBComicsInfos(models []XKCDModel) ([]ComicsInfo, error) {
+func ToDBComicsInfos(models []XKCDModel, s words.Stemmer) ([]ComicsInfo, error) {
 	result := make([]ComicsInfo, 0, len(models))
 	errs := make([]error, 0)
 
 	for _, m := range models {
-		ci, err := ToDBComicsInfo(m)
+		ci, err := ToDBComicsInfo(m, s)
 		if err != nil {
 			errs = append(errs, err)
 
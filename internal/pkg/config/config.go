@@ -15,18 +15,26 @@ type Config struct {
 	Log            LogLvl         `yaml:"log"`
 	Server         Server         `yaml:"server"`
 	RefreshTime    RefreshTime    `yaml:"refreshTime"`
+	Refresh        Refresh        `yaml:"refresh"`
 	Auth           Auth           `yaml:"auth"`
 	Ratelimit      Ratelimit      `env-required:"true"            yaml:"rate_limit"` //nolint:tagliatelle
+	Search         Search         `yaml:"search"`
+	Client         Client         `yaml:"client"`
+	Images         Images         `yaml:"images"`
+	Save           Save           `yaml:"save"`
 }
 
 type DB struct {
-	Addr     string `yaml:"addr"`
-	Username string `env:"POSTGRES_USER"     env-required:"true" yaml:"username"`
-	Password string `env:"POSTGRES_PASSWORD" yaml:"password"`
-	DB       string `env:"POSTGRES_DB"       env-required:"true" yaml:"db"`
-	SSLmode  string `yaml:"sslmode"`
-	MaxConns string `yaml:"maxConns"`
-	Version  int    `yaml:"version"`
+	Type      string `env-default:"postgres" yaml:"type"`
+	JSONPath  string `yaml:"json_path"`  //nolint:tagliatelle
+	IndexPath string `yaml:"index_path"` //nolint:tagliatelle
+	Addr      string `yaml:"addr"`
+	Username  string `env:"POSTGRES_USER"     env-required:"true" yaml:"username"`
+	Password  string `env:"POSTGRES_PASSWORD" yaml:"password"`
+	DB        string `env:"POSTGRES_DB"       env-required:"true" yaml:"db"`
+	SSLmode   string `yaml:"sslmode"`
+	MaxConns  string `yaml:"maxConns"`
+	Version   int    `yaml:"version"`
 }
 
 type Server struct {
@@ -35,9 +43,112 @@ type Server struct {
 	WriteTimeout time.Duration `yaml:"writeTimeout"`
 }
 
+// Auth — параметры аутентификации. TokenMaxTime — время жизни access-токена,
+// RefreshTokenMaxTime — refresh-токена, которым access-токен обновляется через /refresh.
 type Auth struct {
-	Secret       string        `env:"SECRET"          env-required:"true" yaml:"secret"`
-	TokenMaxTime time.Duration `yaml:"token_max_time"` //nolint:tagliatelle
+	Secret              string         `env:"SECRET"            env-required:"true" yaml:"secret"`
+	TokenMaxTime        time.Duration  `env-default:"15m"       yaml:"token_max_time"`         //nolint:tagliatelle
+	RefreshTokenMaxTime time.Duration  `env-default:"720h"      yaml:"refresh_token_max_time"` //nolint:tagliatelle
+	PasswordPolicy      PasswordPolicy `yaml:"password_policy"`                                //nolint:tagliatelle
+	Signing             Signing        `yaml:"signing"`
+	Lockout             Lockout        `yaml:"lockout"`
+	Bootstrap           Bootstrap      `yaml:"-"`
+}
+
+// Signing — ключи подписи токенов. Algorithm HS256 подписывает токены секретом Secret,
+// RS256 и EdDSA — закрытыми ключами из KeysDir (<kid>.pem, PKCS#8 или PKCS#1),
+// открытые ключи которых публикуются в /.well-known/jwks.json. Файлы <kid>.pub.pem
+// только проверяют токены. Если Rotation не нулевой, сервер сам создает новый ключ
+// раз в Rotation и удаляет замененные после истечения подписанных ими токенов.
+type Signing struct {
+	Algorithm string        `env-default:"HS256" yaml:"algorithm"`
+	KeysDir   string        `yaml:"keys_dir"` //nolint:tagliatelle
+	Rotation  time.Duration `yaml:"rotation"`
+}
+
+// Lockout — защита входа от перебора. Неудачные попытки считаются за последние Window
+// отдельно для имени пользователя (до его успешного входа) и для IP-адреса.
+// После n неудачных попыток для имени следующая возможна через Delay·2^(n-1),
+// а после MaxAttempts имя блокируется на Duration с последней неудачи.
+// IP-адрес блокируется на Duration после IPMaxAttempts неудач по любым именам.
+// Попытки хранятся Retention, но не меньше Window, и служат журналом входов.
+type Lockout struct {
+	MaxAttempts   int           `env-default:"5"    yaml:"max_attempts"`    //nolint:tagliatelle
+	IPMaxAttempts int           `env-default:"50"   yaml:"ip_max_attempts"` //nolint:tagliatelle
+	Window        time.Duration `env-default:"15m"  yaml:"window"`
+	Delay         time.Duration `env-default:"1s"   yaml:"delay"`
+	Duration      time.Duration `env-default:"15m"  yaml:"duration"`
+	Retention     time.Duration `env-default:"720h" yaml:"retention"`
+}
+
+// PasswordPolicy — требования к паролям пользователей: не короче MinLength символов
+// и не меньше MinClasses классов символов из четырех (строчные и заглавные буквы, цифры, прочие).
+type PasswordPolicy struct {
+	MinLength  int `env-default:"10" yaml:"min_length"`  //nolint:tagliatelle
+	MinClasses int `env-default:"3"  yaml:"min_classes"` //nolint:tagliatelle
+}
+
+// Bootstrap — первый администратор, которого создает команда bootstrap-admin.
+// Задается только переменными окружения, чтобы пароль не попадал в файл конфигурации.
+type Bootstrap struct {
+	Username string `env:"ADMIN_USERNAME" env-default:"admin"`
+	Password string `env:"ADMIN_PASSWORD"`
+}
+
+// Search — параметры поиска. Stemmer (porter2, snowball или noop) и Language
+// используются и при индексации, и при разборе запросов.
+// Strategy — стратегия поиска по умолчанию: jsonb, table или tsvector (только postgres).
+type Search struct {
+	DefaultLimit  int           `env-default:"10"      yaml:"default_limit"`  //nolint:tagliatelle
+	MaxLimit      int           `env-default:"100"     yaml:"max_limit"`      //nolint:tagliatelle
+	VocabularyTTL time.Duration `env-default:"5m"      yaml:"vocabulary_ttl"` //nolint:tagliatelle
+	Stemmer       string        `env-default:"porter2" yaml:"stemmer"`
+	Language      string        `env-default:"english" yaml:"language"`
+	Strategy      string        `env-default:"jsonb"   yaml:"strategy"`
+}
+
+// Client — параметры запросов к xkcd.com. Retry-After сервера соблюдается полностью,
+// но если он больше RetryAfterMax, запрос не повторяется; 0 — без ограничения.
+type Client struct {
+	Timeout       time.Duration `env-default:"5s"    yaml:"timeout"`
+	MaxRetries    int           `env-default:"3"     yaml:"max_retries"`     //nolint:tagliatelle
+	BackoffMin    time.Duration `env-default:"200ms" yaml:"backoff_min"`     //nolint:tagliatelle
+	BackoffMax    time.Duration `env-default:"10s"   yaml:"backoff_max"`     //nolint:tagliatelle
+	RetryAfterMax time.Duration `env-default:"1m"    yaml:"retry_after_max"` //nolint:tagliatelle
+	Breaker       Breaker       `yaml:"breaker"`
+}
+
+// Breaker — параметры circuit breaker: после Threshold неудачных запросов подряд
+// все запросы приостанавливаются на Cooldown. Threshold 0 отключает breaker.
+type Breaker struct {
+	Threshold int           `env-default:"10"  yaml:"threshold"`
+	Cooldown  time.Duration `env-default:"30s" yaml:"cooldown"`
+}
+
+// Images — локальное хранилище картинок комиксов. Если Enabled,
+// картинки скачиваются при загрузке комиксов в каталог Dir. Картинки уже
+// сохраненных комиксов докачивает команда backfill-images.
+type Images struct {
+	Enabled bool   `yaml:"enabled"`
+	Dir     string `env-default:"images" yaml:"dir"`
+}
+
+// Save — параметры сохранения загруженных комиксов: они копятся и сохраняются
+// пачками по BatchSize, но не реже чем раз в FlushInterval.
+type Save struct {
+	BatchSize     int           `env-default:"100" yaml:"batch_size"`     //nolint:tagliatelle
+	FlushInterval time.Duration `env-default:"2s"  yaml:"flush_interval"` //nolint:tagliatelle
+}
+
+// Refresh — расписание фонового обновления в формате schedule.Parse.
+// Если Schedule пуст, обновление выполняется ежедневно в RefreshTime по местному времени сервера.
+// Неудачный запуск повторяется до MaxRetries раз с задержкой от RetryMin, удваивающейся до RetryMax.
+type Refresh struct {
+	Schedule   string        `yaml:"schedule"`
+	RunOnStart bool          `yaml:"run_on_start"`                  //nolint:tagliatelle
+	MaxRetries int           `env-default:"3"   yaml:"max_retries"` //nolint:tagliatelle
+	RetryMin   time.Duration `env-default:"1m"  yaml:"retry_min"`   //nolint:tagliatelle
+	RetryMax   time.Duration `env-default:"30m" yaml:"retry_max"`   //nolint:tagliatelle
 }
 
 type Ratelimit struct {
@@ -1,6 +1,8 @@
 package jwtauth
 
 import (
+	"crypto/rand"
+	"encoding/hex"
 	"errors"
 	"fmt"
 	"time"
@@ -16,22 +18,60 @@ var (
 	ErrUnexpectedSigningMethod = errors.New("unexpected signing method")
 )
 
+// Claims — проверенные данные токена: Subject — имя пользователя,
+// ID — уникальный id токена, по которому его можно отозвать до истечения.
+type Claims struct {
+	ID        string
+	Subject   string
+	Role      models.Role
+	ExpiresAt time.Time
+}
+
+// jtiBytes — длина случайного id токена.
+const jtiBytes = 16
+
+// GetToken подписывает токен секретом HS256.
 func GetToken(user models.User, ttl time.Duration, secret string) (string, error) {
-	token := jwt.New(jwt.SigningMethodHS256)
+	return NewHMAC(secret).Sign(user, ttl)
+}
+
+// Sign выдает токен пользователю, подписанный активным ключом. Токены, подписанные
+// асимметричным ключом, содержат kid, по которому их проверяют.
+func (ks *KeySet) Sign(user models.User, ttl time.Duration) (string, error) {
+	k := ks.activeKey()
+	if k == nil {
+		return "", ErrNoSigningKey
+	}
+
+	token := jwt.New(k.method)
 
 	claims, ok := token.Claims.(jwt.MapClaims)
 	if !ok {
 		return "", ErrInvalidToken
 	}
 
-	if user.Role == "" {
+	if user.Role == "" || user.Username == "" {
 		return "", ErrNoClaim
 	}
 
+	jti := make([]byte, jtiBytes)
+	if _, err := rand.Read(jti); err != nil {
+		return "", fmt.Errorf("generate jti error: %w", err)
+	}
+
+	now := time.Now()
+
+	claims["jti"] = hex.EncodeToString(jti)
+	claims["sub"] = user.Username
 	claims["role"] = user.Role
-	claims["exp"] = time.Now().Add(ttl).Unix()
+	claims["iat"] = now.Unix()
+	claims["exp"] = now.Add(ttl).Unix()
+
+	if k.id != "" {
+		token.Header["kid"] = k.id
+	}
 
-	t, err := token.SignedString([]byte(secret))
+	t, err := token.SignedString(k.private)
 	if err != nil {
 		return "", fmt.Errorf("sign string error: %w", err)
 	}
@@ -39,42 +79,86 @@ func GetToken(user models.User, ttl time.Duration, secret string) (string, error
 	return t, nil
 }
 
-func ValidateTokenRole(tokenString string, secret string) (string, error) {
+func ValidateTokenRole(tokenString string, secret string) (models.Role, error) {
+	c, err := ValidateToken(tokenString, secret)
+	if err != nil {
+		return "", err
+	}
+
+	return c.Role, nil
+}
+
+// ValidateToken проверяет подпись секретом HS256 и срок действия токена и возвращает его данные.
+func ValidateToken(tokenString string, secret string) (Claims, error) {
+	return NewHMAC(secret).Validate(tokenString)
+}
+
+// Validate проверяет подпись ключом kid и срок действия токена и возвращает его данные.
+// Алгоритм токена должен совпадать с алгоритмом ключа. Ключ, которого нет в наборе,
+// ищется в каталоге ключей: его мог создать другой экземпляр сервера.
+func (ks *KeySet) Validate(tokenString string) (Claims, error) {
 	token, err := jwt.Parse(tokenString, func(t *jwt.Token) (interface{}, error) {
-		if _, ok := t.Method.(*jwt.SigningMethodHMAC); !ok {
+		kid, _ := t.Header["kid"].(string)
+
+		k := ks.lookup(kid)
+		if k == nil {
+			return nil, fmt.Errorf("%w %q", ErrUnknownKey, kid)
+		}
+
+		if t.Method.Alg() != k.method.Alg() {
 			return nil, fmt.Errorf("%w %v", ErrUnexpectedSigningMethod, t.Header["alg"])
 		}
 
-		return []byte(secret), nil
+		return k.public, nil
 	})
 	if err != nil {
 		jwtErr := new(jwt.ValidationError)
 		if errors.As(err, &jwtErr) {
 			if jwtErr.Errors == jwt.ValidationErrorExpired {
-				return "", ErrTokenExpired
+				return Claims{}, ErrTokenExpired
+			}
+
+			// ошибка keyfunc, например ErrUnknownKey: jwt.ValidationError не реализует Unwrap.
+			if jwtErr.Inner != nil {
+				return Claims{}, fmt.Errorf("parse token error: %w", jwtErr.Inner)
 			}
 		}
 
-		return "", fmt.Errorf("parse token error: %w", err)
+		return Claims{}, fmt.Errorf("parse token error: %w", err)
 	}
 
 	if claims, ok := token.Claims.(jwt.MapClaims); ok && token.Valid {
 		role, ok := claims["role"].(string)
 		if !ok {
-			return "", ErrNoClaim
+			return Claims{}, ErrNoClaim
+		}
+
+		sub, ok := claims["sub"].(string)
+		if !ok {
+			return Claims{}, ErrNoClaim
+		}
+
+		jti, ok := claims["jti"].(string)
+		if !ok {
+			return Claims{}, ErrNoClaim
 		}
 
 		exp, ok := claims["exp"].(float64)
 		if !ok {
-			return "", ErrNoClaim
+			return Claims{}, ErrNoClaim
 		}
 
 		if int64(exp) < time.Now().Unix() {
-			return "", ErrTokenExpired
+			return Claims{}, ErrTokenExpired
 		}
 
-		return role, nil
+		return Claims{
+			ID:        jti,
+			Subject:   sub,
+			Role:      models.Role(role),
+			ExpiresAt: time.Unix(int64(exp), 0),
+		}, nil
 	}
 
-	return "", ErrInvalidToken
+	return Claims{}, ErrInvalidToken
 }
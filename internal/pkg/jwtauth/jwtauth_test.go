@@ -27,6 +27,20 @@ func TestBasic(t *testing.T) {
 	role, err := jwtauth.ValidateTokenRole(token, secret)
 	require.NoError(t, err)
 	require.Equal(t, userExample.Role, role)
+
+	claims, err := jwtauth.ValidateToken(token, secret)
+	require.NoError(t, err)
+	require.Equal(t, userExample.Username, claims.Subject)
+	require.Equal(t, userExample.Role, claims.Role)
+	require.NotEmpty(t, claims.ID)
+	require.WithinDuration(t, time.Now().Add(defaultTTL), claims.ExpiresAt, time.Second)
+
+	other, err := jwtauth.GetToken(userExample, defaultTTL, secret)
+	require.NoError(t, err)
+
+	otherClaims, err := jwtauth.ValidateToken(other, secret)
+	require.NoError(t, err)
+	require.NotEqual(t, claims.ID, otherClaims.ID)
 }
 
 func TestValidateToken(t *testing.T) {
@@ -52,6 +66,14 @@ func TestValidateToken(t *testing.T) {
 	_, err = jwtauth.GetToken(wrongUser, defaultTTL, secret)
 	require.ErrorIs(t, err, jwtauth.ErrNoClaim)
 
+	wrongUser = models.User{
+		ID:           1,
+		PasswordHash: "1234",
+		Role:         models.UserRole,
+	}
+	_, err = jwtauth.GetToken(wrongUser, defaultTTL, secret)
+	require.ErrorIs(t, err, jwtauth.ErrNoClaim)
+
 	_, err = jwtauth.ValidateTokenRole("asasas", "wrongsecret")
 	require.NotNil(t, err)
 }
@@ -0,0 +1,487 @@
+package jwtauth
+
+import (
+	"context"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Leopold1975/yadro_app/internal/pkg/config"
+	"github.com/Leopold1975/yadro_app/pkg/logger"
+	"github.com/golang-jwt/jwt"
+)
+
+const (
+	HS256 = "HS256"
+	RS256 = "RS256"
+	EdDSA = "EdDSA"
+
+	rsaBits       = 2048
+	keyFilePerm   = 0o600
+	keysDirPerm   = 0o700
+	privateKeyExt = ".pem"
+	publicKeyExt  = ".pub.pem"
+	// kidLayout — начало kid созданных при ротации ключей: время создания.
+	// За ним через "-" следует случайный суффикс kidSuffixLen байт в hex,
+	// чтобы экземпляры, ротирующие ключи в одну секунду, не затерли файлы друг друга.
+	kidLayout    = "20060102T150405Z"
+	kidSuffixLen = 4
+	// reloadInterval — как часто RunRotation перечитывает каталог ключей,
+	// чтобы подхватить ключи, добавленные вручную или другим экземпляром сервера.
+	reloadInterval = time.Minute
+	// missReloadInterval — не чаще этого токен с неизвестным kid перечитывает
+	// каталог ключей: ключ мог только что создать другой экземпляр.
+	missReloadInterval = 5 * time.Second
+)
+
+var (
+	ErrUnknownAlgorithm = errors.New("unknown signing algorithm")
+	ErrNoKeysDir        = errors.New("keys dir is not set")
+	ErrNoSigningKey     = errors.New("no signing key")
+	ErrUnknownKey       = errors.New("unknown key id")
+	ErrUnsupportedKey   = errors.New("unsupported key type")
+)
+
+type key struct {
+	id        string
+	method    jwt.SigningMethod
+	private   any // nil для ключей, которые только проверяют токены.
+	public    any
+	createdAt time.Time
+}
+
+// KeySet — ключи подписи и проверки токенов. Токены подписываются активным ключом,
+// а проверяются любым ключом набора, выбранным по kid из заголовка токена,
+// поэтому после ротации выданные раньше токены остаются действительными.
+type KeySet struct {
+	mu       sync.RWMutex
+	alg      string
+	dir      string
+	rotation time.Duration
+	// retain — время жизни токенов: столько замененный ключ еще нужен для проверки.
+	retain time.Duration
+	active *key
+	keys   map[string]*key
+
+	missMu       sync.Mutex
+	missReloadAt time.Time // время последнего перечитывания из-за неизвестного kid.
+}
+
+// NewHMAC возвращает набор из одного ключа HS256 без kid.
+func NewHMAC(secret string) *KeySet {
+	k := &key{
+		id:        "",
+		method:    jwt.SigningMethodHS256,
+		private:   []byte(secret),
+		public:    []byte(secret),
+		createdAt: time.Time{},
+	}
+
+	return &KeySet{ //nolint:exhaustruct
+		alg:    HS256,
+		active: k,
+		keys:   map[string]*key{"": k},
+	}
+}
+
+// NewKeySet создает набор ключей по cfg.Signing. Для RS256 и EdDSA ключи читаются
+// из каталога, а при включенной ротации первый ключ создается, если его нет.
+func NewKeySet(cfg config.Auth) (*KeySet, error) {
+	s := cfg.Signing
+
+	switch s.Algorithm {
+	case HS256, "":
+		return NewHMAC(cfg.Secret), nil
+	case RS256, EdDSA:
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownAlgorithm, s.Algorithm)
+	}
+
+	if s.KeysDir == "" {
+		return nil, ErrNoKeysDir
+	}
+
+	ks := &KeySet{ //nolint:exhaustruct
+		alg:      s.Algorithm,
+		dir:      s.KeysDir,
+		rotation: s.Rotation,
+		retain:   cfg.TokenMaxTime,
+		keys:     make(map[string]*key),
+	}
+
+	if ks.rotation > 0 {
+		if err := os.MkdirAll(ks.dir, keysDirPerm); err != nil {
+			return nil, fmt.Errorf("create keys dir error: %w", err)
+		}
+
+		if _, err := ks.Rotate(time.Now()); err != nil {
+			return nil, err
+		}
+	} else if err := ks.Reload(); err != nil {
+		return nil, err
+	}
+
+	if ks.activeKey() == nil {
+		return nil, fmt.Errorf("%w: no %s private key in %s", ErrNoSigningKey, ks.alg, ks.dir)
+	}
+
+	return ks, nil
+}
+
+// Reload перечитывает ключи из каталога. Активным становится самый новый
+// закрытый ключ настроенного алгоритма, а из созданных одновременно — с большим kid,
+// чтобы все экземпляры выбрали один и тот же ключ.
+func (ks *KeySet) Reload() error {
+	if ks.dir == "" {
+		return nil
+	}
+
+	entries, err := os.ReadDir(ks.dir)
+	if err != nil {
+		return fmt.Errorf("read keys dir error: %w", err)
+	}
+
+	keys := make(map[string]*key, len(entries))
+
+	var active *key
+
+	for _, e := range entries {
+		if e.IsDir() || !strings.HasSuffix(e.Name(), privateKeyExt) {
+			continue
+		}
+
+		k, err := loadKey(filepath.Join(ks.dir, e.Name()))
+		if err != nil {
+			return fmt.Errorf("load key %s error: %w", e.Name(), err)
+		}
+
+		keys[k.id] = k
+
+		if k.private != nil && k.method.Alg() == ks.alg && (active == nil || newer(k, active)) {
+			active = k
+		}
+	}
+
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	ks.keys = keys
+	ks.active = active
+
+	return nil
+}
+
+// Rotate создает новый активный ключ, если текущего нет или он старше периода
+// ротации, и удаляет замененные ключи, которыми подписанные токены уже истекли.
+// Возвращает true, если ключ был создан.
+func (ks *KeySet) Rotate(now time.Time) (bool, error) {
+	if ks.dir == "" || ks.rotation <= 0 {
+		return false, nil
+	}
+
+	if err := ks.Reload(); err != nil {
+		return false, err
+	}
+
+	rotated := false
+
+	if a := ks.activeKey(); a == nil || now.Sub(a.createdAt) >= ks.rotation {
+		if err := ks.generate(now); err != nil {
+			return false, err
+		}
+
+		rotated = true
+	}
+
+	if err := ks.prune(now); err != nil {
+		return rotated, err
+	}
+
+	return rotated, ks.Reload()
+}
+
+// RunRotation периодически перечитывает каталог ключей и выполняет ротацию,
+// пока не отменен ctx. Для HS256 ничего не делает.
+func (ks *KeySet) RunRotation(ctx context.Context, l logger.Logger) {
+	if ks.dir == "" {
+		return
+	}
+
+	ticker := time.NewTicker(reloadInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if ks.rotation <= 0 {
+				if err := ks.Reload(); err != nil {
+					l.Error("reload signing keys error", "error", err)
+				}
+
+				continue
+			}
+
+			rotated, err := ks.Rotate(now)
+			if err != nil {
+				l.Error("rotate signing keys error", "error", err)
+
+				continue
+			}
+
+			if rotated {
+				l.Info("signing key rotated", "kid", ks.activeKey().id)
+			}
+		}
+	}
+}
+
+func (ks *KeySet) activeKey() *key {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	return ks.active
+}
+
+func (ks *KeySet) key(kid string) *key {
+	ks.mu.RLock()
+	defer ks.mu.RUnlock()
+
+	return ks.keys[kid]
+}
+
+// lookup возвращает ключ kid. Если ключа нет в наборе, перечитывает каталог ключей,
+// но не чаще missReloadInterval, чтобы токены с выдуманными kid не нагружали диск.
+func (ks *KeySet) lookup(kid string) *key {
+	if k := ks.key(kid); k != nil || ks.dir == "" {
+		return k
+	}
+
+	ks.missMu.Lock()
+	defer ks.missMu.Unlock()
+
+	// пока ждали блокировку, каталог мог перечитать другой запрос.
+	if k := ks.key(kid); k != nil {
+		return k
+	}
+
+	if time.Since(ks.missReloadAt) < missReloadInterval {
+		return nil
+	}
+
+	ks.missReloadAt = time.Now()
+
+	if err := ks.Reload(); err != nil {
+		return nil
+	}
+
+	return ks.key(kid)
+}
+
+// newer сообщает, новее ли ключ a ключа b.
+func newer(a, b *key) bool {
+	if a.createdAt.Equal(b.createdAt) {
+		return a.id > b.id
+	}
+
+	return a.createdAt.After(b.createdAt)
+}
+
+// newKid возвращает kid ключа, созданного в now.
+func newKid(now time.Time) (string, error) {
+	suffix := make([]byte, kidSuffixLen)
+	if _, err := rand.Read(suffix); err != nil {
+		return "", fmt.Errorf("random kid error: %w", err)
+	}
+
+	return now.UTC().Format(kidLayout) + "-" + hex.EncodeToString(suffix), nil
+}
+
+// generate создает закрытый ключ настроенного алгоритма. Файл пишется во временный
+// и переименовывается, чтобы другие экземпляры не прочитали его наполовину.
+func (ks *KeySet) generate(now time.Time) error {
+	var (
+		private any
+		err     error
+	)
+
+	switch ks.alg {
+	case RS256:
+		private, err = rsa.GenerateKey(rand.Reader, rsaBits)
+	case EdDSA:
+		_, private, err = ed25519.GenerateKey(rand.Reader)
+	}
+
+	if err != nil {
+		return fmt.Errorf("generate key error: %w", err)
+	}
+
+	der, err := x509.MarshalPKCS8PrivateKey(private)
+	if err != nil {
+		return fmt.Errorf("marshal key error: %w", err)
+	}
+
+	kid, err := newKid(now)
+	if err != nil {
+		return err
+	}
+
+	data := pem.EncodeToMemory(&pem.Block{Type: "PRIVATE KEY", Bytes: der}) //nolint:exhaustruct
+	path := filepath.Join(ks.dir, kid+privateKeyExt)
+
+	f, err := os.CreateTemp(ks.dir, ".key-*.tmp")
+	if err != nil {
+		return fmt.Errorf("create temp file error: %w", err)
+	}
+
+	_, err = f.Write(data)
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+
+	if err == nil {
+		err = os.Chmod(f.Name(), keyFilePerm)
+	}
+
+	if err == nil {
+		err = os.Rename(f.Name(), path)
+	}
+
+	if err != nil {
+		os.Remove(f.Name()) //nolint:errcheck
+
+		return fmt.Errorf("write key error: %w", err)
+	}
+
+	return nil
+}
+
+// prune удаляет закрытые ключи, замененные более новыми раньше, чем retain назад.
+// Открытые ключи *.pub.pem не удаляются: ими управляют вручную.
+func (ks *KeySet) prune(now time.Time) error {
+	ks.mu.RLock()
+
+	private := make([]*key, 0, len(ks.keys))
+
+	for _, k := range ks.keys {
+		if k.private != nil {
+			private = append(private, k)
+		}
+	}
+
+	ks.mu.RUnlock()
+
+	sort.Slice(private, func(i, j int) bool { return private[i].createdAt.Before(private[j].createdAt) })
+
+	for i := 0; i+1 < len(private); i++ {
+		// ключ i подписывал токены до создания ключа i+1.
+		if now.Sub(private[i+1].createdAt) <= ks.retain+reloadInterval {
+			continue
+		}
+
+		err := os.Remove(filepath.Join(ks.dir, private[i].id+privateKeyExt))
+		if err != nil && !errors.Is(err, os.ErrNotExist) {
+			return fmt.Errorf("remove key %s error: %w", private[i].id, err)
+		}
+	}
+
+	return nil
+}
+
+// loadKey читает ключ из PEM-файла. kid — имя файла без расширения. Время создания
+// берется из kid созданных при ротации ключей, а для остальных — время изменения файла.
+func loadKey(path string) (*key, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("read error: %w", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return nil, fmt.Errorf("stat error: %w", err)
+	}
+
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("%w: no PEM data", ErrUnsupportedKey)
+	}
+
+	name := filepath.Base(path)
+
+	if strings.HasSuffix(name, publicKeyExt) {
+		public, err := x509.ParsePKIXPublicKey(block.Bytes)
+		if err != nil {
+			return nil, fmt.Errorf("parse public key error: %w", err)
+		}
+
+		id := strings.TrimSuffix(name, publicKeyExt)
+
+		return newKey(id, nil, public, createdAt(id, info))
+	}
+
+	id := strings.TrimSuffix(name, privateKeyExt)
+
+	private, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		rsaKey, rsaErr := x509.ParsePKCS1PrivateKey(block.Bytes)
+		if rsaErr != nil {
+			return nil, fmt.Errorf("parse private key error: %w", err)
+		}
+
+		private = rsaKey
+	}
+
+	switch p := private.(type) {
+	case *rsa.PrivateKey:
+		return newKey(id, p, &p.PublicKey, createdAt(id, info))
+	case ed25519.PrivateKey:
+		return newKey(id, p, p.Public(), createdAt(id, info))
+	default:
+		return nil, fmt.Errorf("%w: %T", ErrUnsupportedKey, private)
+	}
+}
+
+// createdAt не полагается только на время изменения: оно меняется при копировании
+// каталога ключей на другой сервер. Ключи, созданные до появления случайного
+// суффикса, называются просто временем создания.
+func createdAt(id string, info os.FileInfo) time.Time {
+	ts, _, _ := strings.Cut(id, "-")
+	if t, err := time.Parse(kidLayout, ts); err == nil {
+		return t
+	}
+
+	return info.ModTime()
+}
+
+func newKey(id string, private, public any, createdAt time.Time) (*key, error) {
+	k := &key{
+		id:        id,
+		method:    nil,
+		private:   private,
+		public:    public,
+		createdAt: createdAt,
+	}
+
+	switch public.(type) {
+	case *rsa.PublicKey:
+		k.method = jwt.SigningMethodRS256
+	case ed25519.PublicKey:
+		k.method = jwt.SigningMethodEdDSA
+	default:
+		return nil, fmt.Errorf("%w: %T", ErrUnsupportedKey, public)
+	}
+
+	return k, nil
+}
@@ -0,0 +1,258 @@
+package jwtauth_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/Leopold1975/yadro_app/internal/pkg/config"
+	"github.com/Leopold1975/yadro_app/internal/pkg/jwtauth"
+	"github.com/golang-jwt/jwt"
+	"github.com/stretchr/testify/require"
+)
+
+func signingConfig(alg, dir string, rotation time.Duration) config.Auth {
+	return config.Auth{ //nolint:exhaustruct
+		Secret:       secret,
+		TokenMaxTime: 15 * time.Minute,
+		Signing:      config.Signing{Algorithm: alg, KeysDir: dir, Rotation: rotation},
+	}
+}
+
+func tokenKid(t *testing.T, token string) string {
+	t.Helper()
+
+	parsed, _, err := new(jwt.Parser).ParseUnverified(token, jwt.MapClaims{})
+	require.NoError(t, err)
+
+	kid, _ := parsed.Header["kid"].(string)
+
+	return kid
+}
+
+func TestKeySetRotation(t *testing.T) {
+	for _, tc := range []struct {
+		alg string
+		kty string
+	}{
+		{jwtauth.RS256, "RSA"},
+		{jwtauth.EdDSA, "OKP"},
+	} {
+		t.Run(tc.alg, func(t *testing.T) {
+			ks, err := jwtauth.NewKeySet(signingConfig(tc.alg, t.TempDir(), time.Hour))
+			require.NoError(t, err)
+
+			first, err := ks.Sign(userExample, defaultTTL)
+			require.NoError(t, err)
+
+			firstKid := tokenKid(t, first)
+			require.NotEmpty(t, firstKid)
+
+			jwks := ks.JWKS()
+			require.Len(t, jwks.Keys, 1)
+			require.Equal(t, firstKid, jwks.Keys[0].Kid)
+			require.Equal(t, tc.kty, jwks.Keys[0].Kty)
+			require.Equal(t, tc.alg, jwks.Keys[0].Alg)
+
+			// ключ моложе периода ротации не меняется.
+			rotated, err := ks.Rotate(time.Now())
+			require.NoError(t, err)
+			require.False(t, rotated)
+
+			now := time.Now().Add(2 * time.Hour)
+
+			rotated, err = ks.Rotate(now)
+			require.NoError(t, err)
+			require.True(t, rotated)
+
+			second, err := ks.Sign(userExample, defaultTTL)
+			require.NoError(t, err)
+			require.NotEqual(t, firstKid, tokenKid(t, second))
+			require.Len(t, ks.JWKS().Keys, 2)
+
+			// токены, подписанные замененным ключом, еще действительны.
+			claims, err := ks.Validate(first)
+			require.NoError(t, err)
+			require.Equal(t, userExample.Username, claims.Subject)
+
+			_, err = ks.Validate(second)
+			require.NoError(t, err)
+
+			// после истечения подписанных им токенов замененный ключ удаляется.
+			rotated, err = ks.Rotate(now.Add(30 * time.Minute))
+			require.NoError(t, err)
+			require.False(t, rotated)
+			require.Len(t, ks.JWKS().Keys, 1)
+
+			_, err = ks.Validate(first)
+			require.ErrorIs(t, err, jwtauth.ErrUnknownKey)
+
+			_, err = ks.Validate(second)
+			require.NoError(t, err)
+		})
+	}
+}
+
+func TestKeySetFromFiles(t *testing.T) {
+	dir := t.TempDir()
+
+	_, err := jwtauth.NewKeySet(signingConfig(jwtauth.RS256, dir, 0))
+	require.ErrorIs(t, err, jwtauth.ErrNoSigningKey)
+
+	_, err = jwtauth.NewKeySet(signingConfig(jwtauth.RS256, "", 0))
+	require.ErrorIs(t, err, jwtauth.ErrNoKeysDir)
+
+	_, err = jwtauth.NewKeySet(signingConfig("HS512", dir, 0))
+	require.ErrorIs(t, err, jwtauth.ErrUnknownAlgorithm)
+
+	// ключ другого сервиса только проверяет токены.
+	other, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+
+	pub, err := x509.MarshalPKIXPublicKey(&other.PublicKey)
+	require.NoError(t, err)
+	writePEM(t, filepath.Join(dir, "other.pub.pem"), "PUBLIC KEY", pub)
+
+	private, err := rsa.GenerateKey(rand.Reader, 2048)
+	require.NoError(t, err)
+	writePEM(t, filepath.Join(dir, "main.pem"), "RSA PRIVATE KEY", x509.MarshalPKCS1PrivateKey(private))
+
+	ks, err := jwtauth.NewKeySet(signingConfig(jwtauth.RS256, dir, 0))
+	require.NoError(t, err)
+	require.Len(t, ks.JWKS().Keys, 2)
+
+	token, err := ks.Sign(userExample, defaultTTL)
+	require.NoError(t, err)
+	require.Equal(t, "main", tokenKid(t, token))
+
+	_, err = ks.Validate(token)
+	require.NoError(t, err)
+
+	otherToken := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"jti": "1", "sub": "user", "role": "user", "exp": time.Now().Add(time.Minute).Unix(),
+	})
+	otherToken.Header["kid"] = "other"
+
+	signed, err := otherToken.SignedString(other)
+	require.NoError(t, err)
+
+	claims, err := ks.Validate(signed)
+	require.NoError(t, err)
+	require.Equal(t, "user", claims.Subject)
+
+	// токен HS256 с kid ключа RSA не принимается, чем бы он ни был подписан.
+	forged := jwt.NewWithClaims(jwt.SigningMethodHS256, jwt.MapClaims{
+		"jti": "1", "sub": "admin", "role": "admin", "exp": time.Now().Add(time.Minute).Unix(),
+	})
+	forged.Header["kid"] = "other"
+
+	signed, err = forged.SignedString(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: pub})) //nolint:exhaustruct
+	require.NoError(t, err)
+
+	_, err = ks.Validate(signed)
+	require.Error(t, err)
+
+	// токены HS256 без kid не принимаются асимметричным набором.
+	hmacToken, err := jwtauth.GetToken(userExample, defaultTTL, secret)
+	require.NoError(t, err)
+
+	_, err = ks.Validate(hmacToken)
+	require.Error(t, err)
+}
+
+func TestKeySetKid(t *testing.T) {
+	dir := t.TempDir()
+
+	ks, err := jwtauth.NewKeySet(signingConfig(jwtauth.EdDSA, dir, time.Hour))
+	require.NoError(t, err)
+
+	token, err := ks.Sign(userExample, defaultTTL)
+	require.NoError(t, err)
+	require.Regexp(t, `^\d{8}T\d{6}Z-[0-9a-f]{8}$`, tokenKid(t, token))
+
+	// из ключей, созданных в одну секунду, все экземпляры выбирают ключ с большим kid.
+	dir = t.TempDir()
+
+	for _, kid := range []string{"20240101T000000Z-0000000a", "20240101T000000Z-000000ff", "20240101T000000Z-00000001"} {
+		_, private, err := ed25519.GenerateKey(rand.Reader)
+		require.NoError(t, err)
+
+		der, err := x509.MarshalPKCS8PrivateKey(private)
+		require.NoError(t, err)
+		writePEM(t, filepath.Join(dir, kid+".pem"), "PRIVATE KEY", der)
+	}
+
+	ks, err = jwtauth.NewKeySet(signingConfig(jwtauth.EdDSA, dir, 0))
+	require.NoError(t, err)
+
+	token, err = ks.Sign(userExample, defaultTTL)
+	require.NoError(t, err)
+	require.Equal(t, "20240101T000000Z-000000ff", tokenKid(t, token))
+}
+
+func TestKeySetUnknownKid(t *testing.T) {
+	dir := t.TempDir()
+
+	a, err := jwtauth.NewKeySet(signingConfig(jwtauth.EdDSA, dir, time.Hour))
+	require.NoError(t, err)
+
+	b, err := jwtauth.NewKeySet(signingConfig(jwtauth.EdDSA, dir, time.Hour))
+	require.NoError(t, err)
+
+	// b создает новый ключ, о котором a еще не знает: a перечитывает каталог.
+	now := time.Now().Add(2 * time.Hour)
+
+	rotated, err := b.Rotate(now)
+	require.NoError(t, err)
+	require.True(t, rotated)
+
+	token, err := b.Sign(userExample, defaultTTL)
+	require.NoError(t, err)
+
+	claims, err := a.Validate(token)
+	require.NoError(t, err)
+	require.Equal(t, userExample.Username, claims.Subject)
+
+	// каталог перечитывается не чаще раза в несколько секунд.
+	rotated, err = b.Rotate(now.Add(2 * time.Hour))
+	require.NoError(t, err)
+	require.True(t, rotated)
+
+	token, err = b.Sign(userExample, defaultTTL)
+	require.NoError(t, err)
+
+	_, err = a.Validate(token)
+	require.ErrorIs(t, err, jwtauth.ErrUnknownKey)
+
+	require.NoError(t, a.Reload())
+
+	_, err = a.Validate(token)
+	require.NoError(t, err)
+}
+
+func TestHMACKeySet(t *testing.T) {
+	ks, err := jwtauth.NewKeySet(signingConfig(jwtauth.HS256, "", 0))
+	require.NoError(t, err)
+	require.Empty(t, ks.JWKS().Keys)
+
+	token, err := ks.Sign(userExample, defaultTTL)
+	require.NoError(t, err)
+	require.Empty(t, tokenKid(t, token))
+
+	claims, err := jwtauth.ValidateToken(token, secret)
+	require.NoError(t, err)
+	require.Equal(t, userExample.Username, claims.Subject)
+}
+
+func writePEM(t *testing.T, path, typ string, der []byte) {
+	t.Helper()
+
+	data := pem.EncodeToMemory(&pem.Block{Type: typ, Bytes: der}) //nolint:exhaustruct
+	require.NoError(t, os.WriteFile(path, data, 0o600))
+}
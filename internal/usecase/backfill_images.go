@@ -0,0 +1,120 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/Leopold1975/yadro_app/internal/models"
+)
+
+var ErrImagesDisabled = errors.New("image store is not configured")
+
+// backfillBatch — сколько комиксов читается из хранилища за раз при докачке картинок.
+const backfillBatch = 100
+
+// BackfillImages скачивает картинки сохраненных комиксов, у которых их нет.
+// FetchComics скачивает картинки только вместе с новыми комиксами, поэтому
+// комиксы, загруженные до включения images.enabled, без докачки остаются без картинок.
+// В отчете Fetched — комиксы с докачанной картинкой, Skipped — комиксы,
+// картинок которых нет на xkcd, Total — количество комиксов в хранилище.
+func (f FetchComicsUsecase) BackfillImages(ctx context.Context) (FetchResponse, error) {
+	if f.images == nil {
+		return FetchResponse{}, ErrImagesDisabled
+	}
+
+	ids, err := f.db.GetAllIDs(ctx)
+	if err != nil {
+		return FetchResponse{}, fmt.Errorf("get all ids error: %w", err)
+	}
+
+	report := &fetchReport{} //nolint:exhaustruct
+	comics := make(chan models.ComicsInfo, f.parallel)
+	errCh := make(chan error, 1)
+
+	go func() {
+		defer close(comics)
+		errCh <- f.withoutImages(ctx, ids, comics)
+	}()
+
+	workers := max(int(f.parallel), 1)
+
+	wg := sync.WaitGroup{}
+	wg.Add(workers)
+
+	for range workers {
+		go func() {
+			defer wg.Done()
+
+			for ci := range comics {
+				f.backfillImage(ctx, ci, report)
+			}
+		}()
+	}
+
+	wg.Wait()
+
+	if err := <-errCh; err != nil {
+		return FetchResponse{}, err
+	}
+
+	total, _, err := f.db.Flush(ctx, updateIndex)
+	if err != nil {
+		return FetchResponse{}, fmt.Errorf("flush to file error %w", err)
+	}
+
+	resp := report.response()
+	resp.Total = total
+
+	return resp, nil
+}
+
+// withoutImages читает комиксы ids пачками и отправляет в comics те, у которых нет картинки.
+func (f FetchComicsUsecase) withoutImages(ctx context.Context, ids []string, comics chan<- models.ComicsInfo) error {
+	for start := 0; start < len(ids); start += backfillBatch {
+		batch, err := f.db.GetByIDs(ctx, ids[start:min(start+backfillBatch, len(ids))])
+		if err != nil {
+			return fmt.Errorf("get comics error: %w", err)
+		}
+
+		for _, ci := range batch {
+			if ci.Image.Hash != "" || ci.URL == "" {
+				continue
+			}
+
+			select {
+			case <-ctx.Done():
+				return ctx.Err() //nolint:wrapcheck
+			case comics <- ci:
+			}
+		}
+	}
+
+	return nil
+}
+
+func (f FetchComicsUsecase) backfillImage(ctx context.Context, ci models.ComicsInfo, report *fetchReport) {
+	img, err := f.downloadImage(ctx, ci.URL)
+	if err != nil {
+		f.l.Debug("download image error", "id", ci.ID, "error", err)
+		report.fail(ci.ID, err)
+
+		return
+	}
+
+	if img.Hash == "" {
+		report.skip(ci.ID)
+
+		return
+	}
+
+	if err := f.db.SetImage(ctx, ci.ID, img); err != nil {
+		f.l.Error("set image error", "id", ci.ID, "error", err)
+		report.fail(ci.ID, err)
+
+		return
+	}
+
+	report.fetch(ci.ID)
+}
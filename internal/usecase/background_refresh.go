@@ -2,58 +2,199 @@ package usecase
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"sync"
 	"time"
 
+	"github.com/Leopold1975/yadro_app/internal/pkg/config"
 	"github.com/Leopold1975/yadro_app/pkg/logger"
+	"github.com/Leopold1975/yadro_app/pkg/schedule"
 )
 
+// ErrRefreshTimeSeconds — refreshTime задан с секундами: расписание считается с точностью до минуты.
+var ErrRefreshTimeSeconds = errors.New("refresh time must not have seconds")
+
 type BackgroundRefreshUsecase struct {
-	fetch       FetchComicsUsecase
-	refreshTime time.Time
+	jobs     UpdateJobsUsecase
+	spec     string
+	schedule schedule.Schedule
+	cfg      config.Refresh
+	state    *refreshState
 }
 
-func NewBackgroundRefresh(fetch FetchComicsUsecase, refreshTime time.Time) BackgroundRefreshUsecase {
-	return BackgroundRefreshUsecase{
-		fetch:       fetch,
-		refreshTime: refreshTime,
+// RefreshStatus — состояние фонового обновления.
+// LastError относится к последнему запуску и пуст, если он завершился успешно.
+type RefreshStatus struct {
+	Schedule    string
+	Running     bool
+	LastRun     time.Time
+	LastSuccess time.Time
+	LastError   string
+	NextRun     time.Time
+}
+
+type refreshState struct {
+	mu     sync.Mutex
+	status RefreshStatus
+}
+
+// NewBackgroundRefresh создает фоновое обновление, которое запускает загрузку через jobs,
+// чтобы не пересекаться с заданиями, запущенными через POST /update.
+// Если cfg.Schedule пуст, обновление выполняется ежедневно в refreshTime,
+// который должен быть задан с точностью до минуты. refreshTime переводится в
+// местное время сервера, и расписание следует его переходам на летнее время.
+func NewBackgroundRefresh(jobs UpdateJobsUsecase, cfg config.Refresh, refreshTime time.Time,
+) (BackgroundRefreshUsecase, error) {
+	spec, loc := cfg.Schedule, time.Local
+
+	if spec == "" {
+		if refreshTime.Second() != 0 || refreshTime.Nanosecond() != 0 {
+			return BackgroundRefreshUsecase{}, fmt.Errorf("%w: %s", ErrRefreshTimeSeconds, refreshTime.Format(time.TimeOnly))
+		}
+
+		local := localTime(refreshTime, time.Now())
+		spec = fmt.Sprintf("%d %d * * *", local.Minute(), local.Hour())
+	}
+
+	s, err := schedule.Parse(spec, loc)
+	if err != nil {
+		return BackgroundRefreshUsecase{}, fmt.Errorf("parse refresh schedule error: %w", err)
 	}
+
+	return BackgroundRefreshUsecase{
+		jobs:     jobs,
+		spec:     spec,
+		schedule: s,
+		cfg:      cfg,
+		state: &refreshState{
+			mu:     sync.Mutex{},
+			status: RefreshStatus{Schedule: spec}, //nolint:exhaustruct
+		},
+	}, nil
 }
 
-// Refresh не запускает обновление базы комиксов при запуске.
+// localTime переводит время суток t в местное время сервера по смещениям на дату now.
+// Смещение t фиксировано ("+0300"), поэтому расписание по нему сдвигалось бы
+// на час при переходе местного времени на летнее.
+func localTime(t, now time.Time) time.Time {
+	y, m, d := now.Date()
+
+	return time.Date(y, m, d, t.Hour(), t.Minute(), 0, 0, t.Location()).In(time.Local)
+}
+
+// Refresh запускает обновление по расписанию до отмены ctx.
+// При cfg.RunOnStart первое обновление выполняется сразу.
 func (b BackgroundRefreshUsecase) Refresh(ctx context.Context, l logger.Logger) {
-	now := time.Now()
-	refreshTime := time.Date(now.Year(), now.Month(), now.Day(),
-		b.refreshTime.Hour(), b.refreshTime.Minute(), b.refreshTime.Second(), 0, b.refreshTime.Location())
+	l.Info("Start background refresh", "schedule", b.spec)
 
-	if refreshTime.Before(now) {
-		refreshTime = refreshTime.AddDate(0, 0, 1)
+	if b.cfg.RunOnStart {
+		b.run(ctx, l)
 	}
 
-	timer := time.NewTimer(refreshTime.Sub(now))
-	defer timer.Stop()
+	for {
+		next := b.schedule.Next(time.Now())
+		if next.IsZero() {
+			l.Info("background refresh schedule has no more runs", "schedule", b.spec)
 
-	l.Info("Start background refresh")
+			return
+		}
 
-	for {
-		select {
-		case <-ctx.Done():
+		b.update(func(s *RefreshStatus) { s.NextRun = next })
+
+		if !waitUntil(ctx, next) {
 			return
-		case <-timer.C:
-			resp, err := b.fetch.FetchComics(ctx)
-			if err != nil {
-				l.Error("background refresh error", "error", err)
+		}
+
+		b.run(ctx, l)
+	}
+}
 
-				continue
+// Status возвращает состояние фонового обновления.
+func (b BackgroundRefreshUsecase) Status() RefreshStatus {
+	b.state.mu.Lock()
+	defer b.state.mu.Unlock()
+
+	return b.state.status
+}
+
+// run выполняет обновление, повторяя его после ошибок не более cfg.MaxRetries раз.
+func (b BackgroundRefreshUsecase) run(ctx context.Context, l logger.Logger) {
+	for attempt := 0; ; attempt++ {
+		b.update(func(s *RefreshStatus) {
+			s.Running = true
+			s.LastRun = time.Now()
+			s.NextRun = time.Time{}
+		})
+
+		resp, err := b.jobs.Run(ctx)
+		if err == nil {
+			b.update(func(s *RefreshStatus) {
+				s.Running = false
+				s.LastSuccess = time.Now()
+				s.LastError = ""
+			})
+
+			l.Info("refreshed", "new comics", resp.New, "total comics", resp.Total,
+				"failed", len(resp.Failed), "skipped", len(resp.Skipped))
+
+			for _, fc := range resp.Failed {
+				l.Error("background refresh comics error", "id", fc.ID, "error", fc.Reason)
 			}
 
-			l.Info("refreshed", "new comics", resp.New, "total comics", resp.Total)
+			return
+		}
+
+		l.Error("background refresh error", "attempt", attempt+1, "error", err)
+
+		if attempt >= b.cfg.MaxRetries || ctx.Err() != nil {
+			b.update(func(s *RefreshStatus) {
+				s.Running = false
+				s.LastError = err.Error()
+			})
+
+			return
+		}
+
+		retryAt := time.Now().Add(b.retryDelay(attempt))
+
+		b.update(func(s *RefreshStatus) {
+			s.Running = false
+			s.LastError = err.Error()
+			s.NextRun = retryAt
+		})
 
-			refreshTime = b.calculateNextRefreshTime(refreshTime)
-			timer.Reset(time.Until(refreshTime))
+		if !waitUntil(ctx, retryAt) {
+			return
 		}
 	}
 }
 
-func (b BackgroundRefreshUsecase) calculateNextRefreshTime(refreshTime time.Time) time.Time {
-	return refreshTime.Add(24 * time.Hour) //nolint:gomnd
+func (b BackgroundRefreshUsecase) retryDelay(attempt int) time.Duration {
+	d := b.cfg.RetryMax
+	if attempt < 32 && b.cfg.RetryMin<<attempt < d { //nolint:gomnd // защита от переполнения сдвига.
+		d = b.cfg.RetryMin << attempt
+	}
+
+	return d
+}
+
+func (b BackgroundRefreshUsecase) update(f func(s *RefreshStatus)) {
+	b.state.mu.Lock()
+	defer b.state.mu.Unlock()
+
+	f(&b.state.status)
+}
+
+// waitUntil ждет наступления t и возвращает false, если ctx отменен раньше.
+func waitUntil(ctx context.Context, t time.Time) bool {
+	timer := time.NewTimer(time.Until(t))
+	defer timer.Stop()
+
+	select {
+	case <-ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
 }
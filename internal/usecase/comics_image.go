@@ -0,0 +1,47 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/Leopold1975/yadro_app/internal/models"
+)
+
+type ComicsImageUsecase struct {
+	db     Storage
+	images ImageStore
+}
+
+// NewComicsImage создает usecase для отдачи картинок. images может быть nil,
+// если хранение картинок выключено, тогда картинки не находятся.
+func NewComicsImage(db Storage, images ImageStore) ComicsImageUsecase {
+	return ComicsImageUsecase{
+		db:     db,
+		images: images,
+	}
+}
+
+// GetImage возвращает описание и содержимое картинки комикса.
+// Возвращает models.ErrNotFound, если нет комикса или его картинка не скачана.
+func (u ComicsImageUsecase) GetImage(ctx context.Context, id string) (models.Image, io.ReadSeekCloser, error) {
+	if u.images == nil {
+		return models.Image{}, nil, fmt.Errorf("images are disabled: %w", models.ErrNotFound)
+	}
+
+	ci, err := u.db.GetByID(ctx, id)
+	if err != nil {
+		return models.Image{}, nil, fmt.Errorf("get comics error: %w", err)
+	}
+
+	if ci.Image.Hash == "" {
+		return models.Image{}, nil, fmt.Errorf("comics %s has no image: %w", id, models.ErrNotFound)
+	}
+
+	rc, err := u.images.Open(ci.Image.Hash)
+	if err != nil {
+		return models.Image{}, nil, fmt.Errorf("open image error: %w", err)
+	}
+
+	return ci.Image, rc, nil
+}
@@ -4,64 +4,105 @@ import (
 	"context"
 	"errors"
 	"fmt"
-	"strconv"
+	"sort"
 	"sync"
+	"time"
 
 	"github.com/Leopold1975/yadro_app/internal/models"
 	"github.com/Leopold1975/yadro_app/internal/pkg/config"
 	"github.com/Leopold1975/yadro_app/pkg/logger"
+	"github.com/Leopold1975/yadro_app/pkg/words"
 	"github.com/Leopold1975/yadro_app/pkg/xkcd"
 )
 
 const (
-	ErrorCapacity   = 10
-	NotFoundAllowed = 20
-	updateIndex     = false
+	updateIndex = false
 )
 
 type FetchComicsUsecase struct {
 	client   *xkcd.Client
 	db       Storage
+	images   ImageStore
+	stemmer  words.Stemmer
 	parallel config.Parallel
+	save     config.Save
 	l        logger.Logger
 }
 
+// FetchResponse — отчет об одном запуске загрузки.
+// Fetched — сохраненные комиксы, Failed — комиксы, которые не удалось скачать
+// или сохранить, Skipped — номера, которых нет на xkcd.
 type FetchResponse struct {
-	New   int
-	Total int
+	New     int
+	Total   int
+	Fetched []string
+	Failed  []FailedComics
+	Skipped []string
 }
 
-func NewComicsFetch(client *xkcd.Client, db Storage, parallel config.Parallel, l logger.Logger) FetchComicsUsecase {
+type FailedComics struct {
+	ID     string
+	Reason string
+}
+
+// NewComicsFetch создает загрузку комиксов. Если images не nil,
+// вместе с комиксами скачиваются их картинки. Индекс комиксов строится стеммером stemmer.
+// Комиксы сохраняются пачками по параметрам save.
+func NewComicsFetch(client *xkcd.Client, db Storage, images ImageStore, stemmer words.Stemmer,
+	parallel config.Parallel, save config.Save, l logger.Logger,
+) FetchComicsUsecase {
 	return FetchComicsUsecase{
 		client:   client,
 		db:       db,
+		images:   images,
+		stemmer:  stemmer,
 		parallel: parallel,
+		save:     save,
 		l:        l,
 	}
 }
 
+// FetchComics узнает номер последнего комикса, запрашивает у хранилища
+// отсутствующие id и скачивает только их. Ошибки отдельных комиксов
+// не прерывают загрузку и попадают в отчет.
 func (f FetchComicsUsecase) FetchComics(ctx context.Context) (FetchResponse, error) {
+	return f.fetchComics(ctx, &fetchReport{}) //nolint:exhaustruct
+}
+
+// fetchComics выполняет загрузку, отмечая ход выполнения в report.
+func (f FetchComicsUsecase) fetchComics(ctx context.Context, report *fetchReport) (FetchResponse, error) {
+	latest, err := f.client.GetLatestNum(ctx)
+	if err != nil {
+		return FetchResponse{}, fmt.Errorf("get latest num error: %w", err)
+	}
+
+	missing, err := f.db.GetMissingIDs(ctx, latest)
+	if err != nil {
+		return FetchResponse{}, fmt.Errorf("get missing ids error: %w", err)
+	}
+
+	f.l.Debug("fetch comics", "latest", latest, "missing", len(missing))
+	report.start(len(missing))
+
 	ids := make(chan string, f.parallel)
-	comicsModels := make(chan models.XKCDModel, f.parallel)
+	comics := make(chan models.ComicsInfo, f.parallel)
 
 	wg := sync.WaitGroup{}
 	wg.Add(3) //nolint:gomnd
 
-	ctxF, cancel := context.WithCancel(ctx)
 	go func() {
 		defer wg.Done()
-		f.fetchIDs(ctxF, ids)
+		f.fetchIDs(ctx, ids, missing)
 	}()
 
 	go func() {
 		defer wg.Done()
-		f.getComics(ctx, comicsModels, ids)
-		cancel()
+		f.getComics(ctx, comics, ids, report)
 	}()
 
 	go func() {
 		defer wg.Done()
-		f.saveComics(ctx, comicsModels)
+		f.saveComics(ctx, comics, report)
 	}()
 
 	wg.Wait()
@@ -71,115 +112,257 @@ func (f FetchComicsUsecase) FetchComics(ctx context.Context) (FetchResponse, err
 		return FetchResponse{}, fmt.Errorf("flush to file error %w", err)
 	}
 
-	if f.client.Err != nil {
-		defer f.client.RefreshError()
-
-		return FetchResponse{}, fmt.Errorf("client error: %w", f.client.Err)
-	}
+	resp := report.response()
+	resp.New = newC
+	resp.Total = totalC
 
-	return FetchResponse{
-		New:   newC,
-		Total: totalC,
-	}, nil
+	return resp, nil
 }
 
-func (f FetchComicsUsecase) fetchIDs(ctx context.Context, ids chan string) {
+func (f FetchComicsUsecase) fetchIDs(ctx context.Context, ids chan<- string, missing []string) {
 	defer close(ids)
 
-	for i := 1; ; i++ {
-		id := strconv.Itoa(i)
-
-		_, err := f.db.GetByID(ctx, id)
-		if err != nil && errors.Is(err, models.ErrNotFound) {
-			select {
-			case <-ctx.Done():
-				return
-			case ids <- id:
-			}
+	for _, id := range missing {
+		select {
+		case <-ctx.Done():
+			return
+		case ids <- id:
 		}
 	}
 }
 
-func (f FetchComicsUsecase) getComics(ctx context.Context, comicsModels chan<- models.XKCDModel, ids <-chan string) {
-	errCh := make(chan error, ErrorCapacity)
-	notFoundErr := make(chan error, f.parallel*3) //nolint:gomnd
-	// Канал для сбора ошибок NotFOund, переполнение которого считается сигналом к окончанию работы.
-
-	defer close(comicsModels)
-	defer close(notFoundErr)
+func (f FetchComicsUsecase) getComics(ctx context.Context, comics chan<- models.ComicsInfo,
+	ids <-chan string, report *fetchReport,
+) {
+	defer close(comics)
 
 	wg := sync.WaitGroup{}
 	wg.Add(int(f.parallel))
 
-	doneErr := make(chan struct{})
-	go func() {
-		f.client.HandleErrorChan(ctx, errCh)
-		close(doneErr)
-	}()
-
 	for i := 0; i < int(f.parallel); i++ {
 		go func() {
 			defer wg.Done()
-			f.getComicsParallel(ctx, comicsModels, ids, notFoundErr, errCh)
+			f.getComicsParallel(ctx, comics, ids, report)
 		}()
 	}
 	wg.Wait()
-
-	close(errCh)
-	<-doneErr
 }
 
-func (f FetchComicsUsecase) saveComics(ctx context.Context, comicsModels chan models.XKCDModel) {
-	for cm := range comicsModels {
+// saveComics копит комиксы и сохраняет их пачками по save.BatchSize.
+// Неполная пачка сохраняется каждые save.FlushInterval и после получения последнего комикса.
+func (f FetchComicsUsecase) saveComics(ctx context.Context, comics <-chan models.ComicsInfo, report *fetchReport) {
+	size := max(f.save.BatchSize, 1)
+	batch := make([]models.ComicsInfo, 0, size)
+
+	var flush <-chan time.Time
+
+	if f.save.FlushInterval > 0 {
+		ticker := time.NewTicker(f.save.FlushInterval)
+		defer ticker.Stop()
+
+		flush = ticker.C
+	}
+
+	for {
 		select {
 		case <-ctx.Done():
 			return
-		default:
-			ci, err := models.ToDBComicsInfo(cm)
-			if err != nil {
-				f.l.Error("ToDBComicsInfo error", "error", err)
+		case ci, ok := <-comics:
+			if !ok {
+				f.saveBatch(ctx, batch, report)
+
+				return
 			}
 
-			if err := f.db.AddOne(ctx, ci); err != nil {
-				f.l.Error("save error", "error", err)
+			batch = append(batch, ci)
+
+			if len(batch) >= size {
+				f.saveBatch(ctx, batch, report)
+				batch = make([]models.ComicsInfo, 0, size)
 			}
+		case <-flush:
+			if len(batch) > 0 {
+				f.saveBatch(ctx, batch, report)
+				batch = make([]models.ComicsInfo, 0, size)
+			}
+		}
+	}
+}
+
+// saveBatch сохраняет пачку одним вызовом AddMany. Если пачка не сохранилась,
+// комиксы сохраняются по одному, чтобы ошибка попала в отчет только для тех, кто ее вызвал.
+func (f FetchComicsUsecase) saveBatch(ctx context.Context, batch []models.ComicsInfo, report *fetchReport) {
+	if len(batch) == 0 {
+		return
+	}
+
+	err := f.db.AddMany(ctx, batch)
+	if err == nil {
+		for _, ci := range batch {
+			report.fetch(ci.ID)
+		}
+
+		return
+	}
+
+	f.l.Debug("save batch error, saving one by one", "size", len(batch), "error", err)
+
+	for _, ci := range batch {
+		if err := f.db.AddOne(ctx, ci); err != nil {
+			f.l.Error("save error", "error", err)
+			report.fail(ci.ID, err)
+
+			continue
 		}
+
+		report.fetch(ci.ID)
 	}
 }
 
-func (f FetchComicsUsecase) getComicsParallel(ctx context.Context, //nolint:cyclop
-	comicsModels chan<- models.XKCDModel, ids <-chan string, notFoundErr chan error, errCh chan error,
+func (f FetchComicsUsecase) getComicsParallel(ctx context.Context,
+	comics chan<- models.ComicsInfo, ids <-chan string, report *fetchReport,
 ) {
 	for id := range ids {
 		comicsModel, err := f.client.GetComics(ctx, id)
 		if err != nil {
 			if errors.Is(err, models.ErrNotFound) {
-				select {
-				case notFoundErr <- err:
-				default:
-					return
-				}
+				// Некоторых номеров нет на xkcd (например, 404), их пропускаем.
+				f.l.Debug("comics not found", "id", id)
+				report.skip(id)
 
 				continue
 			}
-			select {
-			case errCh <- fmt.Errorf("id: %s error: %w", id, err):
-			default:
-			}
+
+			f.l.Debug("get comics error", "id", id, "error", err)
+			report.fail(id, err)
 
 			continue
 		}
 
-		select {
-		case <-notFoundErr: // Возможно получение "ложных" NotFound (из-за удаления id),
-		// которые не должны влиять на получение остальных комиксов.
-		default:
+		ci, err := models.ToDBComicsInfo(comicsModel, f.stemmer)
+		if err != nil {
+			f.l.Error("ToDBComicsInfo error", "error", err)
+			report.fail(id, err)
+
+			continue
+		}
+
+		if ci.Image, err = f.downloadImage(ctx, ci.URL); err != nil {
+			// Комикс сохраняется без картинки, чтобы его текст был в поиске,
+			// а картинку докачает BackfillImages.
+			f.l.Warn("download image error, saving comics without image", "id", id, "error", err)
 		}
 
 		select {
 		case <-ctx.Done():
 			return
-		case comicsModels <- comicsModel:
+		case comics <- ci:
 		}
 	}
 }
+
+// downloadImage скачивает картинку в хранилище. Если хранилище не задано
+// или картинки нет на xkcd, возвращает пустую models.Image.
+func (f FetchComicsUsecase) downloadImage(ctx context.Context, imgURL string) (models.Image, error) {
+	if f.images == nil || imgURL == "" {
+		return models.Image{}, nil
+	}
+
+	data, err := f.client.GetImage(ctx, imgURL)
+	if err != nil {
+		if errors.Is(err, models.ErrNotFound) {
+			return models.Image{}, nil
+		}
+
+		return models.Image{}, fmt.Errorf("get image error: %w", err)
+	}
+
+	img, err := f.images.Put(ctx, data)
+	if err != nil {
+		return models.Image{}, fmt.Errorf("put image error: %w", err)
+	}
+
+	return img, nil
+}
+
+// FetchProgress — ход выполнения загрузки: Total — количество отсутствующих комиксов,
+// остальные поля — сколько из них уже обработано.
+type FetchProgress struct {
+	Total   int
+	Fetched int
+	Failed  int
+	Skipped int
+}
+
+// fetchReport собирает результаты загрузки из параллельных горутин.
+type fetchReport struct {
+	mu      sync.Mutex
+	total   int
+	fetched []string
+	failed  []FailedComics
+	skipped []string
+}
+
+func (r *fetchReport) start(total int) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.total = total
+}
+
+func (r *fetchReport) progress() FetchProgress {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return FetchProgress{
+		Total:   r.total,
+		Fetched: len(r.fetched),
+		Failed:  len(r.failed),
+		Skipped: len(r.skipped),
+	}
+}
+
+func (r *fetchReport) fetch(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.fetched = append(r.fetched, id)
+}
+
+func (r *fetchReport) fail(id string, err error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.failed = append(r.failed, FailedComics{ID: id, Reason: err.Error()})
+}
+
+func (r *fetchReport) skip(id string) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.skipped = append(r.skipped, id)
+}
+
+// response возвращает отчет с id, упорядоченными по возрастанию.
+func (r *fetchReport) response() FetchResponse {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	sortIDs := func(ids []string) []string {
+		ids = append(make([]string, 0, len(ids)), ids...)
+		sort.Slice(ids, func(i, j int) bool { return models.LessID(ids[i], ids[j]) })
+
+		return ids
+	}
+
+	failed := append(make([]FailedComics, 0, len(r.failed)), r.failed...)
+	sort.Slice(failed, func(i, j int) bool { return models.LessID(failed[i].ID, failed[j].ID) })
+
+	return FetchResponse{
+		New:     0,
+		Total:   0,
+		Fetched: sortIDs(r.fetched),
+		Failed:  failed,
+		Skipped: sortIDs(r.skipped),
+	}
+}
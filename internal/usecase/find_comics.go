@@ -1,122 +1,345 @@
 package usecase
 
 import (
+	"cmp"
 	"context"
 	"errors"
 	"fmt"
-	"sort"
+	"slices"
+	"strings"
 
 	"github.com/Leopold1975/yadro_app/internal/models"
+	"github.com/Leopold1975/yadro_app/internal/pkg/config"
 	"github.com/Leopold1975/yadro_app/pkg/logger"
 	"github.com/Leopold1975/yadro_app/pkg/words"
 )
 
-const (
-	ResultLen = 10 // количетсво возвращаемых комиксов.
+// surfaceSample — сколько комиксов просматривается в поисках исходной формы
+// исправленного слова.
+const surfaceSample = 20
+
+var (
+	ErrFullTextUnsupported = errors.New("full-text search is not supported by storage")
+	ErrStrategyUnsupported = errors.New("index strategy is not supported by storage")
 )
 
 type FindComicsUsecase struct {
-	db Storage
-	l  logger.Logger
+	db      Storage
+	vocab   *vocabulary
+	stemmer words.Stemmer
+	cfg     config.Search
+	l       logger.Logger
 }
 
-func NewComicsFind(db Storage, l logger.Logger) FindComicsUsecase {
+// NewComicsFind создает поиск комиксов. stemmer должен совпадать со стеммером,
+// которым построен индекс, иначе слова запроса не найдутся в словаре.
+func NewComicsFind(db Storage, cfg config.Search, stemmer words.Stemmer, l logger.Logger) FindComicsUsecase {
 	return FindComicsUsecase{
-		db: db,
-		l:  l,
+		db:      db,
+		vocab:   newVocabulary(db, cfg.VocabularyTTL),
+		stemmer: stemmer,
+		cfg:     cfg,
+		l:       l,
+	}
+}
+
+// SupportsStrategy сообщает, может ли хранилище искать стратегией s. Стратегии jsonb
+// и table различают только хранилища с двумя представлениями индекса (IndexChecker),
+// tsvector — хранилища с полнотекстовым поиском (FullTextSearcher).
+func (f FindComicsUsecase) SupportsStrategy(s models.IndexStrategy) bool {
+	switch s {
+	case models.IndexJSONB, models.IndexTable:
+		_, ok := f.db.(IndexChecker)
+
+		return ok
+	case models.IndexFullText:
+		_, ok := f.db.(FullTextSearcher)
+
+		return ok
+	default:
+		return false
 	}
 }
 
-func (f FindComicsUsecase) GetComics(ctx context.Context, phrase string) ([]models.ComicsInfo, error) {
-	ids, err := f.GetIDs(ctx, phrase)
+// FoundComics — комикс из результата поиска вместе с его релевантностью.
+type FoundComics struct {
+	models.ComicsInfo
+	Score float64
+}
+
+// SearchResult — страница результатов поиска и общее количество найденных комиксов.
+// DidYouMean содержит исправленный запрос, если слова с опечатками были заменены.
+type SearchResult struct {
+	Comics     []FoundComics
+	Total      int
+	Page       models.Page
+	DidYouMean string
+}
+
+// GetComics возвращает страницу наиболее релевантных фразе комиксов.
+// Limit страницы ограничивается cfg.MaxLimit, при нулевом значении используется cfg.DefaultLimit.
+func (f FindComicsUsecase) GetComics(ctx context.Context, phrase string, page models.Page) (SearchResult, error) {
+	page = f.normalizePage(page)
+
+	ids, didYouMean, err := f.GetIDs(ctx, phrase)
 	if err != nil {
-		return nil, err
+		return SearchResult{}, err
 	}
 
-	result := make([]models.ComicsInfo, 0, len(ids))
+	if len(ids) == 0 {
+		return SearchResult{}, models.ErrNotFound
+	}
 
-	for _, id := range ids {
-		c, e := f.db.GetByID(ctx, id)
-		if e != nil {
-			err = errors.Join(err, e)
-		}
+	result := SearchResult{
+		Comics:     make([]FoundComics, 0, page.Limit),
+		Total:      len(ids),
+		Page:       page,
+		DidYouMean: didYouMean,
+	}
+
+	if page.Offset >= len(ids) {
+		return result, nil
+	}
 
-		result = append(result, c)
+	ids = ids[page.Offset:]
+	if len(ids) > page.Limit {
+		ids = ids[:page.Limit]
 	}
 
+	pageIDs := make([]string, 0, len(ids))
+	for _, id := range ids {
+		pageIDs = append(pageIDs, id.ID)
+	}
+
+	comics, err := f.db.GetByIDs(ctx, pageIDs)
 	if err != nil {
-		return nil, err
+		return SearchResult{}, fmt.Errorf("get by ids error: %w", err)
+	}
+
+	scores := make(map[string]float64, len(ids))
+	for _, id := range ids {
+		scores[id.ID] = id.Score
 	}
 
-	if len(result) == 0 {
-		return nil, models.ErrNotFound
+	for _, c := range comics {
+		result.Comics = append(result.Comics, FoundComics{ComicsInfo: c, Score: scores[c.ID]})
 	}
 
 	return result, nil
 }
 
-func (f FindComicsUsecase) GetIDs(ctx context.Context, phrase string) ([]string, error) {
-	normalizedPhrase, err := words.StemWords(phrase)
+func (f FindComicsUsecase) GetComicsByID(ctx context.Context, id string) (models.ComicsInfo, error) {
+	c, err := f.db.GetByID(ctx, id)
+	if err != nil {
+		return models.ComicsInfo{}, fmt.Errorf("get by id error: %w", err)
+	}
+
+	return c, nil
+}
+
+func (f FindComicsUsecase) normalizePage(page models.Page) models.Page {
+	if page.Limit <= 0 {
+		page.Limit = f.cfg.DefaultLimit
+	}
+
+	if f.cfg.MaxLimit > 0 && page.Limit > f.cfg.MaxLimit {
+		page.Limit = f.cfg.MaxLimit
+	}
+
+	page.Offset = max(page.Offset, 0)
+
+	return page
+}
+
+// GetIDs разбирает поисковый запрос (см. parseQuery) и возвращает id найденных комиксов
+// в порядке убывания релевантности по BM25. Слова, которых нет в индексе, заменяются
+// ближайшими словами словаря; в этом случае вторым значением возвращается исправленный запрос.
+// Стратегия поиска берется из контекста (models.WithIndexStrategy), а если она там не задана —
+// из cfg.Strategy. При стратегии tsvector запрос целиком разбирает и ранжирует хранилище.
+func (f FindComicsUsecase) GetIDs(ctx context.Context, phrase string) ([]ScoredID, string, error) {
+	strategy := models.IndexStrategyFrom(ctx, models.IndexStrategy(f.cfg.Strategy))
+	ctx = models.WithIndexStrategy(ctx, strategy)
+
+	if strategy == models.IndexFullText {
+		ids, err := f.searchFullText(ctx, phrase)
+
+		return ids, "", err
+	}
+
+	query, err := parseQuery(phrase, f.stemmer)
+	if err != nil {
+		return nil, "", fmt.Errorf("parse query error: %w", err)
+	}
+
+	if query == nil {
+		return []ScoredID{}, "", nil
+	}
+
+	stats, err := f.db.GetStats(ctx)
 	if err != nil {
-		return nil, fmt.Errorf("stem words error: %w", err)
+		return nil, "", fmt.Errorf("get stats error: %w", err)
 	}
 
-	ids := make([][]string, 0, len(normalizedPhrase))
+	ev := newQueryEvaluator(f.db, stats, f.l)
+
+	query, corrected := f.correctQuery(ctx, ev, query)
 
-	for _, word := range normalizedPhrase {
-		wordIDs := make([]string, 0, ResultLen)
+	var didYouMean string
 
-		comics, err := f.db.GetByWord(ctx, word, ResultLen)
+	if len(corrected) > 0 {
+		didYouMean = replaceTerms(phrase, corrected, func(n termNode) string {
+			return f.surfaceForm(ctx, ev, n.words[0])
+		})
+	}
+
+	return sortScores(ev.eval(ctx, query)), didYouMean, nil
+}
+
+// replaceTerms заменяет в запросе q текст каждого из узлов terms на результат repl.
+// Заменяются ровно позиции узлов, поэтому совпадающий текст в других словах не меняется.
+func replaceTerms(q string, terms []termNode, repl func(termNode) string) string {
+	terms = slices.Clone(terms)
+	slices.SortFunc(terms, func(a, b termNode) int { return cmp.Compare(a.start, b.start) })
+
+	rs := []rune(q)
+
+	var sb strings.Builder
+
+	prev := 0
+
+	for _, t := range terms {
+		sb.WriteString(string(rs[prev:t.start]))
+		sb.WriteString(repl(t))
+		prev = t.end
+	}
+
+	sb.WriteString(string(rs[prev:]))
+
+	return sb.String()
+}
+
+func (f FindComicsUsecase) searchFullText(ctx context.Context, phrase string) ([]ScoredID, error) {
+	fts, ok := f.db.(FullTextSearcher)
+	if !ok {
+		return nil, ErrFullTextUnsupported
+	}
+
+	scores, err := fts.SearchFullText(ctx, phrase)
+	if err != nil {
+		return nil, fmt.Errorf("full-text search error: %w", err)
+	}
+
+	return sortScores(scores), nil
+}
+
+// Suggest возвращает слова словаря, начинающиеся с prefix, для автодополнения.
+func (f FindComicsUsecase) Suggest(ctx context.Context, prefix string, limit int) ([]models.Keyword, error) {
+	limit = f.normalizePage(models.Page{Limit: limit, Offset: 0}).Limit
+	prefix = strings.ToLower(strings.TrimSpace(prefix))
+
+	if prefix == "" {
+		return []models.Keyword{}, nil
+	}
+
+	result, err := f.vocab.withPrefix(ctx, prefix, limit)
+	if err != nil {
+		return nil, err
+	}
+
+	// Введенное полностью слово может не быть префиксом своей основы ("physics" -> "physic").
+	if stems := words.Tokens(f.stemmer, prefix); len(stems) == 1 && stems[0] != prefix && len(result) < limit {
+		stemmed, err := f.vocab.withPrefix(ctx, stems[0], limit-len(result))
 		if err != nil {
-			f.l.Error("get by word", "error", err)
+			return nil, err
 		}
 
-		for _, c := range comics {
-			wordIDs = append(wordIDs, c.ID)
+		for _, k := range stemmed {
+			if !strings.HasPrefix(k.Word, prefix) {
+				result = append(result, k)
+			}
 		}
-
-		ids = append(ids, wordIDs)
 	}
 
-	result := GetTopIDs(ids...)
-
 	return result, nil
 }
 
-// GetTopIDs получает пересечение переданных слайсов с учетом частоты,
-// с которой элементы пересечения встречаются.
-func GetTopIDs(results ...[]string) []string {
-	result := make([]string, 0, ResultLen)
-	h := make(map[string]int)
+// correctQuery заменяет отсутствующие в индексе слова запроса ближайшими словами словаря.
+// Исключаемые слова и фразы не исправляются. Возвращает исправленные узлы.
+func (f FindComicsUsecase) correctQuery(ctx context.Context, ev *queryEvaluator, n queryNode) (queryNode, []termNode) { //nolint:ireturn,lll
+	switch n := n.(type) {
+	case termNode:
+		if len(n.words) != 1 || len(ev.getPostings(ctx, n.words[0])) > 0 {
+			return n, nil
+		}
+
+		word, ok, err := f.vocab.closest(ctx, n.words[0])
+		if err != nil {
+			f.l.Error("closest word", "error", err)
+		}
+
+		if !ok {
+			return n, nil
+		}
+
+		n.words = []string{word}
+
+		return n, []termNode{n}
+	case boolNode:
+		children := make([]queryNode, 0, len(n.children))
+		corrected := make([]termNode, 0)
 
-	for _, res := range results {
-		for _, word := range res {
-			h[word]++
+		for _, child := range n.children {
+			c, cs := f.correctQuery(ctx, ev, child)
+			children = append(children, c)
+			corrected = append(corrected, cs...)
 		}
+
+		n.children = children
+
+		return n, corrected
+	default:
+		return n, nil
 	}
+}
 
-	sortedIDs := make([]struct {
-		Key   string
-		Value int
-	}, 0, len(h))
+// surfaceForm возвращает самую частую исходную форму основы stem в текстах
+// содержащих ее комиксов, чтобы в исправленном запросе было слово, а не основа
+// ("physics", а не "physic"). Если форма не найдена, возвращает stem.
+func (f FindComicsUsecase) surfaceForm(ctx context.Context, ev *queryEvaluator, stem string) string {
+	postings := ev.getPostings(ctx, stem)
 
-	for k, v := range h {
-		sortedIDs = append(sortedIDs, struct {
-			Key   string
-			Value int
-		}{k, v})
+	ids := make([]string, 0, min(len(postings), surfaceSample))
+	for _, p := range postings[:cap(ids)] {
+		ids = append(ids, p.ID)
+	}
+
+	comics, err := f.db.GetByIDs(ctx, ids)
+	if err != nil {
+		f.l.Error("surface form", "error", fmt.Errorf("word %q: %w", stem, err))
+
+		return stem
+	}
+
+	counts := make(map[string]int)
+
+	for _, ci := range comics {
+		for _, text := range []string{ci.Title, ci.Alt, ci.Transcript} {
+			for _, w := range words.Words(f.stemmer, text) {
+				if f.stemmer.Stem(w) == stem {
+					counts[w]++
+				}
+			}
+		}
 	}
 
-	sort.Slice(sortedIDs, func(i, j int) bool {
-		return sortedIDs[i].Value > sortedIDs[j].Value
-	})
+	best := stem
+	bestCount := 0
 
-	for i := 0; i < len(sortedIDs); i++ {
-		result = append(result, sortedIDs[i].Key)
-		if len(result) == ResultLen {
-			break
+	for w, c := range counts {
+		if c > bestCount || (c == bestCount && w < best) {
+			best, bestCount = w, c
 		}
 	}
 
-	return result
+	return best
 }
@@ -0,0 +1,61 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	user "github.com/Leopold1975/yadro_app/internal/auth/models"
+	"github.com/Leopold1975/yadro_app/internal/models"
+)
+
+var ErrIndexCheckUnsupported = errors.New("index consistency check is not supported by storage")
+
+type IndexCheckUsecase struct {
+	checker IndexChecker
+	audit   Auditor
+}
+
+// NewIndexCheck создает проверку индекса. Если db хранит индекс в одном
+// представлении и не реализует IndexChecker, проверка возвращает ErrIndexCheckUnsupported.
+// Исправления записываются в журнал audit.
+func NewIndexCheck(db Storage, audit Auditor) IndexCheckUsecase {
+	checker, _ := db.(IndexChecker)
+
+	return IndexCheckUsecase{
+		checker: checker,
+		audit:   audit,
+	}
+}
+
+// Check возвращает расхождения между представлениями индекса.
+func (u IndexCheckUsecase) Check(ctx context.Context) (models.IndexReport, error) {
+	if u.checker == nil {
+		return models.IndexReport{}, ErrIndexCheckUnsupported
+	}
+
+	report, err := u.checker.CheckIndex(ctx)
+	if err != nil {
+		return models.IndexReport{}, fmt.Errorf("check index error: %w", err)
+	}
+
+	return report, nil
+}
+
+// Repair исправляет расхождения и возвращает найденные до исправления.
+func (u IndexCheckUsecase) Repair(ctx context.Context) (_ models.IndexReport, err error) { //nolint:nonamedreturns
+	defer func() {
+		u.audit.Record(ctx, user.AuditEntry{Action: user.AuditIndexRepair}, err) //nolint:exhaustruct
+	}()
+
+	if u.checker == nil {
+		return models.IndexReport{}, ErrIndexCheckUnsupported
+	}
+
+	report, err := u.checker.RepairIndex(ctx)
+	if err != nil {
+		return models.IndexReport{}, fmt.Errorf("repair index error: %w", err)
+	}
+
+	return report, nil
+}
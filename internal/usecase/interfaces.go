@@ -2,13 +2,57 @@ package usecase
 
 import (
 	"context"
+	"io"
 
+	user "github.com/Leopold1975/yadro_app/internal/auth/models"
 	"github.com/Leopold1975/yadro_app/internal/models"
 )
 
+// Auditor записывает действия пользователей в журнал аудита. Автора и адрес
+// клиента он берет из контекста запроса.
+type Auditor interface {
+	Record(ctx context.Context, e user.AuditEntry, err error)
+}
+
 type Storage interface {
 	AddOne(ctx context.Context, ci models.ComicsInfo) error
+	// AddMany сохраняет пачку комиксов целиком или не сохраняет ни одного.
+	AddMany(ctx context.Context, comics []models.ComicsInfo) error
 	GetByID(ctx context.Context, id string) (models.ComicsInfo, error)
-	GetByWord(ctx context.Context, word string, resultLen int) ([]models.ComicsInfo, error)
+	GetByIDs(ctx context.Context, ids []string) ([]models.ComicsInfo, error)
+	GetMissingIDs(ctx context.Context, maxID int) ([]string, error)
+	GetAllIDs(ctx context.Context) ([]string, error)
+	GetByWord(ctx context.Context, word string, page models.Page) ([]models.ComicsInfo, error)
+	GetPostings(ctx context.Context, word string) ([]models.Posting, error)
+	GetStats(ctx context.Context) (models.IndexStats, error)
+	GetVocabulary(ctx context.Context) ([]models.Keyword, error)
+	// SetImage заменяет картинку сохраненного комикса. Возвращает models.ErrNotFound, если комикса нет.
+	SetImage(ctx context.Context, id string, img models.Image) error
+	// ReplaceIndex заменяет индекс комиксами, переданными build в put, атомарно:
+	// до успешного завершения build поиск работает по старому индексу,
+	// а при ошибке старый индекс остается.
+	ReplaceIndex(ctx context.Context, build func(put models.PutIndexFunc) error) error
+	// GetIndexMeta возвращает models.ErrNotFound, если значение не записано.
+	GetIndexMeta(ctx context.Context, key string) (string, error)
+	SetIndexMeta(ctx context.Context, key, value string) error
 	Flush(ctx context.Context, updateIndex bool) (int, int, error)
 }
+
+// IndexChecker реализуют хранилища, которые держат индекс в двух представлениях
+// (см. models.IndexStrategy) и могут проверить и восстановить их согласованность.
+type IndexChecker interface {
+	CheckIndex(ctx context.Context) (models.IndexReport, error)
+	RepairIndex(ctx context.Context) (models.IndexReport, error)
+}
+
+// FullTextSearcher реализуют хранилища, умеющие полнотекстовый поиск с ранжированием
+// (стратегия models.IndexFullText). Возвращает релевантность каждого найденного комикса.
+type FullTextSearcher interface {
+	SearchFullText(ctx context.Context, phrase string) (map[string]float64, error)
+}
+
+// ImageStore хранит картинки комиксов, адресуя их хэшем содержимого.
+type ImageStore interface {
+	Put(ctx context.Context, data []byte) (models.Image, error)
+	Open(hash string) (io.ReadSeekCloser, error)
+}
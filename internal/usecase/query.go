@@ -0,0 +1,330 @@
+package usecase
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+
+	"github.com/Leopold1975/yadro_app/internal/models"
+	"github.com/Leopold1975/yadro_app/pkg/words"
+)
+
+var ErrInvalidQuery = errors.New("invalid query")
+
+// Синтаксис поискового запроса:
+//
+//	query   = or
+//	or      = and { ["OR"] and }     слова без оператора объединяются через OR
+//	and     = unary { "AND" unary }
+//	unary   = ["-"] primary          "-" исключает комиксы из результата
+//	primary = [field ":"] (word | '"' phrase '"') | "(" or ")"
+//
+// field — одно из полей комикса: title, alt или transcript.
+const (
+	opAnd = "AND"
+	opOr  = "OR"
+)
+
+type queryNode interface {
+	isQueryNode()
+}
+
+// termNode — слово или фраза (несколько слов подряд) с необязательным ограничением по полю.
+// [start, end) — позиции в рунах текста слова или фразы в исходном запросе
+// без префикса поля и кавычек.
+type termNode struct {
+	field      string
+	words      []string
+	start, end int
+}
+
+type boolNode struct {
+	op       string
+	children []queryNode
+}
+
+type notNode struct {
+	child queryNode
+}
+
+func (termNode) isQueryNode() {}
+func (boolNode) isQueryNode() {}
+func (notNode) isQueryNode()  {}
+
+type tokenKind int
+
+const (
+	tokWord tokenKind = iota
+	tokPhrase
+	tokLParen
+	tokRParen
+	tokNot
+	tokAnd
+	tokOr
+)
+
+// queryToken — лексема запроса. Для слов и фраз [start, end) — позиции text в запросе в рунах.
+type queryToken struct {
+	kind       tokenKind
+	field      string
+	text       string
+	start, end int
+}
+
+// parseQuery разбирает запрос в дерево. Возвращает nil, если после нормализации
+// в запросе не осталось ни одного слова. Слова запроса приводятся к основам стеммером s.
+func parseQuery(q string, s words.Stemmer) (queryNode, error) { //nolint:ireturn
+	tokens, err := lexQuery(q)
+	if err != nil {
+		return nil, err
+	}
+
+	p := queryParser{tokens: tokens, pos: 0, stemmer: s}
+
+	node, err := p.parseOr()
+	if err != nil {
+		return nil, err
+	}
+
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("%w: unexpected %q", ErrInvalidQuery, p.tokens[p.pos].text)
+	}
+
+	return node, nil
+}
+
+func lexQuery(q string) ([]queryToken, error) { //nolint:cyclop
+	rs := []rune(q)
+	tokens := make([]queryToken, 0)
+
+	for i := 0; i < len(rs); {
+		r := rs[i]
+
+		switch {
+		case unicode.IsSpace(r):
+			i++
+		case r == '(':
+			tokens = append(tokens, queryToken{kind: tokLParen, text: "("})
+			i++
+		case r == ')':
+			tokens = append(tokens, queryToken{kind: tokRParen, text: ")"})
+			i++
+		case r == '-' && (i == 0 || isQueryDelimiter(rs[i-1])):
+			tokens = append(tokens, queryToken{kind: tokNot, text: "-"})
+			i++
+		default:
+			tok, next, err := lexTerm(rs, i)
+			if err != nil {
+				return nil, err
+			}
+
+			tokens = append(tokens, tok)
+			i = next
+		}
+	}
+
+	return tokens, nil
+}
+
+// lexTerm читает слово, фразу в кавычках или оператор AND/OR, начиная с позиции start.
+func lexTerm(rs []rune, start int) (queryToken, int, error) {
+	i := start
+
+	var field string
+
+	if rs[i] != '"' {
+		j := i
+		for j < len(rs) && !isQueryDelimiter(rs[j]) && rs[j] != '"' && rs[j] != ':' {
+			j++
+		}
+
+		if j < len(rs) && rs[j] == ':' && isQueryField(string(rs[i:j])) {
+			field = strings.ToLower(string(rs[i:j]))
+			i = j + 1
+		}
+	}
+
+	if i < len(rs) && rs[i] == '"' {
+		end := i + 1
+		for end < len(rs) && rs[end] != '"' {
+			end++
+		}
+
+		if end == len(rs) {
+			return queryToken{}, 0, fmt.Errorf("%w: unclosed quote", ErrInvalidQuery)
+		}
+
+		return queryToken{kind: tokPhrase, field: field, text: string(rs[i+1 : end]), start: i + 1, end: end}, end + 1, nil
+	}
+
+	end := i
+	for end < len(rs) && !isQueryDelimiter(rs[end]) && rs[end] != '"' {
+		end++
+	}
+
+	text := string(rs[i:end])
+
+	switch {
+	case field == "" && text == opAnd:
+		return queryToken{kind: tokAnd, text: text}, end, nil
+	case field == "" && text == opOr:
+		return queryToken{kind: tokOr, text: text}, end, nil
+	default:
+		return queryToken{kind: tokWord, field: field, text: text, start: i, end: end}, end, nil
+	}
+}
+
+func isQueryDelimiter(r rune) bool {
+	return unicode.IsSpace(r) || r == '(' || r == ')'
+}
+
+func isQueryField(s string) bool {
+	switch strings.ToLower(s) {
+	case models.FieldTitle, models.FieldAlt, models.FieldTranscript:
+		return true
+	default:
+		return false
+	}
+}
+
+type queryParser struct {
+	tokens  []queryToken
+	pos     int
+	stemmer words.Stemmer
+}
+
+func (p *queryParser) peek() (queryToken, bool) {
+	if p.pos >= len(p.tokens) {
+		return queryToken{}, false
+	}
+
+	return p.tokens[p.pos], true
+}
+
+func (p *queryParser) parseOr() (queryNode, error) { //nolint:ireturn
+	children := make([]queryNode, 0)
+
+	for {
+		tok, ok := p.peek()
+		if !ok || tok.kind == tokRParen {
+			break
+		}
+
+		if tok.kind == tokOr {
+			p.pos++
+
+			continue
+		}
+
+		node, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+
+		if node != nil {
+			children = append(children, node)
+		}
+	}
+
+	return newBoolNode(opOr, children), nil
+}
+
+func (p *queryParser) parseAnd() (queryNode, error) { //nolint:ireturn
+	node, err := p.parseUnary()
+	if err != nil {
+		return nil, err
+	}
+
+	children := make([]queryNode, 0, 1)
+	if node != nil {
+		children = append(children, node)
+	}
+
+	for {
+		tok, ok := p.peek()
+		if !ok || tok.kind != tokAnd {
+			break
+		}
+
+		p.pos++
+
+		node, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+
+		if node != nil {
+			children = append(children, node)
+		}
+	}
+
+	return newBoolNode(opAnd, children), nil
+}
+
+func (p *queryParser) parseUnary() (queryNode, error) { //nolint:ireturn
+	tok, ok := p.peek()
+	if !ok {
+		return nil, fmt.Errorf("%w: unexpected end of query", ErrInvalidQuery)
+	}
+
+	if tok.kind != tokNot {
+		return p.parsePrimary()
+	}
+
+	p.pos++
+
+	node, err := p.parsePrimary()
+	if err != nil || node == nil {
+		return nil, err
+	}
+
+	return notNode{child: node}, nil
+}
+
+func (p *queryParser) parsePrimary() (queryNode, error) { //nolint:ireturn
+	tok, ok := p.peek()
+	if !ok {
+		return nil, fmt.Errorf("%w: unexpected end of query", ErrInvalidQuery)
+	}
+
+	p.pos++
+
+	switch tok.kind {
+	case tokWord, tokPhrase:
+		stems := words.Tokens(p.stemmer, tok.text)
+		if len(stems) == 0 {
+			return nil, nil //nolint:nilnil // стоп-слова не участвуют в поиске.
+		}
+
+		return termNode{field: tok.field, words: stems, start: tok.start, end: tok.end}, nil
+	case tokLParen:
+		node, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+
+		if next, ok := p.peek(); !ok || next.kind != tokRParen {
+			return nil, fmt.Errorf("%w: missing closing parenthesis", ErrInvalidQuery)
+		}
+
+		p.pos++
+
+		return node, nil
+	case tokRParen, tokNot, tokAnd, tokOr:
+		return nil, fmt.Errorf("%w: unexpected %q", ErrInvalidQuery, tok.text)
+	default:
+		return nil, fmt.Errorf("%w: unexpected %q", ErrInvalidQuery, tok.text)
+	}
+}
+
+func newBoolNode(op string, children []queryNode) queryNode { //nolint:ireturn
+	switch len(children) {
+	case 0:
+		return nil
+	case 1:
+		return children[0]
+	default:
+		return boolNode{op: op, children: children}
+	}
+}
@@ -0,0 +1,203 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/Leopold1975/yadro_app/internal/models"
+	"github.com/Leopold1975/yadro_app/pkg/logger"
+)
+
+var allFields = []string{models.FieldTitle, models.FieldAlt, models.FieldTranscript} //nolint:gochecknoglobals
+
+// queryEvaluator вычисляет дерево запроса по индексу: каждому узлу соответствует
+// множество комиксов с BM25 весами. Списки вхождений кэшируются на время одного запроса.
+type queryEvaluator struct {
+	db       Storage
+	stats    models.IndexStats
+	postings map[string][]models.Posting
+	l        logger.Logger
+}
+
+func newQueryEvaluator(db Storage, stats models.IndexStats, l logger.Logger) *queryEvaluator {
+	return &queryEvaluator{
+		db:       db,
+		stats:    stats,
+		postings: make(map[string][]models.Posting),
+		l:        l,
+	}
+}
+
+func (e *queryEvaluator) eval(ctx context.Context, n queryNode) map[string]float64 {
+	switch n := n.(type) {
+	case termNode:
+		if len(n.words) == 1 {
+			return e.evalTerm(ctx, n.words[0], n.field)
+		}
+
+		return e.evalPhrase(ctx, n)
+	case boolNode:
+		return e.evalBool(ctx, n)
+	case notNode:
+		// Исключение само по себе ничего не находит, оно учитывается родительским узлом.
+		return map[string]float64{}
+	default:
+		return map[string]float64{}
+	}
+}
+
+func (e *queryEvaluator) evalBool(ctx context.Context, n boolNode) map[string]float64 {
+	var result map[string]float64
+
+	excluded := make([]map[string]float64, 0)
+
+	for _, child := range n.children {
+		if not, ok := child.(notNode); ok {
+			excluded = append(excluded, e.eval(ctx, not.child))
+
+			continue
+		}
+
+		scores := e.eval(ctx, child)
+
+		switch {
+		case result == nil:
+			result = scores
+		case n.op == opAnd:
+			result = intersectScores(result, scores)
+		default:
+			result = unionScores(result, scores)
+		}
+	}
+
+	for _, ex := range excluded {
+		for id := range ex {
+			delete(result, id)
+		}
+	}
+
+	if result == nil {
+		return map[string]float64{}
+	}
+
+	return result
+}
+
+func (e *queryEvaluator) evalTerm(ctx context.Context, word, field string) map[string]float64 {
+	return scoreBM25(e.stats, filterByField(e.getPostings(ctx, word), field))
+}
+
+// evalPhrase находит комиксы, в которых слова фразы идут подряд в одном поле.
+// Вес комикса — сумма весов слов фразы.
+func (e *queryEvaluator) evalPhrase(ctx context.Context, n termNode) map[string]float64 {
+	byWord := make([]map[string]models.Posting, 0, len(n.words))
+	scores := make(map[string]float64)
+
+	for _, w := range n.words {
+		ps := e.getPostings(ctx, w)
+
+		byID := make(map[string]models.Posting, len(ps))
+		for _, p := range ps {
+			byID[p.ID] = p
+		}
+
+		byWord = append(byWord, byID)
+
+		for id, score := range scoreBM25(e.stats, ps) {
+			scores[id] += score
+		}
+	}
+
+	fields := allFields
+	if n.field != "" {
+		fields = []string{n.field}
+	}
+
+	result := make(map[string]float64)
+
+	for id, score := range scores {
+		if matchPhrase(id, byWord, fields) {
+			result[id] = score
+		}
+	}
+
+	return result
+}
+
+func (e *queryEvaluator) getPostings(ctx context.Context, word string) []models.Posting {
+	if ps, ok := e.postings[word]; ok {
+		return ps
+	}
+
+	ps, err := e.db.GetPostings(ctx, word)
+	if err != nil {
+		e.l.Error("get postings", "error", fmt.Errorf("word %q: %w", word, err))
+	}
+
+	e.postings[word] = ps
+
+	return ps
+}
+
+func matchPhrase(id string, byWord []map[string]models.Posting, fields []string) bool {
+	first, ok := byWord[0][id]
+	if !ok {
+		return false
+	}
+
+	for _, field := range fields {
+	starts:
+		for _, start := range first.Positions[field] {
+			for k := 1; k < len(byWord); k++ {
+				p, ok := byWord[k][id]
+				if !ok || !slices.Contains(p.Positions[field], start+k) {
+					continue starts
+				}
+			}
+
+			return true
+		}
+	}
+
+	return false
+}
+
+// filterByField оставляет вхождения слова в указанном поле,
+// частотой слова становится количество вхождений в этом поле.
+func filterByField(postings []models.Posting, field string) []models.Posting {
+	if field == "" {
+		return postings
+	}
+
+	result := make([]models.Posting, 0, len(postings))
+
+	for _, p := range postings {
+		if n := len(p.Positions[field]); n > 0 {
+			p.TermFreq = n
+			result = append(result, p)
+		}
+	}
+
+	return result
+}
+
+func intersectScores(a, b map[string]float64) map[string]float64 {
+	result := make(map[string]float64)
+
+	for id, score := range a {
+		if s, ok := b[id]; ok {
+			result[id] = score + s
+		}
+	}
+
+	return result
+}
+
+func unionScores(a, b map[string]float64) map[string]float64 {
+	for id, score := range b {
+		a[id] += score
+	}
+
+	return a
+}
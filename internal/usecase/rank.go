@@ -0,0 +1,89 @@
+package usecase
+
+import (
+	"math"
+	"sort"
+
+	"github.com/Leopold1975/yadro_app/internal/models"
+)
+
+// Параметры BM25 в их общепринятых значениях.
+const (
+	bm25K1 = 1.2
+	bm25B  = 0.75
+)
+
+type ScoredID struct {
+	ID    string
+	Score float64
+}
+
+// RankBM25 ранжирует комиксы по сумме BM25 весов слов запроса.
+// Каждый элемент postings — полный список вхождений одного слова запроса.
+// Результат отсортирован по убыванию релевантности, при равенстве — по возрастанию id.
+func RankBM25(stats models.IndexStats, postings ...[]models.Posting) []ScoredID {
+	scores := make(map[string]float64)
+
+	for _, ps := range postings {
+		for id, score := range scoreBM25(stats, ps) {
+			scores[id] += score
+		}
+	}
+
+	return sortScores(scores)
+}
+
+// scoreBM25 возвращает BM25 вес одного слова для каждого комикса из его списка вхождений.
+func scoreBM25(stats models.IndexStats, postings []models.Posting) map[string]float64 {
+	scores := make(map[string]float64, len(postings))
+	if len(postings) == 0 {
+		return scores
+	}
+
+	idf := bm25IDF(stats.Total, len(postings))
+
+	for _, p := range postings {
+		scores[p.ID] += idf * bm25TF(p.TermFreq, p.Length, stats.AvgLength)
+	}
+
+	return scores
+}
+
+// sortScores упорядочивает комиксы по убыванию веса, при равенстве — по возрастанию id.
+func sortScores(scores map[string]float64) []ScoredID {
+	result := make([]ScoredID, 0, len(scores))
+	for id, score := range scores {
+		result = append(result, ScoredID{ID: id, Score: score})
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Score != result[j].Score {
+			return result[i].Score > result[j].Score
+		}
+
+		return models.LessID(result[i].ID, result[j].ID)
+	})
+
+	return result
+}
+
+// bm25IDF всегда положителен, поэтому слово, встречающееся почти во всех комиксах,
+// не уменьшает вес документа.
+func bm25IDF(total, docFreq int) float64 {
+	if total < docFreq {
+		total = docFreq
+	}
+
+	return math.Log(1 + (float64(total-docFreq)+0.5)/(float64(docFreq)+0.5)) //nolint:gomnd
+}
+
+func bm25TF(termFreq, length int, avgLength float64) float64 {
+	tf := float64(termFreq)
+
+	norm := 1.0
+	if avgLength > 0 {
+		norm = 1 - bm25B + bm25B*float64(length)/avgLength
+	}
+
+	return tf * (bm25K1 + 1) / (tf + bm25K1*norm)
+}
@@ -0,0 +1,270 @@
+package usecase
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	user "github.com/Leopold1975/yadro_app/internal/auth/models"
+	"github.com/Leopold1975/yadro_app/internal/models"
+	"github.com/Leopold1975/yadro_app/pkg/logger"
+	"github.com/Leopold1975/yadro_app/pkg/words"
+)
+
+const (
+	// StemmerMetaKey — ключ метаданных индекса с именем стеммера, которым он построен.
+	StemmerMetaKey = "stemmer"
+	reindexBatch   = 100
+)
+
+// ReindexUsecase перестраивает ключевые слова всех комиксов из сохраненных заголовка,
+// alt и транскрипта. Одновременно выполняется не больше одной перестройки:
+// повторный запуск во время выполнения присоединяется к текущей.
+type ReindexUsecase struct {
+	ctx     context.Context //nolint:containedctx // перестройка переживает запрос, который ее запустил.
+	db      Storage
+	stemmer words.Stemmer
+	audit   Auditor
+	l       logger.Logger
+	state   *reindexState
+}
+
+// ReindexProgress — ход перестройки. Skipped — комиксы без текста, сохраненные
+// до появления метаданных: их индекс остается прежним.
+type ReindexProgress struct {
+	Total   int
+	Indexed int
+	Skipped int
+}
+
+// ReindexStatus — состояние последней перестройки. Error пуст, если она
+// выполняется или завершилась успешно.
+type ReindexStatus struct {
+	Running    bool
+	Stemmer    string
+	StartedAt  time.Time
+	FinishedAt time.Time
+	Progress   ReindexProgress
+	Error      string
+}
+
+type reindexState struct {
+	mu     sync.Mutex
+	status ReindexStatus
+	done   chan struct{}
+	err    error
+}
+
+// NewReindex создает перестройку индекса стеммером stemmer. Запущенные через Start
+// перестройки выполняются в контексте ctx и отменяются вместе с ним, а их запуски
+// записываются в журнал audit.
+func NewReindex(ctx context.Context, db Storage, stemmer words.Stemmer, audit Auditor, l logger.Logger,
+) ReindexUsecase {
+	return ReindexUsecase{
+		ctx:     ctx,
+		db:      db,
+		stemmer: stemmer,
+		audit:   audit,
+		l:       l,
+		state: &reindexState{
+			mu:     sync.Mutex{},
+			status: ReindexStatus{Stemmer: stemmer.Name()}, //nolint:exhaustruct
+			done:   nil,
+			err:    nil,
+		},
+	}
+}
+
+// EnsureStemmer сравнивает стеммер, которым построен индекс, с текущим и при
+// несовпадении перестраивает индекс. Индекс без записанного стеммера считается
+// построенным porter2, так как других стеммеров раньше не было.
+func (r ReindexUsecase) EnsureStemmer(ctx context.Context) error {
+	indexed, err := r.db.GetIndexMeta(ctx, StemmerMetaKey)
+	if err != nil && !errors.Is(err, models.ErrNotFound) {
+		return fmt.Errorf("get index stemmer error: %w", err)
+	}
+
+	if err != nil {
+		ids, err := r.db.GetAllIDs(ctx)
+		if err != nil {
+			return fmt.Errorf("get ids error: %w", err)
+		}
+
+		if len(ids) == 0 || r.stemmer.Name() == words.Porter2Stemmer {
+			return r.saveStemmer(ctx)
+		}
+
+		indexed = words.Porter2Stemmer
+	}
+
+	if indexed == r.stemmer.Name() {
+		return nil
+	}
+
+	r.l.Info("index stemmer mismatch, reindexing", "indexed", indexed, "configured", r.stemmer.Name())
+
+	if _, err := r.Run(ctx); err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Start запускает перестройку или возвращает состояние уже выполняющейся.
+// joined равен true, если перестройка была запущена раньше.
+// ctx — контекст запроса, перестройка от него не зависит.
+func (r ReindexUsecase) Start(ctx context.Context) (status ReindexStatus, joined bool) { //nolint:nonamedreturns
+	_, joined = r.start()
+
+	r.audit.Record(ctx, user.AuditEntry{ //nolint:exhaustruct
+		Action:  user.AuditIndexReindex,
+		Target:  r.stemmer.Name(),
+		Details: "joined=" + strconv.FormatBool(joined),
+	}, nil)
+
+	return r.Status(), joined
+}
+
+// Status возвращает состояние последней перестройки.
+func (r ReindexUsecase) Status() ReindexStatus {
+	r.state.mu.Lock()
+	defer r.state.mu.Unlock()
+
+	return r.state.status
+}
+
+// Run запускает перестройку или присоединяется к выполняющейся и ждет ее завершения.
+func (r ReindexUsecase) Run(ctx context.Context) (ReindexProgress, error) {
+	done, _ := r.start()
+
+	select {
+	case <-ctx.Done():
+		return ReindexProgress{}, fmt.Errorf("wait reindex: %w", ctx.Err())
+	case <-done:
+	}
+
+	r.state.mu.Lock()
+	defer r.state.mu.Unlock()
+
+	return r.state.status.Progress, r.state.err
+}
+
+func (r ReindexUsecase) start() (chan struct{}, bool) {
+	r.state.mu.Lock()
+	defer r.state.mu.Unlock()
+
+	if r.state.status.Running {
+		return r.state.done, true
+	}
+
+	r.state.status = ReindexStatus{
+		Running:    true,
+		Stemmer:    r.stemmer.Name(),
+		StartedAt:  time.Now(),
+		FinishedAt: time.Time{},
+		Progress:   ReindexProgress{}, //nolint:exhaustruct
+		Error:      "",
+	}
+	r.state.done = make(chan struct{})
+	r.state.err = nil
+
+	r.l.Info("reindex started", "stemmer", r.stemmer.Name())
+
+	go r.run(r.state.done)
+
+	return r.state.done, false
+}
+
+func (r ReindexUsecase) run(done chan struct{}) {
+	err := r.reindex(r.ctx)
+
+	r.state.mu.Lock()
+	defer r.state.mu.Unlock()
+
+	r.state.status.Running = false
+	r.state.status.FinishedAt = time.Now()
+	r.state.err = err
+
+	close(done)
+
+	p := r.state.status.Progress
+
+	if err != nil {
+		r.state.status.Error = err.Error()
+		r.l.Error("reindex failed", "error", err, "indexed", p.Indexed, "total", p.Total)
+
+		return
+	}
+
+	r.l.Info("reindex finished", "stemmer", r.stemmer.Name(), "indexed", p.Indexed, "skipped", p.Skipped)
+}
+
+// reindex читает комиксы пачками по reindexBatch, строит их индекс заново и
+// заменяет им индекс хранилища целиком, после чего записывает имя стеммера.
+func (r ReindexUsecase) reindex(ctx context.Context) error {
+	ids, err := r.db.GetAllIDs(ctx)
+	if err != nil {
+		return fmt.Errorf("get ids error: %w", err)
+	}
+
+	r.update(func(p *ReindexProgress) { p.Total = len(ids) })
+
+	err = r.db.ReplaceIndex(ctx, func(put models.PutIndexFunc) error {
+		for start := 0; start < len(ids); start += reindexBatch {
+			comics, err := r.db.GetByIDs(ctx, ids[start:min(start+reindexBatch, len(ids))])
+			if err != nil {
+				return fmt.Errorf("get comics error: %w", err)
+			}
+
+			batch := make([]models.ComicsInfo, 0, len(comics))
+
+			for _, ci := range comics {
+				if !ci.HasText() {
+					r.l.Debug("skip comics without text", "id", ci.ID)
+
+					continue
+				}
+
+				batch = append(batch, models.IndexComics(ci, r.stemmer))
+			}
+
+			if err := put(ctx, batch); err != nil {
+				return fmt.Errorf("put batch error: %w", err)
+			}
+
+			r.update(func(p *ReindexProgress) {
+				p.Indexed += len(batch)
+				p.Skipped += len(comics) - len(batch)
+			})
+		}
+
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("replace index error: %w", err)
+	}
+
+	return r.saveStemmer(ctx)
+}
+
+func (r ReindexUsecase) update(f func(p *ReindexProgress)) {
+	r.state.mu.Lock()
+	defer r.state.mu.Unlock()
+
+	f(&r.state.status.Progress)
+}
+
+func (r ReindexUsecase) saveStemmer(ctx context.Context) error {
+	if err := r.db.SetIndexMeta(ctx, StemmerMetaKey, r.stemmer.Name()); err != nil {
+		return fmt.Errorf("set index stemmer error: %w", err)
+	}
+
+	if _, _, err := r.db.Flush(ctx, true); err != nil {
+		return fmt.Errorf("flush error: %w", err)
+	}
+
+	return nil
+}
@@ -0,0 +1,222 @@
+package usecase
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	user "github.com/Leopold1975/yadro_app/internal/auth/models"
+	"github.com/Leopold1975/yadro_app/internal/models"
+	"github.com/Leopold1975/yadro_app/pkg/logger"
+)
+
+const (
+	maxFinishedJobs = 32 // сколько завершенных заданий хранится для GET /update/{id}.
+	jobIDLen        = 8
+)
+
+type JobStatus string
+
+const (
+	JobRunning JobStatus = "running"
+	JobDone    JobStatus = "done"
+	JobFailed  JobStatus = "failed"
+)
+
+// UpdateJobsUsecase запускает загрузку комиксов как фоновое задание.
+// Одновременно выполняется не больше одного задания: повторный запуск
+// во время выполнения присоединяется к текущему заданию.
+type UpdateJobsUsecase struct {
+	ctx   context.Context //nolint:containedctx // задания переживают запрос, который их запустил.
+	fetch FetchComicsUsecase
+	audit Auditor
+	l     logger.Logger
+	state *jobsState
+}
+
+// jobsState общий для всех копий UpdateJobsUsecase.
+type jobsState struct {
+	mu       sync.Mutex
+	jobs     map[string]*updateJob
+	finished []string // id завершенных заданий в порядке завершения.
+	current  *updateJob
+}
+
+// UpdateJob — состояние задания. Result заполнен, когда задание завершилось успешно,
+// Error — когда с ошибкой.
+type UpdateJob struct {
+	ID         string
+	Status     JobStatus
+	StartedAt  time.Time
+	FinishedAt time.Time
+	Progress   FetchProgress
+	Result     FetchResponse
+	Error      string
+}
+
+type updateJob struct {
+	id        string
+	startedAt time.Time
+	report    *fetchReport
+	done      chan struct{}
+
+	// Заполняются до закрытия done.
+	finishedAt time.Time
+	result     FetchResponse
+	err        error
+}
+
+// NewUpdateJobs создает менеджер заданий. Задания выполняются в контексте ctx
+// и отменяются вместе с ним. Запуски через Start записываются в журнал audit.
+func NewUpdateJobs(ctx context.Context, fetch FetchComicsUsecase, audit Auditor, l logger.Logger) UpdateJobsUsecase {
+	return UpdateJobsUsecase{
+		ctx:   ctx,
+		fetch: fetch,
+		audit: audit,
+		l:     l,
+		state: &jobsState{
+			mu:       sync.Mutex{},
+			jobs:     make(map[string]*updateJob),
+			finished: make([]string, 0, maxFinishedJobs),
+			current:  nil,
+		},
+	}
+}
+
+// Start запускает задание или возвращает уже выполняющееся.
+// joined равен true, если задание было запущено раньше.
+// ctx — контекст запроса, задание от него не зависит.
+func (u UpdateJobsUsecase) Start(ctx context.Context) (job UpdateJob, joined bool) { //nolint:nonamedreturns
+	j, joined := u.start()
+
+	u.audit.Record(ctx, user.AuditEntry{ //nolint:exhaustruct
+		Action:  user.AuditComicsUpdate,
+		Target:  j.id,
+		Details: "joined=" + strconv.FormatBool(joined),
+	}, nil)
+
+	return j.info(), joined
+}
+
+// Get возвращает состояние задания по id.
+func (u UpdateJobsUsecase) Get(id string) (UpdateJob, error) {
+	u.state.mu.Lock()
+	j, ok := u.state.jobs[id]
+	u.state.mu.Unlock()
+
+	if !ok {
+		return UpdateJob{}, fmt.Errorf("job %s: %w", id, models.ErrNotFound)
+	}
+
+	return j.info(), nil
+}
+
+// Run запускает задание или присоединяется к выполняющемуся и ждет его завершения.
+func (u UpdateJobsUsecase) Run(ctx context.Context) (FetchResponse, error) {
+	j, _ := u.start()
+
+	select {
+	case <-ctx.Done():
+		return FetchResponse{}, fmt.Errorf("wait job %s: %w", j.id, ctx.Err())
+	case <-j.done:
+		return j.result, j.err
+	}
+}
+
+func (u UpdateJobsUsecase) start() (*updateJob, bool) {
+	u.state.mu.Lock()
+	defer u.state.mu.Unlock()
+
+	if u.state.current != nil {
+		return u.state.current, true
+	}
+
+	j := &updateJob{
+		id:         newJobID(),
+		startedAt:  time.Now(),
+		report:     &fetchReport{}, //nolint:exhaustruct
+		done:       make(chan struct{}),
+		finishedAt: time.Time{},
+		result:     FetchResponse{}, //nolint:exhaustruct
+		err:        nil,
+	}
+
+	u.state.jobs[j.id] = j
+	u.state.current = j
+
+	u.l.Info("update job started", "id", j.id)
+
+	go u.run(j)
+
+	return j, false
+}
+
+func (u UpdateJobsUsecase) run(j *updateJob) {
+	result, err := u.fetch.fetchComics(u.ctx, j.report)
+
+	u.state.mu.Lock()
+	defer u.state.mu.Unlock()
+
+	j.result, j.err, j.finishedAt = result, err, time.Now()
+	close(j.done)
+
+	u.state.current = nil
+	u.state.finished = append(u.state.finished, j.id)
+
+	if len(u.state.finished) > maxFinishedJobs {
+		delete(u.state.jobs, u.state.finished[0])
+		u.state.finished = u.state.finished[1:]
+	}
+
+	if err != nil {
+		u.l.Error("update job failed", "id", j.id, "error", err)
+
+		return
+	}
+
+	u.l.Info("update job finished", "id", j.id, "new comics", result.New, "total comics", result.Total,
+		"failed", len(result.Failed), "skipped", len(result.Skipped))
+}
+
+func (j *updateJob) info() UpdateJob {
+	info := UpdateJob{
+		ID:         j.id,
+		Status:     JobRunning,
+		StartedAt:  j.startedAt,
+		FinishedAt: time.Time{},
+		Progress:   j.report.progress(),
+		Result:     FetchResponse{}, //nolint:exhaustruct
+		Error:      "",
+	}
+
+	select {
+	case <-j.done:
+	default:
+		return info
+	}
+
+	info.FinishedAt = j.finishedAt
+
+	if j.err != nil {
+		info.Status = JobFailed
+		info.Error = j.err.Error()
+
+		return info
+	}
+
+	info.Status = JobDone
+	info.Result = j.result
+
+	return info
+}
+
+func newJobID() string {
+	b := make([]byte, jobIDLen)
+	rand.Read(b) //nolint:errcheck // crypto/rand.Read не возвращает ошибок на поддерживаемых платформах.
+
+	return hex.EncodeToString(b)
+}
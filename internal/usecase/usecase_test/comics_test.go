@@ -0,0 +1,750 @@
+package usecase_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	imagepng "image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	user "github.com/Leopold1975/yadro_app/internal/auth/models"
+	"github.com/Leopold1975/yadro_app/internal/database/imagestore"
+	"github.com/Leopold1975/yadro_app/internal/database/memorydb"
+	"github.com/Leopold1975/yadro_app/internal/models"
+	"github.com/Leopold1975/yadro_app/internal/pkg/config"
+	"github.com/Leopold1975/yadro_app/internal/usecase"
+	"github.com/Leopold1975/yadro_app/pkg/logger"
+	"github.com/Leopold1975/yadro_app/pkg/words"
+	"github.com/Leopold1975/yadro_app/pkg/xkcd"
+	"github.com/stretchr/testify/require"
+)
+
+var xkcdComics = map[int]models.XKCDModel{
+	1: {Num: 1, Title: "Barrel", Alt: "Don't we all.", Transcript: "A boy sits in a barrel floating in the ocean.", Img: "https://imgs.xkcd.com/comics/barrel.jpg"},
+	2: {Num: 2, Title: "Petit Trees", Alt: "'Petit' being a reference to Le Petit Prince", Transcript: "Two trees on a tiny planet.", Img: "https://imgs.xkcd.com/comics/tree.jpg"},
+	3: {Num: 3, Title: "Island", Alt: "Hello, island", Transcript: "An island in the ocean.", Img: "https://imgs.xkcd.com/comics/island.jpg", Year: "2006", Month: "1", Day: "1"},
+	4: {Num: 4, Title: "Landscape", Alt: "There's a river flowing through the ocean", Transcript: "A landscape with trees.", Img: "https://imgs.xkcd.com/comics/landscape.jpg"},
+	5: {Num: 5, Title: "Blown apart", Alt: "Blown into prime factors", Transcript: "An apple blown apart.", Img: "https://imgs.xkcd.com/comics/blownapart.jpg"},
+	// Комикса 6 нет, как и комикса 404 на xkcd.
+	7: {Num: 7, Title: "Gap", Alt: "Mind the gap", Transcript: "Nothing to see here.", Img: "https://imgs.xkcd.com/comics/gap.jpg"},
+}
+
+const latestComics = 7
+
+// memAuditor запоминает записи журнала аудита.
+type memAuditor struct {
+	entries []user.AuditEntry
+}
+
+func (m *memAuditor) Record(_ context.Context, e user.AuditEntry, err error) {
+	e.Outcome = user.AuditSuccess
+	if err != nil {
+		e.Outcome = user.AuditFailure
+	}
+
+	m.entries = append(m.entries, e)
+}
+
+// Первый запрос комикса brokenComics завершается ошибкой сервера.
+const brokenComics = 5
+
+// newXKCDServer возвращает сервер с комиксами xkcdComics и счетчик запросов отдельных комиксов.
+func newXKCDServer(t *testing.T) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+
+	requests := &atomic.Int32{}
+	broken := &atomic.Bool{}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /info.0.json", func(w http.ResponseWriter, _ *http.Request) {
+		json.NewEncoder(w).Encode(xkcdComics[latestComics])
+	})
+	mux.HandleFunc("GET /{id}/info.0.json", func(w http.ResponseWriter, r *http.Request) {
+		requests.Add(1)
+
+		id, err := strconv.Atoi(r.PathValue("id"))
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+
+			return
+		}
+
+		if id == brokenComics && !broken.Swap(true) {
+			w.WriteHeader(http.StatusInternalServerError)
+
+			return
+		}
+
+		c, ok := xkcdComics[id]
+		if !ok {
+			w.WriteHeader(http.StatusNotFound)
+
+			return
+		}
+
+		json.NewEncoder(w).Encode(c)
+	})
+
+	s := httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+
+	return s, requests
+}
+
+func TestFetchComics(t *testing.T) {
+	s, requests := newXKCDServer(t)
+	db := memorydb.New()
+	fetch := usecase.NewComicsFetch(xkcd.New(s.URL, config.Client{Timeout: time.Second}), &db, nil, words.Porter2{}, 2,
+		config.Save{BatchSize: 2, FlushInterval: time.Second}, logger.New("info"))
+
+	resp, err := fetch.FetchComics(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, len(xkcdComics)-1, resp.New)
+	require.Equal(t, len(xkcdComics)-1, resp.Total)
+	require.Equal(t, []string{"1", "2", "3", "4", "7"}, resp.Fetched)
+	require.Equal(t, []string{"6"}, resp.Skipped)
+	require.Len(t, resp.Failed, 1)
+	require.Equal(t, "5", resp.Failed[0].ID)
+	require.Contains(t, resp.Failed[0].Reason, "500")
+
+	ci, err := db.GetByID(context.Background(), "3")
+	require.NoError(t, err)
+	require.Equal(t, xkcdComics[3].Img, ci.URL)
+	require.Equal(t, "Island", ci.Title)
+	require.Equal(t, "Hello, island", ci.Alt)
+	require.Equal(t, "2006-01-01", ci.Date)
+	require.Contains(t, ci.Keywords, "island")
+
+	require.Equal(t, int32(latestComics), requests.Load())
+
+	_, err = db.GetByID(context.Background(), "6")
+	require.ErrorIs(t, err, models.ErrNotFound)
+
+	// Повторно запрашиваются только отсутствующие комиксы 5 и 6.
+	resp, err = fetch.FetchComics(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, 1, resp.New)
+	require.Equal(t, len(xkcdComics), resp.Total)
+	require.Equal(t, []string{"5"}, resp.Fetched)
+	require.Equal(t, []string{"6"}, resp.Skipped)
+	require.Empty(t, resp.Failed)
+	require.Equal(t, int32(latestComics+2), requests.Load())
+}
+
+// failingDB не сохраняет пачки и комикс failingID.
+type failingDB struct {
+	*memorydb.ComicsRepo
+}
+
+const failingID = "2"
+
+var errSave = errors.New("save error")
+
+func (db failingDB) AddMany(context.Context, []models.ComicsInfo) error {
+	return errSave
+}
+
+func (db failingDB) AddOne(ctx context.Context, ci models.ComicsInfo) error {
+	if ci.ID == failingID {
+		return errSave
+	}
+
+	return db.ComicsRepo.AddOne(ctx, ci)
+}
+
+func TestFetchComicsBatchFallback(t *testing.T) {
+	s, _ := newXKCDServer(t)
+	mem := memorydb.New()
+	db := failingDB{&mem}
+	fetch := usecase.NewComicsFetch(xkcd.New(s.URL, config.Client{Timeout: time.Second}), db, nil, words.Porter2{}, 2,
+		config.Save{BatchSize: 10, FlushInterval: 0}, logger.New("info"))
+
+	resp, err := fetch.FetchComics(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []string{"1", "3", "4", "7"}, resp.Fetched)
+	require.Len(t, resp.Failed, 2)
+	require.Equal(t, failingID, resp.Failed[0].ID)
+	require.Contains(t, resp.Failed[0].Reason, errSave.Error())
+	require.Equal(t, len(xkcdComics)-2, resp.Total)
+}
+
+func TestFetchComicsImages(t *testing.T) {
+	var png bytes.Buffer
+	require.NoError(t, imagepng.Encode(&png, image.NewRGBA(image.Rect(0, 0, 3, 2))))
+
+	mux := http.NewServeMux()
+	s := httptest.NewServer(mux)
+	t.Cleanup(s.Close)
+
+	// Комиксы 1 и 2 с одинаковой картинкой, у комикса 3 картинки нет.
+	comics := map[string]models.XKCDModel{
+		"1": {Num: 1, Title: "Barrel", Img: s.URL + "/img/comics/barrel.png"},
+		"2": {Num: 2, Title: "Barrel again", Img: s.URL + "/img/comics/barrel_copy.png"},
+		"3": {Num: 3, Title: "Lost", Img: s.URL + "/img/comics/lost.png"},
+	}
+
+	mux.HandleFunc("GET /info.0.json", func(w http.ResponseWriter, _ *http.Request) {
+		json.NewEncoder(w).Encode(comics["3"])
+	})
+	mux.HandleFunc("GET /{id}/info.0.json", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(comics[r.PathValue("id")])
+	})
+	// imagesDown имитирует недоступный сервер картинок.
+	var imagesDown atomic.Bool
+
+	mux.HandleFunc("GET /img/comics/{name}", func(w http.ResponseWriter, r *http.Request) {
+		if imagesDown.Load() {
+			w.WriteHeader(http.StatusInternalServerError)
+
+			return
+		}
+
+		if r.PathValue("name") == "lost.png" {
+			w.WriteHeader(http.StatusNotFound)
+
+			return
+		}
+
+		w.Write(png.Bytes())
+	})
+
+	store, err := imagestore.New(t.TempDir())
+	require.NoError(t, err)
+
+	db := memorydb.New()
+	fetch := usecase.NewComicsFetch(xkcd.New(s.URL, config.Client{Timeout: time.Second}), &db, store, words.Porter2{}, 2,
+		config.Save{BatchSize: 2, FlushInterval: time.Second}, logger.New("info"))
+
+	resp, err := fetch.FetchComics(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []string{"1", "2", "3"}, resp.Fetched)
+
+	first, err := db.GetByID(context.Background(), "1")
+	require.NoError(t, err)
+	require.Equal(t, int64(png.Len()), first.Image.Size)
+	require.Equal(t, 3, first.Image.Width)
+	require.Equal(t, 2, first.Image.Height)
+	require.Equal(t, "image/png", first.Image.ContentType)
+
+	second, err := db.GetByID(context.Background(), "2")
+	require.NoError(t, err)
+	require.Equal(t, first.Image, second.Image)
+
+	images := usecase.NewComicsImage(&db, store)
+
+	img, rc, err := images.GetImage(context.Background(), "2")
+	require.NoError(t, err)
+	require.Equal(t, first.Image, img)
+
+	data, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	require.NoError(t, rc.Close())
+	require.Equal(t, png.Bytes(), data)
+
+	_, _, err = images.GetImage(context.Background(), "3")
+	require.ErrorIs(t, err, models.ErrNotFound)
+
+	_, _, err = usecase.NewComicsImage(&db, nil).GetImage(context.Background(), "1")
+	require.ErrorIs(t, err, models.ErrNotFound)
+
+	// комиксы, загруженные без хранилища картинок, получают их через BackfillImages.
+	noImages := memorydb.New()
+	fetch = usecase.NewComicsFetch(xkcd.New(s.URL, config.Client{Timeout: time.Second}), &noImages, nil, words.Porter2{}, 2,
+		config.Save{BatchSize: 2, FlushInterval: time.Second}, logger.New("info"))
+
+	_, err = fetch.FetchComics(context.Background())
+	require.NoError(t, err)
+
+	_, err = fetch.BackfillImages(context.Background())
+	require.ErrorIs(t, err, usecase.ErrImagesDisabled)
+
+	fetch = usecase.NewComicsFetch(xkcd.New(s.URL, config.Client{Timeout: time.Second}), &noImages, store, words.Porter2{}, 2,
+		config.Save{BatchSize: 2, FlushInterval: time.Second}, logger.New("info"))
+
+	resp, err = fetch.BackfillImages(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []string{"1", "2"}, resp.Fetched)
+	require.Equal(t, []string{"3"}, resp.Skipped)
+	require.Empty(t, resp.Failed)
+	require.Equal(t, 3, resp.Total)
+
+	backfilled, err := noImages.GetByID(context.Background(), "1")
+	require.NoError(t, err)
+	require.Equal(t, first.Image, backfilled.Image)
+	require.Equal(t, first.Keywords, backfilled.Keywords)
+
+	// ошибка скачивания картинки не мешает сохранить комикс: он попадает в поиск
+	// без картинки, а ее потом докачивает BackfillImages.
+	imagesDown.Store(true)
+
+	flaky := memorydb.New()
+	fetch = usecase.NewComicsFetch(xkcd.New(s.URL, config.Client{Timeout: time.Second}), &flaky, store, words.Porter2{}, 2,
+		config.Save{BatchSize: 2, FlushInterval: time.Second}, logger.New("info"))
+
+	resp, err = fetch.FetchComics(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []string{"1", "2", "3"}, resp.Fetched)
+	require.Empty(t, resp.Failed)
+
+	saved, err := flaky.GetByID(context.Background(), "1")
+	require.NoError(t, err)
+	require.Empty(t, saved.Image.Hash)
+	require.Equal(t, first.Keywords, saved.Keywords)
+
+	imagesDown.Store(false)
+
+	resp, err = fetch.BackfillImages(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, []string{"1", "2"}, resp.Fetched)
+
+	saved, err = flaky.GetByID(context.Background(), "1")
+	require.NoError(t, err)
+	require.Equal(t, first.Image, saved.Image)
+}
+
+func TestUpdateJobs(t *testing.T) {
+	s, _ := newXKCDServer(t)
+
+	// Задание ждет release перед первым запросом к xkcd, чтобы второй запуск застал его выполняющимся.
+	release := make(chan struct{})
+	gate := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-release
+		http.Redirect(w, r, s.URL+r.URL.Path, http.StatusTemporaryRedirect)
+	}))
+	t.Cleanup(gate.Close)
+
+	db := memorydb.New()
+	fetch := usecase.NewComicsFetch(xkcd.New(gate.URL, config.Client{Timeout: time.Second}), &db, nil, words.Porter2{}, 2,
+		config.Save{BatchSize: 2, FlushInterval: time.Second}, logger.New("info"))
+	audit := &memAuditor{entries: nil}
+	jobs := usecase.NewUpdateJobs(context.Background(), fetch, audit, logger.New("info"))
+
+	first, joined := jobs.Start(context.Background())
+	require.False(t, joined)
+	require.Equal(t, usecase.JobRunning, first.Status)
+
+	second, joined := jobs.Start(context.Background())
+	require.True(t, joined)
+	require.Equal(t, first.ID, second.ID)
+
+	close(release)
+
+	resp, err := jobs.Run(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, len(xkcdComics)-1, resp.Total)
+
+	job, err := jobs.Get(first.ID)
+	require.NoError(t, err)
+	require.Equal(t, usecase.JobDone, job.Status)
+	require.Equal(t, usecase.FetchProgress{Total: latestComics, Fetched: 5, Failed: 1, Skipped: 1}, job.Progress)
+	require.Equal(t, []string{"6"}, job.Result.Skipped)
+
+	// Предыдущее задание завершено, поэтому запускается новое.
+	third, joined := jobs.Start(context.Background())
+	require.False(t, joined)
+	require.NotEqual(t, first.ID, third.ID)
+
+	// запуски записываются в журнал, фоновые обновления через Run — нет.
+	require.Len(t, audit.entries, 3)
+	require.Equal(t, user.AuditComicsUpdate, audit.entries[0].Action)
+	require.Equal(t, first.ID, audit.entries[0].Target)
+	require.Equal(t, "joined=true", audit.entries[1].Details)
+
+	_, err = jobs.Get("unknown")
+	require.ErrorIs(t, err, models.ErrNotFound)
+}
+
+func TestBackgroundRefresh(t *testing.T) {
+	s, _ := newXKCDServer(t)
+
+	// Первый запрос номера последнего комикса завершается ошибкой, обновление повторяется.
+	failed := &atomic.Bool{}
+	flaky := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !failed.Swap(true) {
+			w.WriteHeader(http.StatusInternalServerError)
+
+			return
+		}
+
+		http.Redirect(w, r, s.URL+r.URL.Path, http.StatusTemporaryRedirect)
+	}))
+	t.Cleanup(flaky.Close)
+
+	db := memorydb.New()
+	fetch := usecase.NewComicsFetch(xkcd.New(flaky.URL, config.Client{Timeout: time.Second}), &db, nil, words.Porter2{}, 2,
+		config.Save{BatchSize: 2, FlushInterval: time.Second}, logger.New("info"))
+	jobs := usecase.NewUpdateJobs(context.Background(), fetch, &memAuditor{entries: nil}, logger.New("info"))
+
+	_, err := usecase.NewBackgroundRefresh(jobs, config.Refresh{Schedule: "* * *"}, time.Time{}) //nolint:exhaustruct
+	require.Error(t, err)
+
+	// расписание считается с точностью до минуты, секунды refreshTime не отбрасываются молча.
+	msk := time.FixedZone("MSK", 3*60*60)
+
+	_, err = usecase.NewBackgroundRefresh(jobs, config.Refresh{}, time.Date(0, 1, 1, 23, 16, 30, 0, msk)) //nolint:exhaustruct
+	require.ErrorIs(t, err, usecase.ErrRefreshTimeSeconds)
+
+	daily, err := usecase.NewBackgroundRefresh(jobs, config.Refresh{}, time.Date(0, 1, 1, 23, 16, 0, 0, msk)) //nolint:exhaustruct
+	require.NoError(t, err)
+
+	// refreshTime с фиксированным смещением переводится в местное время сервера.
+	now := time.Now()
+	local := time.Date(now.Year(), now.Month(), now.Day(), 23, 16, 0, 0, msk).In(time.Local)
+	require.Equal(t, fmt.Sprintf("%d %d * * *", local.Minute(), local.Hour()), daily.Status().Schedule)
+
+	refresh, err := usecase.NewBackgroundRefresh(jobs, config.Refresh{
+		Schedule:   "@every 1h",
+		RunOnStart: true,
+		MaxRetries: 1,
+		RetryMin:   10 * time.Millisecond,
+		RetryMax:   time.Second,
+	}, time.Time{})
+	require.NoError(t, err)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	go refresh.Refresh(ctx, logger.New("info"))
+
+	require.Eventually(t, func() bool { return !refresh.Status().LastSuccess.IsZero() }, 5*time.Second, 10*time.Millisecond)
+
+	status := refresh.Status()
+	require.Equal(t, "@every 1h", status.Schedule)
+	require.Empty(t, status.LastError)
+
+	require.Eventually(t, func() bool { return !refresh.Status().NextRun.IsZero() }, 5*time.Second, 10*time.Millisecond)
+	require.WithinDuration(t, time.Now().Add(time.Hour), refresh.Status().NextRun, time.Minute)
+
+	stats, err := db.GetStats(context.Background())
+	require.NoError(t, err)
+	require.Equal(t, len(xkcdComics)-1, stats.Total)
+}
+
+func TestFindComics(t *testing.T) {
+	db := memorydb.New()
+
+	for _, c := range xkcdComics {
+		ci, err := models.ToDBComicsInfo(c, words.Porter2{})
+		require.NoError(t, err)
+		require.NoError(t, db.AddOne(context.Background(), ci))
+	}
+
+	find := usecase.NewComicsFind(&db, config.Search{DefaultLimit: 10, MaxLimit: 3}, words.Porter2{}, logger.New("info"))
+
+	tests := []struct {
+		name     string
+		phrase   string
+		page     models.Page
+		expected []string
+		total    int
+	}{
+		{
+			name:     "single word",
+			phrase:   "islands",
+			expected: []string{"3"},
+			total:    1,
+		},
+		{
+			name:     "several words limited by max limit",
+			phrase:   "trees in the ocean",
+			expected: []string{"4", "2", "3"},
+			total:    4,
+		},
+		{
+			name:     "second page",
+			phrase:   "trees in the ocean",
+			page:     models.Page{Limit: 2, Offset: 2},
+			expected: []string{"3", "1"},
+			total:    4,
+		},
+		{
+			name:     "offset out of range",
+			phrase:   "trees in the ocean",
+			page:     models.Page{Limit: 2, Offset: 10},
+			expected: []string{},
+			total:    4,
+		},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			res, err := find.GetComics(context.Background(), tc.phrase, tc.page)
+			require.NoError(t, err)
+			require.Equal(t, tc.total, res.Total)
+
+			ids := make([]string, 0, len(res.Comics))
+			for _, c := range res.Comics {
+				ids = append(ids, c.ID)
+			}
+
+			require.Equal(t, tc.expected, ids)
+		})
+	}
+
+	_, err := find.GetComics(context.Background(), "nonexistentword", models.Page{})
+	require.ErrorIs(t, err, models.ErrNotFound)
+
+	_, err = db.GetByID(context.Background(), "42")
+	require.ErrorIs(t, err, models.ErrNotFound)
+}
+
+func TestFindComicsQuerySyntax(t *testing.T) {
+	db := memorydb.New()
+
+	for _, c := range xkcdComics {
+		ci, err := models.ToDBComicsInfo(c, words.Porter2{})
+		require.NoError(t, err)
+		require.NoError(t, db.AddOne(context.Background(), ci))
+	}
+
+	find := usecase.NewComicsFind(&db, config.Search{DefaultLimit: 10, MaxLimit: 10}, words.Porter2{}, logger.New("info"))
+
+	tests := []struct {
+		name     string
+		query    string
+		expected []string
+	}{
+		{name: "phrase", query: `"barrel floating"`, expected: []string{"1"}},
+		{name: "phrase with stop words", query: `"floating in the ocean"`, expected: []string{"1"}},
+		{name: "phrase in wrong order", query: `"floating barrel"`, expected: nil},
+		{name: "exclusion", query: "ocean -island", expected: []string{"1", "4"}},
+		{name: "and", query: "ocean AND trees", expected: []string{"4"}},
+		{name: "or", query: "island OR apple", expected: []string{"3", "5"}},
+		{name: "field", query: "title:landscape", expected: []string{"4"}},
+		{name: "field without match", query: "title:ocean", expected: nil},
+		{name: "field phrase", query: `transcript:"tiny planet"`, expected: []string{"2"}},
+		{name: "groups", query: "(island OR apple) -ocean", expected: []string{"5"}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			res, err := find.GetComics(context.Background(), tc.query, models.Page{})
+			if tc.expected == nil {
+				require.ErrorIs(t, err, models.ErrNotFound)
+
+				return
+			}
+
+			require.NoError(t, err)
+
+			ids := make([]string, 0, len(res.Comics))
+			for _, c := range res.Comics {
+				ids = append(ids, c.ID)
+			}
+
+			require.ElementsMatch(t, tc.expected, ids)
+		})
+	}
+
+	for _, q := range []string{`"unclosed`, "(ocean", "ocean)", "ocean AND", "-"} {
+		_, err := find.GetComics(context.Background(), q, models.Page{})
+		require.ErrorIs(t, err, usecase.ErrInvalidQuery, q)
+	}
+}
+
+func TestFindComicsTypos(t *testing.T) {
+	db := memorydb.New()
+
+	for _, c := range xkcdComics {
+		ci, err := models.ToDBComicsInfo(c, words.Porter2{})
+		require.NoError(t, err)
+		require.NoError(t, db.AddOne(context.Background(), ci))
+	}
+
+	find := usecase.NewComicsFind(&db, config.Search{DefaultLimit: 10, MaxLimit: 10}, words.Porter2{}, logger.New("info"))
+
+	res, err := find.GetComics(context.Background(), "islnd", models.Page{})
+	require.NoError(t, err)
+	require.Equal(t, "island", res.DidYouMean)
+	require.Len(t, res.Comics, 1)
+	require.Equal(t, "3", res.Comics[0].ID)
+
+	res, err = find.GetComics(context.Background(), "island", models.Page{})
+	require.NoError(t, err)
+	require.Empty(t, res.DidYouMean)
+
+	// исправленное слово возвращается в исходной форме, а не основой "landscap".
+	res, err = find.GetComics(context.Background(), "ocean landscpe", models.Page{})
+	require.NoError(t, err)
+	require.Equal(t, "ocean landscape", res.DidYouMean)
+
+	// заменяется само исправленное слово, а не его первое вхождение в запрос.
+	res, err = find.GetComics(context.Background(), "islands islan", models.Page{})
+	require.NoError(t, err)
+	require.Equal(t, "islands island", res.DidYouMean)
+
+	res, err = find.GetComics(context.Background(), "landscpes title:landscpe", models.Page{})
+	require.NoError(t, err)
+	require.Equal(t, "landscape title:landscape", res.DidYouMean)
+
+	_, err = find.GetComics(context.Background(), "qwertyuiop", models.Page{})
+	require.ErrorIs(t, err, models.ErrNotFound)
+
+	suggestions, err := find.Suggest(context.Background(), "Bl", 10)
+	require.NoError(t, err)
+	require.Equal(t, []models.Keyword{{Word: "blown", DocFreq: 1}}, suggestions)
+
+	suggestions, err = find.Suggest(context.Background(), "trees", 10)
+	require.NoError(t, err)
+	require.Equal(t, []models.Keyword{{Word: "tree", DocFreq: 2}}, suggestions)
+}
+
+func TestEnsureStemmer(t *testing.T) {
+	db := memorydb.New()
+	ctx := context.Background()
+
+	for _, c := range xkcdComics {
+		ci, err := models.ToDBComicsInfo(c, words.Porter2{})
+		require.NoError(t, err)
+		require.NoError(t, db.AddOne(ctx, ci))
+	}
+
+	// Индекс без записанного стеммера построен porter2, перестраивать его не нужно.
+	require.NoError(t, usecase.NewReindex(ctx, &db, words.Porter2{}, &memAuditor{entries: nil}, logger.New("info")).EnsureStemmer(ctx))
+
+	name, err := db.GetIndexMeta(ctx, usecase.StemmerMetaKey)
+	require.NoError(t, err)
+	require.Equal(t, "porter2", name)
+
+	noop, err := words.NewStemmer(words.NoopStemmer, "english")
+	require.NoError(t, err)
+
+	require.NoError(t, usecase.NewReindex(ctx, &db, noop, &memAuditor{entries: nil}, logger.New("info")).EnsureStemmer(ctx))
+
+	name, err = db.GetIndexMeta(ctx, usecase.StemmerMetaKey)
+	require.NoError(t, err)
+	require.Equal(t, "noop:english", name)
+
+	ci, err := db.GetByID(ctx, "2")
+	require.NoError(t, err)
+	require.Contains(t, ci.Keywords, "trees")
+	require.NotContains(t, ci.Keywords, "tree")
+}
+
+func TestReindex(t *testing.T) {
+	db := memorydb.New()
+	ctx := context.Background()
+
+	for _, c := range xkcdComics {
+		ci, err := models.ToDBComicsInfo(c, words.Porter2{})
+		require.NoError(t, err)
+		require.NoError(t, db.AddOne(ctx, ci))
+	}
+
+	// Комикс, сохраненный до появления метаданных: текста нет, только ключевые слова.
+	require.NoError(t, db.AddOne(ctx, models.ComicsInfo{ID: "8", Keywords: []string{"old"}})) //nolint:exhaustruct
+
+	noop, err := words.NewStemmer(words.NoopStemmer, "english")
+	require.NoError(t, err)
+
+	reindex := usecase.NewReindex(ctx, &db, noop, &memAuditor{entries: nil}, logger.New("info"))
+
+	progress, err := reindex.Run(ctx)
+	require.NoError(t, err)
+	require.Equal(t, usecase.ReindexProgress{Total: len(xkcdComics) + 1, Indexed: len(xkcdComics), Skipped: 1}, progress)
+
+	status := reindex.Status()
+	require.False(t, status.Running)
+	require.Equal(t, "noop:english", status.Stemmer)
+	require.Empty(t, status.Error)
+	require.False(t, status.FinishedAt.IsZero())
+
+	find := usecase.NewComicsFind(&db, config.Search{DefaultLimit: 10, MaxLimit: 10}, noop, logger.New("info"))
+
+	res, err := find.GetComics(ctx, `"two trees"`, models.Page{})
+	require.NoError(t, err)
+	require.Equal(t, "2", res.Comics[0].ID)
+
+	res, err = find.GetComics(ctx, "old", models.Page{})
+	require.NoError(t, err)
+	require.Equal(t, "8", res.Comics[0].ID)
+
+	// При ошибке построения старый индекс остается.
+	err = db.ReplaceIndex(ctx, func(put models.PutIndexFunc) error {
+		require.NoError(t, put(ctx, []models.ComicsInfo{{ID: "2", Keywords: []string{"broken"}}})) //nolint:exhaustruct
+
+		return models.ErrNotFound
+	})
+	require.ErrorIs(t, err, models.ErrNotFound)
+
+	ci, err := db.GetByID(ctx, "2")
+	require.NoError(t, err)
+	require.Contains(t, ci.Keywords, "trees")
+}
+
+func TestIndexCheckUnsupported(t *testing.T) {
+	db := memorydb.New()
+
+	audit := &memAuditor{entries: nil}
+
+	_, err := usecase.NewIndexCheck(&db, audit).Check(context.Background())
+	require.ErrorIs(t, err, usecase.ErrIndexCheckUnsupported)
+
+	_, err = usecase.NewIndexCheck(&db, audit).Repair(context.Background())
+	require.ErrorIs(t, err, usecase.ErrIndexCheckUnsupported)
+	require.Len(t, audit.entries, 1)
+	require.Equal(t, user.AuditFailure, audit.entries[0].Outcome)
+}
+
+// fullTextDB вместо полнотекстового поиска Postgres возвращает заданные оценки.
+type fullTextDB struct {
+	*memorydb.ComicsRepo
+	scores map[string]float64
+}
+
+func (db fullTextDB) SearchFullText(context.Context, string) (map[string]float64, error) {
+	return db.scores, nil
+}
+
+func TestFindComicsFullText(t *testing.T) {
+	mem := memorydb.New()
+	ctx := context.Background()
+
+	for _, c := range xkcdComics {
+		ci, err := models.ToDBComicsInfo(c, words.Porter2{})
+		require.NoError(t, err)
+		require.NoError(t, mem.AddOne(ctx, ci))
+	}
+
+	cfg := config.Search{DefaultLimit: 10, MaxLimit: 10, Strategy: string(models.IndexFullText)}
+
+	db := fullTextDB{ComicsRepo: &mem, scores: map[string]float64{"4": 0.1, "3": 0.5, "1": 0.1}}
+	find := usecase.NewComicsFind(db, cfg, words.Porter2{}, logger.New("info"))
+
+	res, err := find.GetComics(ctx, "ocean", models.Page{})
+	require.NoError(t, err)
+	require.Equal(t, 3, res.Total)
+	require.Equal(t, []string{"3", "1", "4"}, []string{res.Comics[0].ID, res.Comics[1].ID, res.Comics[2].ID})
+
+	// Стратегия из контекста запроса важнее стратегии из конфигурации.
+	res, err = find.GetComics(models.WithIndexStrategy(ctx, models.IndexJSONB), "islands", models.Page{})
+	require.NoError(t, err)
+	require.Equal(t, "3", res.Comics[0].ID)
+
+	_, err = usecase.NewComicsFind(&mem, cfg, words.Porter2{}, logger.New("info")).GetComics(ctx, "ocean", models.Page{})
+	require.ErrorIs(t, err, usecase.ErrFullTextUnsupported)
+}
+
+func TestSupportsStrategy(t *testing.T) {
+	mem := memorydb.New()
+	cfg := config.Search{DefaultLimit: 10, MaxLimit: 10, Strategy: string(models.IndexJSONB)}
+
+	// memorydb хранит индекс в одном представлении и не различает стратегии.
+	find := usecase.NewComicsFind(&mem, cfg, words.Porter2{}, logger.New("info"))
+	require.False(t, find.SupportsStrategy(models.IndexJSONB))
+	require.False(t, find.SupportsStrategy(models.IndexTable))
+	require.False(t, find.SupportsStrategy(models.IndexFullText))
+
+	find = usecase.NewComicsFind(fullTextDB{ComicsRepo: &mem, scores: nil}, cfg, words.Porter2{}, logger.New("info"))
+	require.False(t, find.SupportsStrategy(models.IndexTable))
+	require.True(t, find.SupportsStrategy(models.IndexFullText))
+}
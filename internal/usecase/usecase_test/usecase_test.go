@@ -3,53 +3,44 @@ package usecase_test
 import (
 	"testing"
 
+	"github.com/Leopold1975/yadro_app/internal/models"
 	"github.com/Leopold1975/yadro_app/internal/usecase"
 	"github.com/stretchr/testify/require"
 )
 
-func TestGetTopIDs(t *testing.T) {
-	tests := []struct {
-		name     string
-		results  [][]string
-		expected []string
-	}{
-		{
-			name:     "same strings",
-			results:  [][]string{{"1", "2"}, {"2", "1"}, {"1", "3"}},
-			expected: []string{"1", "2", "3"},
-		},
-		{
-			name:     "different strings",
-			results:  [][]string{{"1"}, {"2"}, {"3"}},
-			expected: []string{"1", "2", "3"},
-		},
-		{
-			name:     "with unique and repeated",
-			results:  [][]string{{"1", "2", "2", "3"}, {"2"}, {"3", "3", "1"}},
-			expected: []string{"2", "3", "1"},
-		},
-		{
-			name: "1 to 10 are most frequest",
-			results: [][]string{
-				{"1", "11", "12", "13", "14", "15", "16", "17", "18", "19"},
-				{"1", "2", "21", "22", "23", "24", "25", "26", "27", "28"},
-				{"1", "2", "3", "31", "32", "33", "34", "35", "36", "37"},
-				{"1", "2", "3", "4", "41", "42", "43", "44", "45", "46"},
-				{"1", "2", "3", "4", "5", "51", "52", "53", "54", "55"},
-				{"1", "2", "3", "4", "5", "6", "61", "62", "63", "64"},
-				{"1", "2", "3", "4", "5", "6", "7", "71", "72", "73"},
-				{"1", "2", "3", "4", "5", "6", "7", "8", "81", "82"},
-				{"1", "2", "3", "4", "5", "6", "7", "8", "9", "91"},
-				{"1", "2", "3", "4", "5", "6", "7", "8", "9", "10", "10"},
-			},
-			expected: []string{"1", "2", "3", "4", "5", "6", "7", "8", "9", "10"},
-		},
+func TestRankBM25(t *testing.T) {
+	stats := models.IndexStats{Total: 10, AvgLength: 10}
+
+	common := []models.Posting{
+		{ID: "1", TermFreq: 1, Length: 10},
+		{ID: "2", TermFreq: 1, Length: 10},
+		{ID: "3", TermFreq: 1, Length: 10},
+		{ID: "4", TermFreq: 1, Length: 10},
+		{ID: "5", TermFreq: 1, Length: 10},
+		{ID: "6", TermFreq: 3, Length: 10},
+	}
+	rare := []models.Posting{
+		{ID: "7", TermFreq: 1, Length: 10},
 	}
 
-	for _, tc := range tests {
-		t.Run(tc.name, func(t *testing.T) {
-			got := usecase.GetTopIDs(tc.results...)
-			require.ElementsMatch(t, got, tc.expected, "getTopIDs() = %v, want %v", got, tc.expected)
-		})
+	got := usecase.RankBM25(stats, common, rare)
+	require.Len(t, got, 7)
+
+	ids := make([]string, 0, len(got))
+	for _, r := range got {
+		ids = append(ids, r.ID)
 	}
+
+	// Редкое слово весит больше частого, частота слова повышает вес,
+	// равные по весу комиксы упорядочены по id.
+	require.Equal(t, []string{"7", "6", "1", "2", "3", "4", "5"}, ids)
+
+	shorter := []models.Posting{
+		{ID: "2", TermFreq: 1, Length: 20},
+		{ID: "1", TermFreq: 1, Length: 5},
+	}
+
+	got = usecase.RankBM25(stats, shorter)
+	require.Equal(t, "1", got[0].ID)
+	require.Greater(t, got[0].Score, got[1].Score)
 }
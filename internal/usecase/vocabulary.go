@@ -0,0 +1,132 @@
+package usecase
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+	"unicode/utf8"
+
+	"github.com/Leopold1975/yadro_app/internal/models"
+	"github.com/Leopold1975/yadro_app/pkg/words"
+)
+
+const (
+	minCorrectedLen = 3 // более короткие слова не исправляются.
+	shortWordLen    = 4 // для слов не длиннее допускается одна опечатка, для остальных — две.
+)
+
+// vocabulary кэширует словарь индекса для исправления опечаток и автодополнения.
+// Словарь перечитывается из хранилища не чаще одного раза за ttl.
+type vocabulary struct {
+	db       Storage
+	ttl      time.Duration
+	mu       sync.Mutex
+	keywords []models.Keyword // отсортированы по Word.
+	loadedAt time.Time
+}
+
+func newVocabulary(db Storage, ttl time.Duration) *vocabulary {
+	return &vocabulary{
+		db:       db,
+		ttl:      ttl,
+		mu:       sync.Mutex{},
+		keywords: nil,
+		loadedAt: time.Time{},
+	}
+}
+
+func (v *vocabulary) get(ctx context.Context) ([]models.Keyword, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	if v.keywords != nil && time.Since(v.loadedAt) < v.ttl {
+		return v.keywords, nil
+	}
+
+	keywords, err := v.db.GetVocabulary(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("get vocabulary error: %w", err)
+	}
+
+	sort.Slice(keywords, func(i, j int) bool { return keywords[i].Word < keywords[j].Word })
+
+	v.keywords = keywords
+	v.loadedAt = time.Now()
+
+	return keywords, nil
+}
+
+// closest возвращает ближайшее по расстоянию Левенштейна слово словаря.
+// Из равноудаленных выбирается встречающееся в большем числе комиксов.
+func (v *vocabulary) closest(ctx context.Context, word string) (string, bool, error) {
+	wordLen := utf8.RuneCountInString(word)
+	if wordLen < minCorrectedLen {
+		return "", false, nil
+	}
+
+	keywords, err := v.get(ctx)
+	if err != nil {
+		return "", false, err
+	}
+
+	maxDist := 2
+	if wordLen <= shortWordLen {
+		maxDist = 1
+	}
+
+	var best models.Keyword
+
+	bestDist := maxDist + 1
+
+	for _, k := range keywords {
+		if abs(utf8.RuneCountInString(k.Word)-wordLen) > maxDist {
+			continue
+		}
+
+		d := words.Levenshtein(word, k.Word)
+		if d < bestDist || (d == bestDist && k.DocFreq > best.DocFreq) {
+			best, bestDist = k, d
+		}
+	}
+
+	if bestDist > maxDist || bestDist == 0 {
+		return "", false, nil
+	}
+
+	return best.Word, true, nil
+}
+
+// withPrefix возвращает не более limit слов словаря, начинающихся с prefix,
+// в порядке убывания количества комиксов.
+func (v *vocabulary) withPrefix(ctx context.Context, prefix string, limit int) ([]models.Keyword, error) {
+	keywords, err := v.get(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	result := make([]models.Keyword, 0, limit)
+
+	i := sort.Search(len(keywords), func(i int) bool { return keywords[i].Word >= prefix })
+	for ; i < len(keywords) && strings.HasPrefix(keywords[i].Word, prefix); i++ {
+		result = append(result, keywords[i])
+	}
+
+	sort.SliceStable(result, func(i, j int) bool { return result[i].DocFreq > result[j].DocFreq })
+
+	if len(result) > limit {
+		result = result[:limit]
+	}
+
+	return result, nil
+}
+
+func abs(x int) int {
+	if x < 0 {
+		return -x
+	}
+
+	return x
+}
@@ -0,0 +1,4 @@
+ALTER TABLE keyword_comics_map DROP COLUMN IF EXISTS tf;
+
+ALTER TABLE comics DROP COLUMN IF EXISTS length;
+ALTER TABLE comics DROP COLUMN IF EXISTS terms;
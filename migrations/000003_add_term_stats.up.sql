@@ -0,0 +1,4 @@
+ALTER TABLE comics ADD COLUMN IF NOT EXISTS terms JSONB;
+ALTER TABLE comics ADD COLUMN IF NOT EXISTS length INT;
+
+ALTER TABLE keyword_comics_map ADD COLUMN IF NOT EXISTS tf INT NOT NULL DEFAULT 1;
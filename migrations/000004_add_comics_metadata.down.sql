@@ -0,0 +1,7 @@
+ALTER TABLE comics DROP COLUMN IF EXISTS published;
+ALTER TABLE comics DROP COLUMN IF EXISTS news;
+ALTER TABLE comics DROP COLUMN IF EXISTS link;
+ALTER TABLE comics DROP COLUMN IF EXISTS transcript;
+ALTER TABLE comics DROP COLUMN IF EXISTS alt;
+ALTER TABLE comics DROP COLUMN IF EXISTS safe_title;
+ALTER TABLE comics DROP COLUMN IF EXISTS title;
@@ -0,0 +1,7 @@
+ALTER TABLE comics ADD COLUMN IF NOT EXISTS title TEXT NOT NULL DEFAULT '';
+ALTER TABLE comics ADD COLUMN IF NOT EXISTS safe_title TEXT NOT NULL DEFAULT '';
+ALTER TABLE comics ADD COLUMN IF NOT EXISTS alt TEXT NOT NULL DEFAULT '';
+ALTER TABLE comics ADD COLUMN IF NOT EXISTS transcript TEXT NOT NULL DEFAULT '';
+ALTER TABLE comics ADD COLUMN IF NOT EXISTS link TEXT NOT NULL DEFAULT '';
+ALTER TABLE comics ADD COLUMN IF NOT EXISTS news TEXT NOT NULL DEFAULT '';
+ALTER TABLE comics ADD COLUMN IF NOT EXISTS published DATE;
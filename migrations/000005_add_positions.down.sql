@@ -0,0 +1,3 @@
+ALTER TABLE keyword_comics_map DROP COLUMN IF EXISTS positions;
+
+ALTER TABLE comics DROP COLUMN IF EXISTS positions;
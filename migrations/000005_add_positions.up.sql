@@ -0,0 +1,3 @@
+ALTER TABLE comics ADD COLUMN IF NOT EXISTS positions JSONB;
+
+ALTER TABLE keyword_comics_map ADD COLUMN IF NOT EXISTS positions JSONB;
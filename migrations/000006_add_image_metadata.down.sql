@@ -0,0 +1,5 @@
+ALTER TABLE comics DROP COLUMN IF EXISTS image_type;
+ALTER TABLE comics DROP COLUMN IF EXISTS image_height;
+ALTER TABLE comics DROP COLUMN IF EXISTS image_width;
+ALTER TABLE comics DROP COLUMN IF EXISTS image_size;
+ALTER TABLE comics DROP COLUMN IF EXISTS image_hash;
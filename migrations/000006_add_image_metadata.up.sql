@@ -0,0 +1,5 @@
+ALTER TABLE comics ADD COLUMN IF NOT EXISTS image_hash TEXT NOT NULL DEFAULT '';
+ALTER TABLE comics ADD COLUMN IF NOT EXISTS image_size BIGINT NOT NULL DEFAULT 0;
+ALTER TABLE comics ADD COLUMN IF NOT EXISTS image_width INT NOT NULL DEFAULT 0;
+ALTER TABLE comics ADD COLUMN IF NOT EXISTS image_height INT NOT NULL DEFAULT 0;
+ALTER TABLE comics ADD COLUMN IF NOT EXISTS image_type TEXT NOT NULL DEFAULT '';
@@ -0,0 +1,7 @@
+ALTER TABLE comics ADD COLUMN IF NOT EXISTS tsv tsvector GENERATED ALWAYS AS (
+    setweight(to_tsvector('english', title), 'A') ||
+    setweight(to_tsvector('english', alt), 'B') ||
+    setweight(to_tsvector('english', transcript), 'C')
+) STORED;
+
+CREATE INDEX IF NOT EXISTS comics_tsv_idx ON comics USING GIN (tsv);
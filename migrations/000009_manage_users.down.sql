@@ -0,0 +1,9 @@
+INSERT INTO users(username, passwordHash, role) 
+VALUES 
+('admin', '$2a$10$VZuEWfPuLvZZaG1tU9HJT.YFbLzCcnFVMzyxAR28Rfma9.8CbXgay', 'admin'),
+('user1', '$2a$10$D73FEMgwSFQSX2z3WsmLfu1oKGPYQWXpRHZLGpYNU7o5qKASRIz/u', 'user'),
+('user2', '$2a$10$M6eSIfnQ0M3vJPfOuIIvIu.ulqclNrDsMeBmnIaeH7szEDkYQTMnG', 'user')
+ON CONFLICT(username) DO NOTHING;
+
+ALTER TABLE users DROP COLUMN IF EXISTS created_at;
+ALTER TABLE users DROP COLUMN IF EXISTS disabled;
@@ -0,0 +1,10 @@
+ALTER TABLE users ADD COLUMN IF NOT EXISTS disabled BOOLEAN NOT NULL DEFAULT false;
+ALTER TABLE users ADD COLUMN IF NOT EXISTS created_at TIMESTAMPTZ NOT NULL DEFAULT now();
+
+-- Пользователи из 000002 с паролями, опубликованными в репозитории, удаляются,
+-- если пароль не меняли. Первый администратор создается командой bootstrap-admin.
+DELETE FROM users WHERE (username, passwordHash) IN (
+    ('admin', '$2a$10$VZuEWfPuLvZZaG1tU9HJT.YFbLzCcnFVMzyxAR28Rfma9.8CbXgay'),
+    ('user1', '$2a$10$D73FEMgwSFQSX2z3WsmLfu1oKGPYQWXpRHZLGpYNU7o5qKASRIz/u'),
+    ('user2', '$2a$10$M6eSIfnQ0M3vJPfOuIIvIu.ulqclNrDsMeBmnIaeH7szEDkYQTMnG')
+);
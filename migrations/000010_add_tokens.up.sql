@@ -0,0 +1,20 @@
+-- Refresh-токены хранятся только в виде SHA-256 хэша. family объединяет цепочку
+-- токенов, полученных ротацией из одного входа: повторное использование уже
+-- замененного токена отзывает всю цепочку.
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    token_hash TEXT PRIMARY KEY,
+    username VARCHAR(32) NOT NULL REFERENCES users(username) ON DELETE CASCADE ON UPDATE CASCADE,
+    family TEXT NOT NULL,
+    expires_at TIMESTAMPTZ NOT NULL,
+    revoked_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS refresh_tokens_family_idx ON refresh_tokens(family);
+CREATE INDEX IF NOT EXISTS refresh_tokens_username_idx ON refresh_tokens(username);
+
+-- Отозванные access-токены (jti). Строки нужны только до истечения токена.
+CREATE TABLE IF NOT EXISTS revoked_tokens (
+    jti TEXT PRIMARY KEY,
+    expires_at TIMESTAMPTZ NOT NULL
+);
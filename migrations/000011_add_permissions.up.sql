@@ -0,0 +1,36 @@
+CREATE TABLE IF NOT EXISTS roles (
+    name VARCHAR(32) PRIMARY KEY
+);
+
+CREATE TABLE IF NOT EXISTS permissions (
+    name VARCHAR(64) PRIMARY KEY,
+    description TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE IF NOT EXISTS role_permissions (
+    role VARCHAR(32) NOT NULL REFERENCES roles(name) ON DELETE CASCADE ON UPDATE CASCADE,
+    permission VARCHAR(64) NOT NULL REFERENCES permissions(name) ON DELETE CASCADE ON UPDATE CASCADE,
+    PRIMARY KEY (role, permission)
+);
+
+INSERT INTO roles(name) VALUES ('user'), ('admin') ON CONFLICT DO NOTHING;
+
+-- Роли, уже назначенные пользователям, сохраняются, но без разрешений.
+INSERT INTO roles(name) SELECT DISTINCT role FROM users WHERE role IS NOT NULL ON CONFLICT DO NOTHING;
+
+INSERT INTO permissions(name, description) VALUES
+('search:read', 'search comics, get comics and images, suggestions'),
+('comics:update', 'fetch new comics and watch update jobs and background refresh'),
+('index:manage', 'reindex, check and repair the index, choose search strategy per request'),
+('users:manage', 'create, list, update and delete users')
+ON CONFLICT DO NOTHING;
+
+INSERT INTO role_permissions(role, permission) VALUES
+('user', 'search:read'),
+('admin', 'search:read'),
+('admin', 'comics:update'),
+('admin', 'index:manage'),
+('admin', 'users:manage')
+ON CONFLICT DO NOTHING;
+
+ALTER TABLE users ADD CONSTRAINT users_role_fkey FOREIGN KEY (role) REFERENCES roles(name) ON UPDATE CASCADE;
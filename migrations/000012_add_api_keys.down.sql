@@ -0,0 +1,3 @@
+DELETE FROM permissions WHERE name = 'apikeys:manage';
+
+DROP TABLE IF EXISTS api_keys;
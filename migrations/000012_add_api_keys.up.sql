@@ -0,0 +1,20 @@
+-- Ключ хранится только в виде SHA-256 хэша, prefix — его открытая часть,
+-- по которой ключ находят и отличают в списке.
+CREATE TABLE IF NOT EXISTS api_keys (
+    id SERIAL PRIMARY KEY,
+    prefix VARCHAR(16) NOT NULL UNIQUE,
+    key_hash TEXT NOT NULL,
+    name TEXT NOT NULL,
+    owner VARCHAR(32) NOT NULL REFERENCES users(username) ON DELETE CASCADE ON UPDATE CASCADE,
+    scopes TEXT[] NOT NULL,
+    expires_at TIMESTAMPTZ,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    last_used_at TIMESTAMPTZ,
+    revoked_at TIMESTAMPTZ
+);
+
+INSERT INTO permissions(name, description) VALUES
+('apikeys:manage', 'issue, list and revoke API keys')
+ON CONFLICT DO NOTHING;
+
+INSERT INTO role_permissions(role, permission) VALUES ('admin', 'apikeys:manage') ON CONFLICT DO NOTHING;
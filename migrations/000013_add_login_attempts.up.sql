@@ -0,0 +1,13 @@
+-- Попытки входа: по ним считаются неудачи для блокировки перебора,
+-- и они же служат журналом неудачных входов. username — имя из запроса,
+-- поэтому внешнего ключа на users нет.
+CREATE TABLE IF NOT EXISTS login_attempts (
+    id BIGSERIAL PRIMARY KEY,
+    username VARCHAR(32) NOT NULL,
+    ip TEXT NOT NULL,
+    outcome TEXT NOT NULL CHECK (outcome IN ('success', 'failure', 'locked')),
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now()
+);
+
+CREATE INDEX IF NOT EXISTS login_attempts_username_idx ON login_attempts(username, created_at);
+CREATE INDEX IF NOT EXISTS login_attempts_ip_idx ON login_attempts(ip, created_at);
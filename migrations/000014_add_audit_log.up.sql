@@ -0,0 +1,36 @@
+-- Журнал аудита: кто (actor), что сделал (action) и с чем (target), с каким
+-- результатом и откуда. Журнал только пополняется: изменить или удалить
+-- записи не дает триггер. actor — имя пользователя на момент действия,
+-- внешнего ключа на users нет, чтобы записи пережили удаление пользователя.
+CREATE TABLE IF NOT EXISTS audit_log (
+    id BIGSERIAL PRIMARY KEY,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT now(),
+    actor VARCHAR(32) NOT NULL,
+    api_key_id INT,
+    action TEXT NOT NULL,
+    target TEXT NOT NULL DEFAULT '',
+    details TEXT NOT NULL DEFAULT '',
+    outcome TEXT NOT NULL CHECK (outcome IN ('success', 'failure')),
+    client_ip TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS audit_log_created_at_idx ON audit_log(created_at);
+CREATE INDEX IF NOT EXISTS audit_log_actor_idx ON audit_log(actor, created_at);
+
+CREATE OR REPLACE FUNCTION audit_log_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'audit_log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER audit_log_no_update BEFORE UPDATE OR DELETE ON audit_log
+    FOR EACH ROW EXECUTE FUNCTION audit_log_append_only();
+
+CREATE TRIGGER audit_log_no_truncate BEFORE TRUNCATE ON audit_log
+    FOR EACH STATEMENT EXECUTE FUNCTION audit_log_append_only();
+
+INSERT INTO permissions(name, description) VALUES
+('audit:read', 'read the audit log')
+ON CONFLICT DO NOTHING;
+
+INSERT INTO role_permissions(role, permission) VALUES ('admin', 'audit:read') ON CONFLICT DO NOTHING;
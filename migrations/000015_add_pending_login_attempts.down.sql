@@ -0,0 +1,7 @@
+DROP INDEX IF EXISTS login_attempts_created_at_idx;
+
+UPDATE login_attempts SET outcome = 'failure' WHERE outcome = 'pending';
+
+ALTER TABLE login_attempts DROP CONSTRAINT IF EXISTS login_attempts_outcome_check;
+ALTER TABLE login_attempts ADD CONSTRAINT login_attempts_outcome_check
+    CHECK (outcome IN ('success', 'failure', 'locked'));
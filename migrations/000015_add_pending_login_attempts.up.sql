@@ -0,0 +1,8 @@
+-- Попытка входа записывается как pending до проверки пароля, чтобы параллельные
+-- попытки с тем же именем считали ее неудачей и не проверяли пароль без задержки.
+ALTER TABLE login_attempts DROP CONSTRAINT IF EXISTS login_attempts_outcome_check;
+ALTER TABLE login_attempts ADD CONSTRAINT login_attempts_outcome_check
+    CHECK (outcome IN ('success', 'failure', 'locked', 'pending'));
+
+-- Для удаления старых попыток.
+CREATE INDEX IF NOT EXISTS login_attempts_created_at_idx ON login_attempts(created_at);
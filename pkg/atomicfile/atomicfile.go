@@ -0,0 +1,59 @@
+package atomicfile
+
+import (
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// Write writes src to a temporary file next to path and renames it to path,
+// so a crash never leaves a partially written file behind. The file gets perm
+// regardless of umask-limited CreateTemp permissions.
+func Write(path string, perm fs.FileMode, src io.WriterTo) error {
+	f, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("create temp file error: %w", err)
+	}
+
+	if err := writeAndClose(f, perm, src); err != nil {
+		os.Remove(f.Name()) //nolint:errcheck
+
+		return err
+	}
+
+	if err := os.Rename(f.Name(), path); err != nil {
+		os.Remove(f.Name()) //nolint:errcheck
+
+		return fmt.Errorf("rename error: %w", err)
+	}
+
+	return nil
+}
+
+func writeAndClose(f *os.File, perm fs.FileMode, src io.WriterTo) error {
+	if err := f.Chmod(perm); err != nil {
+		f.Close() //nolint:errcheck
+
+		return fmt.Errorf("chmod error: %w", err)
+	}
+
+	if _, err := src.WriteTo(f); err != nil {
+		f.Close() //nolint:errcheck
+
+		return fmt.Errorf("write error: %w", err)
+	}
+
+	if err := f.Sync(); err != nil {
+		f.Close() //nolint:errcheck
+
+		return fmt.Errorf("sync error: %w", err)
+	}
+
+	if err := f.Close(); err != nil {
+		return fmt.Errorf("close error: %w", err)
+	}
+
+	return nil
+}
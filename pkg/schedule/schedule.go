@@ -0,0 +1,257 @@
+package schedule
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var ErrInvalidSpec = errors.New("invalid schedule spec")
+
+// maxSearchYears ограничивает поиск следующего запуска для расписаний,
+// которые никогда не срабатывают (например, 30 февраля).
+const maxSearchYears = 5
+
+// Schedule вычисляет время следующего запуска после t.
+// Нулевое время означает, что запусков больше не будет.
+type Schedule interface {
+	Next(t time.Time) time.Time
+}
+
+// Parse разбирает расписание в одном из форматов:
+//
+//	"@every 1h30m" или "1h30m"  — интервал между запусками;
+//	"@hourly", "@daily", "@weekly", "@monthly" — сокращения cron;
+//	"m h dom mon dow"           — cron выражение из пяти полей,
+//	                              поддерживаются *, списки, диапазоны и шаги.
+//
+// Cron выражения вычисляются по местному времени loc, которое можно переопределить
+// префиксом "CRON_TZ=Europe/Moscow ". Время, попадающее в переход на летнее время,
+// пропускается, повторяющееся при переходе на зимнее — срабатывает один раз.
+func Parse(spec string, loc *time.Location) (Schedule, error) { //nolint:ireturn
+	spec = strings.TrimSpace(spec)
+
+	if rest, ok := strings.CutPrefix(spec, "@every "); ok {
+		return parseInterval(rest)
+	}
+
+	if d, err := time.ParseDuration(spec); err == nil {
+		return newInterval(d)
+	}
+
+	if rest, ok := strings.CutPrefix(spec, "CRON_TZ="); ok {
+		name, expr, _ := strings.Cut(rest, " ")
+
+		l, err := time.LoadLocation(name)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %w", ErrInvalidSpec, err)
+		}
+
+		loc, spec = l, strings.TrimSpace(expr)
+	}
+
+	switch spec {
+	case "@hourly":
+		spec = "0 * * * *"
+	case "@daily", "@midnight":
+		spec = "0 0 * * *"
+	case "@weekly":
+		spec = "0 0 * * 0"
+	case "@monthly":
+		spec = "0 0 1 * *"
+	}
+
+	return parseCron(spec, loc)
+}
+
+// Interval срабатывает через равные промежутки времени.
+type Interval time.Duration
+
+func parseInterval(s string) (Interval, error) {
+	d, err := time.ParseDuration(strings.TrimSpace(s))
+	if err != nil {
+		return 0, fmt.Errorf("%w: %w", ErrInvalidSpec, err)
+	}
+
+	return newInterval(d)
+}
+
+func newInterval(d time.Duration) (Interval, error) {
+	if d <= 0 {
+		return 0, fmt.Errorf("%w: non-positive interval %s", ErrInvalidSpec, d)
+	}
+
+	return Interval(d), nil
+}
+
+func (i Interval) Next(t time.Time) time.Time {
+	return t.Add(time.Duration(i))
+}
+
+// Cron — расписание из пяти полей с точностью до минуты.
+type Cron struct {
+	minute, hour, dom, month, dow bitset
+	// Если ограничены и день месяца, и день недели, достаточно совпадения одного из них.
+	domStar, dowStar bool
+	loc              *time.Location
+}
+
+type bitset uint64
+
+func (b bitset) has(v int) bool {
+	return b&(1<<uint(v)) != 0
+}
+
+type field struct {
+	name     string
+	min, max int
+}
+
+//nolint:gochecknoglobals,gomnd
+var cronFields = [5]field{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day of month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12},
+	{name: "day of week", min: 0, max: 7},
+}
+
+func parseCron(spec string, loc *time.Location) (Cron, error) {
+	parts := strings.Fields(spec)
+	if len(parts) != len(cronFields) {
+		return Cron{}, fmt.Errorf("%w: expected %d fields, got %d", ErrInvalidSpec, len(cronFields), len(parts))
+	}
+
+	var sets [5]bitset
+
+	for i, p := range parts {
+		set, err := parseField(p, cronFields[i])
+		if err != nil {
+			return Cron{}, err
+		}
+
+		sets[i] = set
+	}
+
+	// Воскресенье можно записать и как 0, и как 7.
+	if sets[4].has(7) { //nolint:gomnd
+		sets[4] |= 1
+	}
+
+	if loc == nil {
+		loc = time.Local
+	}
+
+	return Cron{
+		minute:  sets[0],
+		hour:    sets[1],
+		dom:     sets[2],
+		month:   sets[3],
+		dow:     sets[4],
+		domStar: parts[2] == "*",
+		dowStar: parts[4] == "*",
+		loc:     loc,
+	}, nil
+}
+
+// parseField разбирает поле cron: список через запятую из "*", "a" или "a-b",
+// каждый с необязательным шагом "/n".
+func parseField(s string, f field) (bitset, error) {
+	var set bitset
+
+	for _, item := range strings.Split(s, ",") {
+		rng, stepStr, hasStep := strings.Cut(item, "/")
+
+		step := 1
+
+		if hasStep {
+			n, err := strconv.Atoi(stepStr)
+			if err != nil || n <= 0 {
+				return 0, fmt.Errorf("%w: %s: bad step %q", ErrInvalidSpec, f.name, stepStr)
+			}
+
+			step = n
+		}
+
+		lo, hi := f.min, f.max
+
+		if rng != "*" {
+			var err error
+
+			loStr, hiStr, isRange := strings.Cut(rng, "-")
+
+			if lo, err = strconv.Atoi(loStr); err != nil {
+				return 0, fmt.Errorf("%w: %s: bad value %q", ErrInvalidSpec, f.name, loStr)
+			}
+
+			hi = lo
+
+			switch {
+			case isRange:
+				if hi, err = strconv.Atoi(hiStr); err != nil {
+					return 0, fmt.Errorf("%w: %s: bad value %q", ErrInvalidSpec, f.name, hiStr)
+				}
+			case hasStep:
+				hi = f.max
+			}
+		}
+
+		if lo < f.min || hi > f.max || lo > hi {
+			return 0, fmt.Errorf("%w: %s: %q out of range %d-%d", ErrInvalidSpec, f.name, item, f.min, f.max)
+		}
+
+		for v := lo; v <= hi; v += step {
+			set |= 1 << uint(v)
+		}
+	}
+
+	return set, nil
+}
+
+// Next перебирает время от t с шагом в месяц, день, час или минуту,
+// пропуская значения, не подходящие под соответствующее поле.
+func (c Cron) Next(t time.Time) time.Time {
+	from := wallClock(t.In(c.loc))
+
+	t = t.In(c.loc).Truncate(time.Minute).Add(time.Minute)
+	limit := t.AddDate(maxSearchYears, 0, 0)
+
+	for t.Before(limit) {
+		y, m, d := t.Date()
+
+		switch {
+		case !c.month.has(int(m)):
+			t = time.Date(y, m+1, 1, 0, 0, 0, 0, c.loc)
+		case !c.dayMatches(t):
+			t = time.Date(y, m, d+1, 0, 0, 0, 0, c.loc)
+		case !c.hour.has(t.Hour()):
+			t = t.Add(time.Duration(60-t.Minute()) * time.Minute) //nolint:gomnd
+		case !c.minute.has(t.Minute()) || !wallClock(t).After(from):
+			// После перехода на зимнее время часы идут назад, уже прошедшее
+			// по местному времени не должно срабатывать повторно.
+			t = t.Add(time.Minute)
+		default:
+			return t
+		}
+	}
+
+	return time.Time{}
+}
+
+// wallClock возвращает местное время t без учета смещения часового пояса.
+func wallClock(t time.Time) time.Time {
+	return time.Date(t.Year(), t.Month(), t.Day(), t.Hour(), t.Minute(), t.Second(), 0, time.UTC)
+}
+
+func (c Cron) dayMatches(t time.Time) bool {
+	dom := c.dom.has(t.Day())
+	dow := c.dow.has(int(t.Weekday()))
+
+	if c.domStar || c.dowStar {
+		return dom && dow
+	}
+
+	return dom || dow
+}
@@ -0,0 +1,77 @@
+package schedule_test
+
+import (
+	"testing"
+	"time"
+	_ "time/tzdata" // часовые пояса для проверки перехода на летнее время.
+
+	"github.com/Leopold1975/yadro_app/pkg/schedule"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNext(t *testing.T) {
+	t.Parallel()
+
+	msk := time.FixedZone("MSK", 3*60*60)
+	from := time.Date(2024, time.May, 20, 23, 16, 30, 0, msk) // понедельник.
+
+	tests := []struct {
+		spec     string
+		expected time.Time
+	}{
+		{"@every 90m", from.Add(90 * time.Minute)},
+		{"6h", from.Add(6 * time.Hour)},
+		{"16 23 * * *", time.Date(2024, time.May, 21, 23, 16, 0, 0, msk)},
+		{"*/15 * * * *", time.Date(2024, time.May, 20, 23, 30, 0, 0, msk)},
+		{"0 9-17/4 * * 1-5", time.Date(2024, time.May, 21, 9, 0, 0, 0, msk)},
+		{"0 0 * * 7", time.Date(2024, time.May, 26, 0, 0, 0, 0, msk)},
+		{"0 0 29 2 *", time.Date(2028, time.February, 29, 0, 0, 0, 0, msk)},
+		{"0 0 1,15 * 3", time.Date(2024, time.May, 22, 0, 0, 0, 0, msk)},
+		{"@monthly", time.Date(2024, time.June, 1, 0, 0, 0, 0, msk)},
+		{"0 0 30 2 *", time.Time{}},
+	}
+
+	for _, tc := range tests {
+		s, err := schedule.Parse(tc.spec, msk)
+		require.NoError(t, err, tc.spec)
+		require.True(t, tc.expected.Equal(s.Next(from)), "%s: %s", tc.spec, s.Next(from))
+	}
+}
+
+func TestNextDST(t *testing.T) {
+	t.Parallel()
+
+	ny, err := time.LoadLocation("America/New_York")
+	require.NoError(t, err)
+
+	// Ежедневный запуск остается в 3:00 по местному времени при переходе на летнее время.
+	s, err := schedule.Parse("0 3 * * *", ny)
+	require.NoError(t, err)
+
+	next := s.Next(time.Date(2024, time.March, 9, 12, 0, 0, 0, ny))
+	require.Equal(t, time.Date(2024, time.March, 10, 3, 0, 0, 0, ny), next)
+	require.Equal(t, time.Date(2024, time.March, 11, 3, 0, 0, 0, ny), s.Next(next))
+
+	// 2:30 10 марта не существует.
+	s, err = schedule.Parse("CRON_TZ=America/New_York 30 2 * * *", nil)
+	require.NoError(t, err)
+	require.Equal(t, time.Date(2024, time.March, 11, 2, 30, 0, 0, ny), s.Next(time.Date(2024, time.March, 10, 0, 0, 0, 0, ny)))
+
+	// 1:30 3 ноября наступает дважды, запуск — только первый раз.
+	s, err = schedule.Parse("30 1 * * *", ny)
+	require.NoError(t, err)
+
+	first := s.Next(time.Date(2024, time.November, 3, 0, 0, 0, 0, ny))
+	require.Equal(t, time.Date(2024, time.November, 3, 5, 30, 0, 0, time.UTC), first.UTC())
+	require.Equal(t, time.Date(2024, time.November, 4, 1, 30, 0, 0, ny), s.Next(first))
+}
+
+func TestParseErrors(t *testing.T) {
+	t.Parallel()
+
+	for _, spec := range []string{"", "* * * *", "60 * * * *", "* 24 * * *", "0 0 0 * *", "*/0 * * * *",
+		"5-1 * * * *", "a * * * *", "@every -1h", "@every x", "CRON_TZ=Nowhere/City * * * * *"} {
+		_, err := schedule.Parse(spec, time.UTC)
+		require.ErrorIs(t, err, schedule.ErrInvalidSpec, spec)
+	}
+}
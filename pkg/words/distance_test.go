@@ -0,0 +1,30 @@
+package words_test
+
+import (
+	"testing"
+
+	"github.com/Leopold1975/yadro_app/pkg/words"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLevenshtein(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		a, b     string
+		expected int
+	}{
+		{"", "", 0},
+		{"physic", "physic", 0},
+		{"physc", "physic", 1},
+		{"", "abc", 3},
+		{"kitten", "sitting", 3},
+		{"flaw", "lawn", 2},
+		{"ᵣeₐd", "read", 2},
+	}
+
+	for _, tc := range tests {
+		require.Equal(t, tc.expected, words.Levenshtein(tc.a, tc.b), "%q -> %q", tc.a, tc.b)
+		require.Equal(t, tc.expected, words.Levenshtein(tc.b, tc.a), "%q -> %q", tc.b, tc.a)
+	}
+}
@@ -18,6 +18,13 @@ func StemWords(phrase string) ([]string, error) {
 	return StemWordsPorter(phrase)
 }
 
+// StemTokens returns stemmed words of the phrase in their original order,
+// keeping duplicates. Positions of the words in the result are used for phrase search.
+// It uses porter2, see Tokens for other stemmers.
+func StemTokens(phrase string) []string {
+	return Tokens(Porter2{}, phrase)
+}
+
 // StemWordsPorter is used for turning a phrase into a list of stemmed words
 // and uses porter lib for it. Example:
 //
@@ -70,6 +77,10 @@ func StemWordsSnowball(phrase string) ([]string, error) {
 // GetWords function that gives back slice of words
 // except prepositions, pronouns and punctuation marks.
 func GetWords(phrase string) []string {
+	return getWords(phrase, isEnglishStopWord)
+}
+
+func getWords(phrase string, isStopWord func(string) bool) []string {
 	// See bench_larger_regexp and bench_smaller_regexp to finc out the difference in
 	// performance of these two approaches
 	// re := regexp.MustCompile(`([\,\;\.\?\!\:\&]+|n't|'ve|'re|'m|'ll|'d|'s)`)
@@ -105,7 +116,7 @@ func GetWords(phrase string) []string {
 			}
 		}
 
-		if _, ok := stopWords[word]; ok {
+		if isStopWord(word) {
 			continue
 		}
 
@@ -0,0 +1,131 @@
+package words
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/kljensen/snowball/english"
+	"github.com/kljensen/snowball/french"
+	"github.com/kljensen/snowball/hungarian"
+	"github.com/kljensen/snowball/norwegian"
+	"github.com/kljensen/snowball/russian"
+	"github.com/kljensen/snowball/spanish"
+	"github.com/kljensen/snowball/swedish"
+	"github.com/surgebase/porter2"
+)
+
+const (
+	Porter2Stemmer  = "porter2"
+	SnowballStemmer = "snowball"
+	NoopStemmer     = "noop"
+)
+
+var (
+	ErrUnknownStemmer      = errors.New("unknown stemmer")
+	ErrUnsupportedLanguage = errors.New("unsupported language")
+)
+
+// Stemmer reduces words to their stems and filters out stop words of its language.
+// Name identifies the algorithm and the language: words indexed with one stemmer
+// can't be reliably found with another, so Name is stored with the index.
+type Stemmer interface {
+	Stem(word string) string
+	IsStopWord(word string) bool
+	Name() string
+}
+
+type language struct {
+	stem     func(word string, stemStopWords bool) string
+	stopWord func(word string) bool
+}
+
+// languages supported by snowball. English uses the package's own stop words list
+// to keep the behaviour of GetWords.
+var languages = map[string]language{ //nolint:gochecknoglobals
+	EngLang:     {stem: english.Stem, stopWord: isEnglishStopWord},
+	"french":    {stem: french.Stem, stopWord: french.IsStopWord},
+	"hungarian": {stem: hungarian.Stem, stopWord: hungarian.IsStopWord},
+	"norwegian": {stem: norwegian.Stem, stopWord: norwegian.IsStopWord},
+	"russian":   {stem: russian.Stem, stopWord: russian.IsStopWord},
+	"spanish":   {stem: spanish.Stem, stopWord: spanish.IsStopWord},
+	"swedish":   {stem: swedish.Stem, stopWord: swedish.IsStopWord},
+}
+
+// NewStemmer returns a stemmer by its kind: porter2 (English only),
+// snowball or noop, which keeps words as they are but still drops stop words of lang.
+// Empty kind and lang mean porter2 and English.
+func NewStemmer(kind, lang string) (Stemmer, error) { //nolint:ireturn
+	if lang == "" {
+		lang = EngLang
+	}
+
+	l, ok := languages[lang]
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnsupportedLanguage, lang)
+	}
+
+	switch kind {
+	case Porter2Stemmer, "":
+		if lang != EngLang {
+			return nil, fmt.Errorf("%w: porter2 supports only %s, got %s", ErrUnsupportedLanguage, EngLang, lang)
+		}
+
+		return Porter2{}, nil
+	case SnowballStemmer:
+		return snowballStemmer{lang: lang, language: l}, nil
+	case NoopStemmer:
+		return noopStemmer{lang: lang, language: l}, nil
+	default:
+		return nil, fmt.Errorf("%w: %s", ErrUnknownStemmer, kind)
+	}
+}
+
+// Porter2 is the English porter2 stemmer. It was the only stemmer before
+// Stemmer appeared, so indexes without a recorded stemmer were built with it.
+type Porter2 struct{}
+
+func (Porter2) Stem(word string) string     { return porter2.Stem(word) }
+func (Porter2) IsStopWord(word string) bool { return isEnglishStopWord(word) }
+func (Porter2) Name() string                { return Porter2Stemmer }
+
+type snowballStemmer struct {
+	lang string
+	language
+}
+
+func (s snowballStemmer) Stem(word string) string     { return s.stem(word, true) }
+func (s snowballStemmer) IsStopWord(word string) bool { return s.stopWord(word) }
+func (s snowballStemmer) Name() string                { return SnowballStemmer + ":" + s.lang }
+
+type noopStemmer struct {
+	lang string
+	language
+}
+
+func (noopStemmer) Stem(word string) string       { return word }
+func (s noopStemmer) IsStopWord(word string) bool { return s.stopWord(word) }
+func (s noopStemmer) Name() string                { return NoopStemmer + ":" + s.lang }
+
+// Words returns normalized but unstemmed words of the phrase: Words(s, p)[i]
+// is the surface form of Tokens(s, p)[i].
+func Words(s Stemmer, phrase string) []string {
+	return getWords(phrase, s.IsStopWord)
+}
+
+// Tokens returns stemmed words of the phrase in their original order,
+// keeping duplicates and dropping stop words of the stemmer's language.
+func Tokens(s Stemmer, phrase string) []string {
+	words := Words(s, phrase)
+
+	for i, w := range words {
+		words[i] = s.Stem(w)
+	}
+
+	return words
+}
+
+func isEnglishStopWord(word string) bool {
+	_, ok := stopWords[word]
+
+	return ok
+}
@@ -0,0 +1,41 @@
+package words_test
+
+import (
+	"testing"
+
+	"github.com/Leopold1975/yadro_app/pkg/words"
+	"github.com/stretchr/testify/require"
+)
+
+func TestNewStemmer(t *testing.T) {
+	t.Parallel()
+
+	tests := []struct {
+		kind     string
+		lang     string
+		name     string
+		phrase   string
+		expected []string
+	}{
+		{"", "", "porter2", "the followers bring questions", []string{"follow", "bring", "question"}},
+		{"snowball", "english", "snowball:english", "the followers bring questions", []string{"follow", "bring", "question"}},
+		{"snowball", "russian", "snowball:russian", "и кошки спят на диване", []string{"кошк", "спят", "диван"}},
+		{"noop", "english", "noop:english", "the followers bring questions", []string{"followers", "bring", "questions"}},
+	}
+
+	for _, tc := range tests {
+		s, err := words.NewStemmer(tc.kind, tc.lang)
+		require.NoError(t, err)
+		require.Equal(t, tc.name, s.Name())
+		require.Equal(t, tc.expected, words.Tokens(s, tc.phrase))
+	}
+
+	_, err := words.NewStemmer("porter2", "russian")
+	require.ErrorIs(t, err, words.ErrUnsupportedLanguage)
+
+	_, err = words.NewStemmer("snowball", "klingon")
+	require.ErrorIs(t, err, words.ErrUnsupportedLanguage)
+
+	_, err = words.NewStemmer("lancaster", "english")
+	require.ErrorIs(t, err, words.ErrUnknownStemmer)
+}
@@ -0,0 +1,139 @@
+package xkcd
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// breaker приостанавливает все запросы клиента, когда xkcd.com явно недоступен.
+// После threshold неудачных запросов подряд breaker размыкается на cooldown.
+// По истечении cooldown проходит один пробный запрос, остальные ждут его результата:
+// успех замыкает breaker, неудача снова размыкает его на cooldown.
+type breaker struct {
+	threshold int
+	cooldown  time.Duration
+
+	mu        sync.Mutex
+	failures  int
+	openUntil time.Time
+	probing   bool
+	changed   chan struct{} // закрывается, когда пробный запрос завершился.
+}
+
+func newBreaker(threshold int, cooldown time.Duration) *breaker {
+	return &breaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+		mu:        sync.Mutex{},
+		failures:  0,
+		openUntil: time.Time{},
+		probing:   false,
+		changed:   make(chan struct{}),
+	}
+}
+
+// wait блокируется, пока breaker разомкнут или выполняется пробный запрос.
+// После успешного wait вызывающий обязан сообщить результат запроса
+// через success, failure или release.
+func (b *breaker) wait(ctx context.Context) error {
+	for {
+		b.mu.Lock()
+
+		now := time.Now()
+
+		switch {
+		case now.Before(b.openUntil):
+			d := b.openUntil.Sub(now)
+			b.mu.Unlock()
+
+			if err := sleep(ctx, d); err != nil {
+				return err
+			}
+		case b.probing:
+			changed := b.changed
+			b.mu.Unlock()
+
+			select {
+			case <-ctx.Done():
+				return fmt.Errorf("wait probe: %w", ctx.Err())
+			case <-changed:
+			}
+		default:
+			if b.tripped() {
+				b.probing = true
+			}
+
+			b.mu.Unlock()
+
+			return nil
+		}
+	}
+}
+
+func (b *breaker) success() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures = 0
+	b.finishProbe()
+}
+
+func (b *breaker) failure() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.failures++
+	if b.tripped() {
+		b.openUntil = time.Now().Add(b.cooldown)
+	}
+
+	b.finishProbe()
+}
+
+// release завершает запрос, результат которого ничего не говорит о состоянии
+// сервера, например отмененный через контекст.
+func (b *breaker) release() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.finishProbe()
+}
+
+// pause приостанавливает все запросы на d, например по заголовку Retry-After.
+func (b *breaker) pause(d time.Duration) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if until := time.Now().Add(d); until.After(b.openUntil) {
+		b.openUntil = until
+	}
+}
+
+func (b *breaker) tripped() bool {
+	return b.threshold > 0 && b.failures >= b.threshold
+}
+
+func (b *breaker) finishProbe() {
+	if !b.probing {
+		return
+	}
+
+	b.probing = false
+
+	close(b.changed)
+	b.changed = make(chan struct{})
+}
+
+func sleep(ctx context.Context, d time.Duration) error {
+	t := time.NewTimer(d)
+	defer t.Stop()
+
+	select {
+	case <-ctx.Done():
+		return fmt.Errorf("sleep: %w", ctx.Err())
+	case <-t.C:
+		return nil
+	}
+}
@@ -6,30 +6,44 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math/rand/v2"
 	"net/http"
 	"net/url"
+	"strconv"
 	"time"
 
 	"github.com/Leopold1975/yadro_app/internal/models"
+	"github.com/Leopold1975/yadro_app/internal/pkg/config"
 )
 
 const (
 	infoSuffix = "info.0.json"
 )
 
-var ErrUnexpectedCode = errors.New("unexpected response from server")
+var (
+	ErrUnexpectedCode = errors.New("unexpected response from server")
+	// ErrRetryAfterTooLong возвращается, если сервер просит подождать дольше
+	// cfg.RetryAfterMax: повторять раньше срока нельзя, а ждать столько незачем.
+	ErrRetryAfterTooLong = errors.New("retry-after exceeds limit")
+)
+
+// errTemporary помечает ошибки, после которых запрос имеет смысл повторить:
+// сетевые ошибки, 429 и 5xx.
+var errTemporary = errors.New("temporary error")
 
 type Client struct {
 	sourceURL string
 	client    *http.Client
-	Err       error
+	cfg       config.Client
+	breaker   *breaker
 }
 
-func New(sourceURL string) *Client {
+func New(sourceURL string, cfg config.Client) *Client {
 	return &Client{
 		sourceURL: sourceURL,
 		client:    http.DefaultClient,
-		Err:       nil,
+		cfg:       cfg,
+		breaker:   newBreaker(cfg.Breaker.Threshold, cfg.Breaker.Cooldown),
 	}
 }
 
@@ -39,62 +53,171 @@ func (c *Client) GetComics(ctx context.Context, id string) (models.XKCDModel, er
 		return models.XKCDModel{}, fmt.Errorf("join path error: %w", err)
 	}
 
-	ctx, cancel := context.WithTimeout(ctx, time.Second*5) //nolint:gomnd
-	defer cancel()
+	m, err := c.getModel(ctx, resURL)
+	if err != nil {
+		return models.XKCDModel{}, fmt.Errorf("id: %s err: %w", id, err)
+	}
+
+	return m, nil
+}
+
+// GetImage скачивает картинку комикса по адресу из поля img.
+func (c *Client) GetImage(ctx context.Context, imgURL string) ([]byte, error) {
+	body, err := c.get(ctx, imgURL, "image/*")
+	if err != nil {
+		return nil, fmt.Errorf("image %s err: %w", imgURL, err)
+	}
+
+	return body, nil
+}
+
+// GetLatestNum возвращает номер последнего опубликованного комикса.
+func (c *Client) GetLatestNum(ctx context.Context) (int, error) {
+	resURL, err := url.JoinPath(c.sourceURL, infoSuffix)
+	if err != nil {
+		return 0, fmt.Errorf("join path error: %w", err)
+	}
+
+	m, err := c.getModel(ctx, resURL)
+	if err != nil {
+		return 0, fmt.Errorf("latest comics err: %w", err)
+	}
+
+	return m.Num, nil
+}
+
+func (c *Client) getModel(ctx context.Context, resURL string) (models.XKCDModel, error) {
+	body, err := c.get(ctx, resURL, "application/json")
+	if err != nil {
+		return models.XKCDModel{}, err
+	}
+
+	var m models.XKCDModel
+	if err := json.Unmarshal(body, &m); err != nil {
+		return models.XKCDModel{}, fmt.Errorf("unmarshal body error: %w", err)
+	}
+
+	return m, nil
+}
+
+// get выполняет запрос, повторяя его не более cfg.MaxRetries раз после временных ошибок.
+// Между попытками выдерживается экспоненциальная задержка со случайным разбросом,
+// а при ответе с Retry-After все запросы клиента приостанавливаются на весь
+// указанный срок. Если он больше cfg.RetryAfterMax, запрос не повторяется.
+func (c *Client) get(ctx context.Context, resURL, accept string) ([]byte, error) {
+	for attempt := 0; ; attempt++ {
+		if err := c.breaker.wait(ctx); err != nil {
+			return nil, fmt.Errorf("circuit breaker: %w", err)
+		}
+
+		body, retryAfter, err := c.do(ctx, resURL, accept)
+
+		switch {
+		case err == nil || !errors.Is(err, errTemporary):
+			c.breaker.success()
+
+			return body, err
+		case ctx.Err() != nil:
+			c.breaker.release()
+
+			return nil, err
+		}
+
+		c.breaker.failure()
+
+		if attempt >= c.cfg.MaxRetries {
+			return nil, fmt.Errorf("%d attempts: %w", attempt+1, err)
+		}
+
+		delay := c.backoff(attempt)
+		if retryAfter > 0 {
+			c.breaker.pause(retryAfter)
+
+			if c.cfg.RetryAfterMax > 0 && retryAfter > c.cfg.RetryAfterMax {
+				return nil, fmt.Errorf("%w: %s > %s: %w", ErrRetryAfterTooLong, retryAfter, c.cfg.RetryAfterMax, err)
+			}
+
+			delay = retryAfter
+		}
+
+		if err := sleep(ctx, delay); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// do выполняет одну попытку запроса. Для 429 и 503 также возвращает
+// задержку из заголовка Retry-After, если он есть.
+func (c *Client) do(ctx context.Context, resURL, accept string) ([]byte, time.Duration, error) {
+	if c.cfg.Timeout > 0 {
+		var cancel context.CancelFunc
+
+		ctx, cancel = context.WithTimeout(ctx, c.cfg.Timeout)
+		defer cancel()
+	}
 
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, resURL, nil)
 	if err != nil {
-		return models.XKCDModel{}, fmt.Errorf("HTTP GET error: %w", err)
+		return nil, 0, fmt.Errorf("HTTP GET error: %w", err)
 	}
 
-	req.Header.Add("Accept", "application/json")
+	req.Header.Add("Accept", accept)
 
 	resp, err := c.client.Do(req)
 	if err != nil {
-		return models.XKCDModel{}, fmt.Errorf("HTTP GET error: %w", err)
+		return nil, 0, fmt.Errorf("HTTP GET error: %w: %w", errTemporary, err)
 	}
 	defer resp.Body.Close()
 
 	switch {
 	case resp.StatusCode == http.StatusNotFound:
-		return models.XKCDModel{}, models.ErrNotFound
+		return nil, 0, models.ErrNotFound
 	case resp.StatusCode >= http.StatusOK && resp.StatusCode < http.StatusMultipleChoices:
 		body, err := io.ReadAll(resp.Body)
 		if err != nil {
-			return models.XKCDModel{}, fmt.Errorf("read body error: %w", err)
-		}
-
-		var m models.XKCDModel
-		if err := json.Unmarshal(body, &m); err != nil {
-			return models.XKCDModel{}, fmt.Errorf("unmarshal body error: %w", err)
+			return nil, 0, fmt.Errorf("read body error: %w: %w", errTemporary, err)
 		}
 
-		return m, nil
+		return body, 0, nil
+	case resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode == http.StatusServiceUnavailable:
+		return nil, parseRetryAfter(resp.Header.Get("Retry-After")),
+			fmt.Errorf("code: %d err: %w: %w", resp.StatusCode, errTemporary, ErrUnexpectedCode)
+	case resp.StatusCode >= http.StatusInternalServerError:
+		return nil, 0, fmt.Errorf("code: %d err: %w: %w", resp.StatusCode, errTemporary, ErrUnexpectedCode)
 	default:
-		return models.XKCDModel{}, fmt.Errorf("id: %s code: %d err: %w", id, resp.StatusCode, ErrUnexpectedCode)
+		return nil, 0, fmt.Errorf("code: %d err: %w", resp.StatusCode, ErrUnexpectedCode)
 	}
 }
 
-func (c *Client) HandleErrorChan(ctx context.Context, errCh <-chan error) {
-	var err error
-
-loop:
-	for e := range errCh {
-		select {
-		case <-ctx.Done():
-			break loop
-		default:
-			if e != nil {
-				err = errors.Join(err, e)
-			}
-		}
+// backoff возвращает задержку перед повтором после попытки attempt:
+// BackoffMin, удваиваемый с каждой попыткой до BackoffMax, из которого
+// случайным образом выбирается значение от половины до целого.
+func (c *Client) backoff(attempt int) time.Duration {
+	d := c.cfg.BackoffMax
+	if attempt < 32 && c.cfg.BackoffMin<<attempt < d { //nolint:gomnd // защита от переполнения сдвига.
+		d = c.cfg.BackoffMin << attempt
 	}
 
-	if err != nil {
-		c.Err = err
+	if d <= 1 {
+		return d
 	}
+
+	return d/2 + rand.N(d/2) //nolint:gosec,gomnd // криптостойкость не нужна.
 }
 
-func (c *Client) RefreshError() {
-	c.Err = nil
+// parseRetryAfter разбирает Retry-After в виде числа секунд или HTTP даты.
+func parseRetryAfter(v string) time.Duration {
+	if v == "" {
+		return 0
+	}
+
+	if sec, err := strconv.Atoi(v); err == nil && sec > 0 {
+		return time.Duration(sec) * time.Second
+	}
+
+	if t, err := http.ParseTime(v); err == nil {
+		return time.Until(t)
+	}
+
+	return 0
 }
@@ -0,0 +1,143 @@
+package xkcd_test
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/Leopold1975/yadro_app/internal/models"
+	"github.com/Leopold1975/yadro_app/internal/pkg/config"
+	"github.com/Leopold1975/yadro_app/pkg/xkcd"
+	"github.com/stretchr/testify/require"
+)
+
+// newServer отвечает кодом codes[i] на i-й запрос, после них — комиксом.
+func newServer(t *testing.T, header http.Header, codes ...int) (*httptest.Server, *atomic.Int32) {
+	t.Helper()
+
+	requests := &atomic.Int32{}
+
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		n := int(requests.Add(1)) - 1
+		if n < len(codes) {
+			for k, v := range header {
+				w.Header()[k] = v
+			}
+
+			w.WriteHeader(codes[n])
+
+			return
+		}
+
+		json.NewEncoder(w).Encode(models.XKCDModel{Num: 1, Title: "Barrel"})
+	}))
+	t.Cleanup(s.Close)
+
+	return s, requests
+}
+
+func TestRetry(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.Client{Timeout: time.Second, MaxRetries: 2, BackoffMin: time.Millisecond, BackoffMax: 5 * time.Millisecond}
+
+	s, requests := newServer(t, nil, http.StatusInternalServerError, http.StatusBadGateway)
+
+	m, err := xkcd.New(s.URL, cfg).GetComics(context.Background(), "1")
+	require.NoError(t, err)
+	require.Equal(t, "Barrel", m.Title)
+	require.Equal(t, int32(3), requests.Load())
+
+	s, requests = newServer(t, nil, http.StatusInternalServerError, http.StatusInternalServerError, http.StatusInternalServerError)
+
+	_, err = xkcd.New(s.URL, cfg).GetComics(context.Background(), "1")
+	require.ErrorIs(t, err, xkcd.ErrUnexpectedCode)
+	require.Equal(t, int32(3), requests.Load())
+
+	s, requests = newServer(t, nil, http.StatusBadRequest)
+
+	_, err = xkcd.New(s.URL, cfg).GetComics(context.Background(), "1")
+	require.ErrorIs(t, err, xkcd.ErrUnexpectedCode)
+	require.Equal(t, int32(1), requests.Load())
+
+	s, requests = newServer(t, nil, http.StatusNotFound)
+
+	_, err = xkcd.New(s.URL, cfg).GetComics(context.Background(), "1")
+	require.ErrorIs(t, err, models.ErrNotFound)
+	require.Equal(t, int32(1), requests.Load())
+}
+
+func TestRetryAfter(t *testing.T) {
+	t.Parallel()
+
+	// Retry-After соблюдается полностью, даже если он больше BackoffMax.
+	cfg := config.Client{
+		Timeout:       time.Second,
+		MaxRetries:    1,
+		BackoffMin:    time.Millisecond,
+		BackoffMax:    100 * time.Millisecond,
+		RetryAfterMax: 2 * time.Second,
+	}
+	s, requests := newServer(t, http.Header{"Retry-After": []string{"1"}}, http.StatusTooManyRequests)
+
+	start := time.Now()
+
+	_, err := xkcd.New(s.URL, cfg).GetComics(context.Background(), "1")
+	require.NoError(t, err)
+	require.Equal(t, int32(2), requests.Load())
+	require.GreaterOrEqual(t, time.Since(start), time.Second)
+
+	// слишком долгий Retry-After не сокращается: запрос завершается ошибкой без повтора.
+	s, requests = newServer(t, http.Header{"Retry-After": []string{"120"}}, http.StatusTooManyRequests)
+	c := xkcd.New(s.URL, cfg)
+
+	start = time.Now()
+
+	_, err = c.GetComics(context.Background(), "1")
+	require.ErrorIs(t, err, xkcd.ErrRetryAfterTooLong)
+	require.ErrorIs(t, err, xkcd.ErrUnexpectedCode)
+	require.Equal(t, int32(1), requests.Load())
+	require.Less(t, time.Since(start), time.Second)
+
+	// и до истечения Retry-After клиент не отправляет другие запросы.
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+
+	_, err = c.GetComics(ctx, "2")
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Equal(t, int32(1), requests.Load())
+}
+
+func TestBreaker(t *testing.T) {
+	t.Parallel()
+
+	cfg := config.Client{
+		Timeout:    time.Second,
+		MaxRetries: 0,
+		Breaker:    config.Breaker{Threshold: 2, Cooldown: 100 * time.Millisecond},
+	}
+	s, requests := newServer(t, nil, http.StatusServiceUnavailable, http.StatusServiceUnavailable)
+	c := xkcd.New(s.URL, cfg)
+
+	for range 2 {
+		_, err := c.GetComics(context.Background(), "1")
+		require.ErrorIs(t, err, xkcd.ErrUnexpectedCode)
+	}
+
+	// Breaker разомкнут: запрос не уходит на сервер, пока не истечет Cooldown.
+	ctx, cancel := context.WithTimeout(context.Background(), cfg.Breaker.Cooldown/2)
+	defer cancel()
+
+	_, err := c.GetComics(ctx, "1")
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+	require.Equal(t, int32(2), requests.Load())
+
+	m, err := c.GetComics(context.Background(), "1")
+	require.NoError(t, err)
+	require.Equal(t, "Barrel", m.Title)
+	require.Equal(t, int32(3), requests.Load())
+}
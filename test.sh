@@ -1,17 +1,29 @@
-# admin password: admin
-# user1 password: 123456
-# user2 password: 1234
+# admin создается заранее: ADMIN_PASSWORD=... ./bin/xkcd-server -c config.yaml bootstrap-admin
+# Пароль администратора берется из того же ADMIN_PASSWORD.
 
-user_token=$(curl -s -D - -X POST http://localhost:4444/login \
+admin_token=$(curl -s -D - -X POST http://localhost:4444/login \
     -H "Content-Type: application/json" \
-    -d '{"username": "user1", "password": "123456"}'  \
+    -d "{\"username\": \"${ADMIN_USERNAME:-admin}\", \"password\": \"$ADMIN_PASSWORD\"}" \
     | grep -F "Authorization" | sed 's/Authorization: Bearer //' | tr -d '\r')
 
-admin_token=$(curl -s -D - -X POST http://localhost:4444/login \
+# POST /admin/users создает пользователя, 409 если он уже есть
+curl -s -X POST http://localhost:4444/admin/users \
+    -H "Content-Type: application/json" \
+    -H "Authorization: Bearer $admin_token" \
+    -d '{"username": "user1", "password": "User-password1", "role": "user"}'
+
+user_token=$(curl -s -D - -X POST http://localhost:4444/login \
     -H "Content-Type: application/json" \
-    -d '{"username": "admin", "password": "admin"}' \
+    -d '{"username": "user1", "password": "User-password1"}'  \
     | grep -F "Authorization" | sed 's/Authorization: Bearer //' | tr -d '\r')
 
+# Пакетные задания вместо входа по паролю используют API-ключ:
+# curl -H "X-API-Key: $API_KEY" http://localhost:4444/pics?search=apple
+# Ключ выдает POST /admin/api-keys.
+if [ -n "$API_KEY" ]; then
+    curl -X POST http://localhost:4444/update -H "X-API-Key: $API_KEY" -d '{}'
+fi
+
 # POST /update с admin токеном
 curl -X POST http://localhost:4444/update \
     -H "Content-Type: application/json" \